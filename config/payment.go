@@ -0,0 +1,26 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+var PaymentGateway payment.PaymentGateway
+
+// InitPaymentGateway selects the payment provider. PAYMENT_GATEWAY=fake keeps
+// payment links in memory for local development without a Cashfree account.
+func InitPaymentGateway() {
+	switch os.Getenv("PAYMENT_GATEWAY") {
+	case "fake":
+		log.Println("Using in-memory fake payment gateway")
+		PaymentGateway = payment.NewFakeGateway()
+	default:
+		gateway, err := payment.NewCashfreeGatewayFromEnv()
+		if err != nil {
+			log.Fatal("Failed to configure Cashfree: ", err)
+		}
+		PaymentGateway = gateway
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"github.com/jezhtech/prince-group-backend/helper"
+)
+
+var TicketKeys *helper.TicketKeyRing
+
+// InitTicketSigning loads the Ed25519 keys that sign ticket QR codes. The
+// server refuses to start without TICKET_SIGNING_KEYS unless
+// TICKET_SIGNING_TEMPORARY_KEY=true allows a throwaway key for local
+// development: tickets signed with it stop verifying when the server restarts.
+func InitTicketSigning() {
+	privateKeys := os.Getenv("TICKET_SIGNING_KEYS")
+	activeKeyID := os.Getenv("TICKET_SIGNING_ACTIVE_KID")
+
+	if privateKeys == "" {
+		if os.Getenv("TICKET_SIGNING_TEMPORARY_KEY") != "true" {
+			log.Fatal("TICKET_SIGNING_KEYS is not set; set TICKET_SIGNING_TEMPORARY_KEY=true to use a temporary key in development")
+		}
+		log.Println("TICKET_SIGNING_KEYS not set, using a temporary ticket signing key")
+		seed, _, err := helper.GenerateTicketKey()
+		if err != nil {
+			log.Fatal("Failed to generate ticket signing key: ", err)
+		}
+		privateKeys, activeKeyID = "dev:"+seed, "dev"
+	}
+
+	ring, err := helper.ParseTicketKeyRing(privateKeys, os.Getenv("TICKET_VERIFY_KEYS"), activeKeyID)
+	if err != nil {
+		log.Fatal("Failed to load ticket signing keys: ", err)
+	}
+	TicketKeys = ring
+}
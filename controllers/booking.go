@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,7 +19,10 @@ func GetBooking(c *gin.Context) {
 
 	booking, err := models.GetBookingByBookingNumber(bookingNumber)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionRead) {
 		return
 	}
 
@@ -111,57 +117,68 @@ func GetClientBookingsPaginated(c *gin.Context) {
 
 // GetClientBookingsStats returns overall booking statistics for client
 func GetClientBookingsStats(c *gin.Context) {
-	// Get all bookings to calculate stats
-	allBookings, err := models.GetAllBookings()
+	stats, err := models.GetBookingStats()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking stats"})
 		return
 	}
 
-	// Calculate stats
-	totalBookings := len(allBookings)
-	totalTickets := 0
-	paidTickets := 0
-	pendingTickets := 0
-	failedTickets := 0
-	paidBookings := 0
-	pendingBookings := 0
-	failedBookings := 0
-	revenue := 0.0
-
-	for _, booking := range allBookings {
-		ticketCount := booking.TicketCount
-		totalTickets += ticketCount
-
-		switch booking.PaymentStatus {
-		case "success":
-			paidTickets += ticketCount
-			paidBookings++
-			revenue += booking.PaymentPrice
-		case "pending":
-			pendingTickets += ticketCount
-			pendingBookings++
-		case "failed":
-			failedTickets += ticketCount
-			failedBookings++
-		}
-	}
-
 	c.JSON(200, gin.H{
-		"stats": gin.H{
-			"totalBookings":   totalBookings,
-			"paidBookings":    paidBookings,
-			"pendingBookings": pendingBookings,
-			"failedBookings":  failedBookings,
-			"totalTickets":    totalTickets,
-			"paidTickets":     paidTickets,
-			"pendingTickets":  pendingTickets,
-			"failedTickets":   failedTickets,
-			"revenue":         revenue,
-		},
+		"stats": stats,
 	})
 }
 
+// StreamClientBookingStats streams the dashboard over Server-Sent Events: a
+// "booking" event for every booking change and a fresh "stats" event shortly
+// after, batching bursts during on-sale into one stats query. Stats are also
+// resent periodically, which doubles as a keep-alive and picks up changes made
+// by other server processes.
+func StreamClientBookingStats(c *gin.Context) {
+	changes, unsubscribe := models.SubscribeBookingChanges()
+	defer unsubscribe()
+
+	stats, err := models.GetBookingStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking stats"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("stats", stats)
+	c.Writer.Flush()
+
+	periodic := time.NewTicker(30 * time.Second)
+	defer periodic.Stop()
+
+	var refresh <-chan time.Time
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case change := <-changes:
+			c.SSEvent("booking", change)
+			c.Writer.Flush()
+			if refresh == nil {
+				refresh = time.After(time.Second)
+			}
+			continue
+		case <-refresh:
+			refresh = nil
+		case <-periodic.C:
+		}
+
+		stats, err := models.GetBookingStats()
+		if err != nil {
+			fmt.Printf("Failed to refresh booking stats: %v\n", err)
+			continue
+		}
+		c.SSEvent("stats", stats)
+		c.Writer.Flush()
+	}
+}
+
 func CreateBooking(c *gin.Context) {
 	var booking models.Booking
 
@@ -170,53 +187,219 @@ func CreateBooking(c *gin.Context) {
 		return
 	}
 
-	booking.BookingNumber = helper.GenerateBookingNumber()
+	ticket, err := models.GetTicketByID(booking.TicketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	now := time.Now()
+	booking.UserID = c.GetString("firebaseId")
 
-	maxRetries := 10
+	// Price is always computed server-side; whatever the client sent is ignored
+	quote, ok := priceBooking(c, ticket, booking.TicketCount, booking.ReferralID, booking.CouponCode, now)
+	if !ok {
+		return
+	}
+
+	booking.PaymentPrice = quote.Total
+	booking.FreeTickets = quote.FreeTickets
+	booking.PaidTickets = quote.PaidTickets
+	booking.UnitPrice = quote.UnitPrice
+	booking.PriceTierID = quote.PriceTierID
+	booking.CouponID = quote.CouponID
+	booking.CouponCode = quote.CouponCode
+	booking.DiscountAmount = quote.Discount
+	booking.PaymentLinkID = ""
+	booking.Channel = models.BookingChannelOnline
+	holdExpiresAt := now.Add(GetBookingHoldTTL())
+	booking.HoldExpiresAt = &holdExpiresAt
+
+	bookingNumber, ok := uniqueBookingNumber(c)
+	if !ok {
+		return
+	}
+	booking.BookingNumber = bookingNumber
+
+	booking, err = models.CreateBooking(booking)
+	if respondCreateBookingError(c, err) {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"booking": booking,
+		"quote":   quote,
+	})
+}
+
+// uniqueBookingNumber generates a booking number no booking uses yet. It
+// responds and returns false if none was found after several attempts.
+func uniqueBookingNumber(c *gin.Context) (string, bool) {
+	return uniqueBatchBookingNumber(c, nil)
+}
+
+// uniqueBatchBookingNumber is uniqueBookingNumber for bookings created
+// together: the numbers in taken are given to bookings of the batch that are
+// not saved yet. Booking numbers only have 1296 random values per second, so
+// a large batch draws the same number more than once.
+func uniqueBatchBookingNumber(c *gin.Context, taken map[string]bool) (string, bool) {
+	maxRetries := 20
 	for i := 0; i < maxRetries; i++ {
-		booking.BookingNumber = helper.GenerateBookingNumber()
+		bookingNumber := helper.GenerateBookingNumber()
+		if taken[bookingNumber] {
+			continue
+		}
 
-		// Check if UserID already exists
+		// Check if the booking number already exists
 		var existingBooking models.Booking
-		err := config.DB.Where("booking_number = ?", booking.BookingNumber).First(&existingBooking).Error
+		err := config.DB.Where("booking_number = ?", bookingNumber).First(&existingBooking).Error
 
 		if err != nil {
-			// UserID doesn't exist, we can use it
-			break
-		}
-
-		// If we've tried maxRetries times, return an error
-		if i == maxRetries-1 {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate unique user ID after multiple attempts"})
-			return
+			// Booking number doesn't exist, we can use it
+			return bookingNumber, true
 		}
 	}
 
-	booking, err := models.CreateBooking(booking)
-	if err != nil {
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate unique booking number after multiple attempts"})
+	return "", false
+}
+
+// respondCreateBookingError responds with why a booking could not be created
+// and reports whether err was set
+func respondCreateBookingError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, models.ErrSoldOut):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough tickets available"})
+	case errors.Is(err, models.ErrPriceChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": "The ticket price has just changed, please review it and book again"})
+	case errors.Is(err, models.ErrCouponUsedUp) || errors.Is(err, models.ErrCouponUserLimit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": couponErrorMessage(err)})
+	case errors.As(err, new(*models.PurchaseLimitError)):
+		respondPurchaseLimitError(c, err)
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create booking"})
+	}
+	return true
+}
+
+// respondPurchaseLimitError explains which purchase limit a booking went over
+// and how many tickets the customer can still book. A booking that is too
+// large is 422; going over what one account may hold in total is 409.
+func respondPurchaseLimitError(c *gin.Context, err error) {
+	var limitErr *models.PurchaseLimitError
+	if !errors.As(err, &limitErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check purchase limits"})
 		return
 	}
 
-	c.JSON(200, gin.H{
-		"booking": booking,
+	status := http.StatusConflict
+	var message string
+	switch limitErr.Scope {
+	case models.PurchaseLimitBooking:
+		status = http.StatusUnprocessableEntity
+		message = fmt.Sprintf("You can book at most %d tickets in one booking", limitErr.Limit)
+	case models.PurchaseLimitTicket:
+		message = fmt.Sprintf("You can book at most %d tickets of this type", limitErr.Limit)
+	default:
+		message = fmt.Sprintf("You can book at most %d tickets for this event", limitErr.Limit)
+	}
+	if limitErr.Scope != models.PurchaseLimitBooking {
+		if limitErr.Remaining == 0 {
+			message += " and have already reached that limit"
+		} else {
+			message += fmt.Sprintf(", you can book %d more", limitErr.Remaining)
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"error":     message,
+		"limit":     limitErr.Limit,
+		"remaining": limitErr.Remaining,
+		"scope":     limitErr.Scope,
 	})
 }
 
+// priceBooking quotes a booking of ticketCount tickets the way CreateBooking
+// charges it. It responds with the reason and returns false when the booking
+// cannot be made: the ticket is not on sale, the booking is larger than the
+// ticket allows, or the referral or coupon code is not valid for it.
+func priceBooking(c *gin.Context, ticket models.Ticket, ticketCount int, referralCode, couponCode string, now time.Time) (models.PriceQuote, bool) {
+	if err := ticket.SaleError(now); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        saleErrorMessage(err),
+			"saleStartsAt": ticket.SaleStartsAt,
+			"saleEndsAt":   ticket.SaleEndsAt,
+		})
+		return models.PriceQuote{}, false
+	}
+	if err := ticket.CheckBookingSize(ticketCount); err != nil {
+		respondPurchaseLimitError(c, err)
+		return models.PriceQuote{}, false
+	}
+
+	hasReferral := false
+	if referralCode != "" {
+		if _, err := models.GetReferralByCode(referralCode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral code"})
+			return models.PriceQuote{}, false
+		}
+		hasReferral = true
+	}
+
+	var coupon *models.Coupon
+	if couponCode != "" {
+		found, err := findUsableCoupon(couponCode, ticket.ID, ticketCount, c.GetString("firebaseId"), now)
+		if err != nil {
+			respondCouponError(c, err)
+			return models.PriceQuote{}, false
+		}
+		coupon = &found
+	}
+
+	groupOffers, err := models.GetGroupOfferRulesForTicket(ticket)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group offers"})
+		return models.PriceQuote{}, false
+	}
+
+	tier := ticket.ActivePriceTier(now, ticketCount)
+	quote, err := models.QuoteBookingPrice(ticket, tier, groupOffers, ticketCount, hasReferral, hasVerifiedYouTubeSubscription(c), coupon)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.PriceQuote{}, false
+	}
+
+	return quote, true
+}
+
+// UpdateBookingRequest lists the booking fields a customer may change. Price,
+// tickets and status are owned by the server and never taken from the client.
+type UpdateBookingRequest struct {
+	PaymentMethod string `json:"paymentMethod" binding:"required"`
+}
+
 func UpdateBooking(c *gin.Context) {
 	bookingNumber := c.Param("bookingNumber")
 
 	booking, err := models.GetBookingByBookingNumber(bookingNumber)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&booking); err != nil {
+	var req UpdateBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
+	booking.PaymentMethod = req.PaymentMethod
+
 	booking, err = models.UpdateBooking(booking)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
@@ -235,6 +418,22 @@ func DeleteBooking(c *gin.Context) {
 		return
 	}
 
+	booking, err := models.GetBookingByID(bookingID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+
+	// Paid bookings keep their record; they go through cancellation and refund
+	switch booking.Status {
+	case models.BookingStatusPaid, models.BookingStatusCheckedIn, models.BookingStatusCancelled, models.BookingStatusRefunded:
+		c.JSON(http.StatusConflict, gin.H{"error": "Paid bookings cannot be deleted, cancel and refund them instead"})
+		return
+	}
+
 	err = models.DeleteBooking(bookingID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete booking"})
@@ -274,7 +473,10 @@ func CheckPayment(c *gin.Context) {
 
 	booking, err := models.GetBookingByBookingNumber(bookingNumber)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionRead) {
 		return
 	}
 
@@ -287,3 +489,23 @@ func CheckPayment(c *gin.Context) {
 		"status": "success",
 	})
 }
+
+// GetBookingStatusHistory returns the audit trail of a booking's status changes
+func GetBookingStatusHistory(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	history, err := models.GetBookingStatusHistory(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking history"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":  booking.Status,
+		"history": history,
+	})
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+type BoxOfficeBookingRequest struct {
+	TicketID        uint    `json:"ticketId" binding:"required"`
+	TicketCount     int     `json:"ticketCount" binding:"required"`
+	PaymentMethod   string  `json:"paymentMethod" binding:"required"`
+	ReceiptNumber   string  `json:"receiptNumber" binding:"required"`
+	AmountCollected float64 `json:"amountCollected"`
+	CustomerName    string  `json:"customerName" binding:"required"`
+	CustomerEmail   string  `json:"customerEmail"`
+	CustomerMobile  string  `json:"customerMobile"`
+	ReferralID      string  `json:"referralId"`
+}
+
+// validateBoxOfficeBooking returns why a counter sale request is invalid, or
+// an empty string
+func validateBoxOfficeBooking(req BoxOfficeBookingRequest) string {
+	if req.TicketCount < 1 {
+		return models.ErrInvalidTicketCount.Error()
+	}
+	if !slices.Contains(models.BoxOfficePaymentMethods, req.PaymentMethod) {
+		return "Payment method must be one of " + strings.Join(models.BoxOfficePaymentMethods, ", ")
+	}
+	if strings.TrimSpace(req.ReceiptNumber) == "" {
+		return "Receipt number is required"
+	}
+	if strings.TrimSpace(req.CustomerName) == "" {
+		return "Customer name is required"
+	}
+	if req.CustomerEmail != "" && !strings.Contains(req.CustomerEmail, "@") {
+		return "Invalid customer email address"
+	}
+	if req.AmountCollected < 0 {
+		return "Amount collected cannot be negative"
+	}
+	return ""
+}
+
+// CreateBoxOfficeBooking sells tickets to a walk-in customer who pays at the
+// counter. The booking is paid straight away and the passes are emailed to
+// the customer when they give an email address. It belongs to the customer's
+// account if one uses that email, otherwise to the operator.
+func CreateBoxOfficeBooking(c *gin.Context) {
+	var req BoxOfficeBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if message := validateBoxOfficeBooking(req); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	ticket, err := models.GetTicketByID(req.TicketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	now := time.Now()
+	quote, ok := priceBooking(c, ticket, req.TicketCount, req.ReferralID, "", now)
+	if !ok {
+		return
+	}
+
+	// The counter must collect exactly what the booking costs
+	if math.Abs(req.AmountCollected-quote.Total) > 0.005 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": fmt.Sprintf("Amount collected does not match the booking total of %.2f", quote.Total),
+			"quote": quote,
+		})
+		return
+	}
+
+	operatorID := c.GetString("firebaseId")
+	customerEmail := models.NormalizeEmail(req.CustomerEmail)
+	userID := operatorID
+	if customerEmail != "" {
+		if customer, err := models.GetUserByEmail(customerEmail); err == nil {
+			userID = customer.FirebaseID
+		}
+	}
+
+	booking := models.Booking{
+		UserID:       userID,
+		ReferralID:   req.ReferralID,
+		TicketID:     ticket.ID,
+		TicketCount:  req.TicketCount,
+		PaymentPrice: quote.Total,
+		FreeTickets:  quote.FreeTickets,
+		PaidTickets:  quote.PaidTickets,
+		UnitPrice:    quote.UnitPrice,
+		PriceTierID:  quote.PriceTierID,
+	}
+
+	bookingNumber, ok := uniqueBookingNumber(c)
+	if !ok {
+		return
+	}
+	booking.BookingNumber = bookingNumber
+
+	booking, sale, err := models.CreateBoxOfficeSale(booking, models.BoxOfficeSale{
+		OperatorID:      operatorID,
+		ReceiptNumber:   strings.TrimSpace(req.ReceiptNumber),
+		PaymentMethod:   req.PaymentMethod,
+		AmountCollected: req.AmountCollected,
+		CustomerName:    strings.TrimSpace(req.CustomerName),
+		CustomerEmail:   customerEmail,
+		CustomerMobile:  strings.TrimSpace(req.CustomerMobile),
+	})
+	if errors.Is(err, models.ErrDuplicateReceipt) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This receipt number has already been recorded"})
+		return
+	}
+	if respondCreateBookingError(c, err) {
+		return
+	}
+
+	if sale.CustomerEmail != "" {
+		go sendBoxOfficeConfirmationEmail(booking.BookingNumber, sale)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Booking paid at the box office",
+		"booking": booking,
+		"sale":    sale,
+		"quote":   quote,
+	})
+}
+
+// sendBoxOfficeConfirmationEmail sends the usual confirmation email to the
+// walk-in customer rather than the booking's owner, who may be the operator
+func sendBoxOfficeConfirmationEmail(bookingNumber string, sale models.BoxOfficeSale) {
+	booking, err := models.GetBookingWithEmailData(bookingNumber)
+	if err != nil {
+		fmt.Printf("Failed to get booking data for %s: %v\n", bookingNumber, err)
+		return
+	}
+
+	booking.User.Email = sale.CustomerEmail
+	booking.User.FullName = sale.CustomerName
+	emailBookingConfirmation(booking)
+}
+
+// sendBoxOfficeCancellationEmail tells the walk-in customer, rather than the
+// booking's owner, that their booking was cancelled and refunded
+func sendBoxOfficeCancellationEmail(booking models.Booking, refundAmount float64) {
+	sale, err := models.GetBoxOfficeSaleByBookingID(booking.ID)
+	if err != nil {
+		fmt.Printf("Failed to get box office sale for %s: %v\n", booking.BookingNumber, err)
+		return
+	}
+	if sale.CustomerEmail == "" {
+		return
+	}
+
+	booking.User.Email = sale.CustomerEmail
+	booking.User.FullName = sale.CustomerName
+	sendBookingCancellationEmail(booking, refundAmount)
+}
+
+// GetBoxOfficeReport totals the counter sales and refunds of one day
+// (?date=YYYY-MM-DD in the event timezone, default today) per operator and
+// payment method, with the sales themselves. Operators only see their own
+// sales; admins see everyone's or one operator's with ?operatorId.
+func GetBoxOfficeReport(c *gin.Context) {
+	location := eventLocation()
+
+	day := time.Now().In(location)
+	if date := c.Query("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+		day = parsed
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+	to := from.AddDate(0, 0, 1)
+
+	operatorID := c.Query("operatorId")
+	if requestRole(c) != "admin" {
+		operatorID = c.GetString("firebaseId")
+	}
+
+	totals, err := models.GetBoxOfficeTotals(from, to, operatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get box office totals"})
+		return
+	}
+
+	sales, err := models.GetBoxOfficeSales(from, to, operatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get box office sales"})
+		return
+	}
+
+	var amount, refunded float64
+	var tickets int64
+	for _, total := range totals {
+		amount += total.Amount
+		refunded += total.Refunded
+		tickets += total.Tickets
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"date":     from.Format("2006-01-02"),
+		"totals":   totals,
+		"amount":   amount,
+		"refunded": refunded,
+		"net":      amount - refunded,
+		"tickets":  tickets,
+		"sales":    sales,
+	})
+}
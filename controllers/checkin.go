@@ -0,0 +1,431 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// CheckInScanRequest is a pass scanned at a gate of the event given by
+// EventID; passes for other events are refused
+type CheckInScanRequest struct {
+	EventID uint   `json:"eventId" binding:"required"`
+	Code    string `json:"code" binding:"required"`
+	Gate    string `json:"gate" binding:"required"`
+}
+
+type GroupCheckInRequest struct {
+	EventID uint   `json:"eventId" binding:"required"`
+	Code    string `json:"code" binding:"required"`
+	Gate    string `json:"gate" binding:"required"`
+	// Count is how many people of the group are entering now, including the
+	// holder of the scanned pass
+	Count int `json:"count" binding:"required,min=1"`
+}
+
+// ValidateCheckIn reports whether a scanned code would be admitted, without
+// checking it in
+func ValidateCheckIn(c *gin.Context) {
+	var req struct {
+		EventID uint   `json:"eventId" binding:"required"`
+		Code    string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	passCode, err := resolvePassCode(req.Code)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "reason": "Invalid ticket code"})
+		return
+	}
+
+	pass, err := models.GetPassByCode(passCode)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "reason": "Unknown ticket"})
+		return
+	}
+
+	atEvent, err := models.TicketAtEvent(pass.Booking.TicketID, req.EventID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate ticket"})
+		return
+	}
+	if !atEvent {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "reason": "Ticket is for another event"})
+		return
+	}
+
+	progress, _ := models.GetCheckInProgress(pass.BookingID)
+	response := gin.H{
+		"valid":    true,
+		"pass":     pass,
+		"progress": progress,
+	}
+
+	switch {
+	case pass.Status == models.PassStatusCheckedIn:
+		response["valid"] = false
+		response["reason"] = alreadyUsedMessage(pass)
+	case pass.Status == models.PassStatusVoid:
+		response["valid"] = false
+		response["reason"] = "Ticket has been cancelled"
+	case pass.Booking.Status != models.BookingStatusPaid && pass.Booking.Status != models.BookingStatusCheckedIn:
+		response["valid"] = false
+		response["reason"] = "Booking is not paid"
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckIn admits the holder of a scanned pass at a gate
+func CheckIn(c *gin.Context) {
+	var req CheckInScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	scan := models.CheckInRequest{
+		EventID:    req.EventID,
+		Code:       req.Code,
+		Gate:       req.Gate,
+		OperatorID: c.GetString("firebaseId"),
+		ScannedAt:  time.Now(),
+	}
+
+	passCode, err := resolvePassCode(req.Code)
+	if err != nil {
+		if err := models.LogRejectedScan(scan); err != nil {
+			fmt.Printf("Failed to log rejected scan: %v\n", err)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid ticket code"})
+		return
+	}
+
+	scan.Code = passCode
+	pass, err := models.CheckInPass(scan)
+	if err != nil {
+		respondCheckInError(c, pass, err)
+		return
+	}
+
+	progress, _ := models.GetCheckInProgress(pass.BookingID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Checked in",
+		"pass":     pass,
+		"progress": progress,
+	})
+}
+
+// CheckInGroup admits several people of a group booking from one scanned
+// pass. The scanned pass must be unused; it is used first, then the booking's
+// other unused passes in seat order. The whole group is admitted together or
+// not at all, and the rest of the booking can enter later.
+func CheckInGroup(c *gin.Context) {
+	var req GroupCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	scan := models.CheckInRequest{
+		EventID:    req.EventID,
+		Code:       req.Code,
+		Gate:       req.Gate,
+		OperatorID: c.GetString("firebaseId"),
+		ScannedAt:  time.Now(),
+	}
+
+	passCode, err := resolvePassCode(req.Code)
+	if err != nil {
+		if err := models.LogRejectedScan(scan); err != nil {
+			fmt.Printf("Failed to log rejected scan: %v\n", err)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid ticket code"})
+		return
+	}
+
+	scan.Code = passCode
+	result, err := models.CheckInGroup(scan, req.Count)
+	if errors.Is(err, models.ErrNotEnoughPasses) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     fmt.Sprintf("Only %d unused passes left on this booking", result.Remaining),
+			"remaining": result.Remaining,
+		})
+		return
+	}
+	if err != nil {
+		respondCheckInError(c, result.Scanned, err)
+		return
+	}
+
+	progress, _ := models.GetCheckInProgress(result.Scanned.BookingID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("Checked in %d of %d", progress.CheckedIn, progress.Total),
+		"passes":   result.Passes,
+		"progress": progress,
+	})
+}
+
+type CheckInSyncRecord struct {
+	// ClientRef is the device's own ID for the record, used to skip records
+	// that were already uploaded
+	ClientRef string    `json:"clientRef" binding:"required"`
+	Code      string    `json:"code" binding:"required"`
+	Gate      string    `json:"gate" binding:"required"`
+	ScannedAt time.Time `json:"scannedAt" binding:"required"`
+}
+
+// CheckInSyncRequest is a batch of scans a device recorded offline at the
+// gates of the event given by EventID
+type CheckInSyncRequest struct {
+	EventID  uint                `json:"eventId" binding:"required"`
+	DeviceID string              `json:"deviceId" binding:"required"`
+	Records  []CheckInSyncRecord `json:"records" binding:"required,dive"`
+}
+
+type CheckInSyncResult struct {
+	ClientRef string       `json:"clientRef"`
+	Result    string       `json:"result"`
+	Message   string       `json:"message,omitempty"`
+	Pass      *models.Pass `json:"pass,omitempty"`
+}
+
+// GetCheckInManifest exports the passes scanner devices should admit at the
+// event given by ?eventId while offline. The ETag changes whenever a pass is
+// issued, voided or checked in, so devices can poll cheaply with
+// If-None-Match.
+func GetCheckInManifest(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Query("eventId"), 10, 64)
+	if err != nil || eventID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	entries, err := models.GetCheckInManifest(uint(eventID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build manifest"})
+		return
+	}
+
+	raw, err := json.Marshal(entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build manifest"})
+		return
+	}
+	sum := sha256.Sum256(raw)
+	version := hex.EncodeToString(sum[:8])
+	etag := `"` + version + `"`
+
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":     version,
+		"generatedAt": time.Now(),
+		"passes":      entries,
+	})
+}
+
+// SyncCheckIns merges check-ins recorded by a scanner device while it was
+// offline. Records are applied in scan order and the earliest scan of a pass
+// wins; later scans of the same pass come back as duplicates, with the
+// winning gate and time, for the device to show or report.
+func SyncCheckIns(c *gin.Context) {
+	var req CheckInSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	records := append([]CheckInSyncRecord{}, req.Records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ScannedAt.Before(records[j].ScannedAt)
+	})
+
+	now := time.Now()
+	results := []CheckInSyncResult{}
+	summary := map[string]int{}
+	for _, record := range records {
+		result := syncCheckIn(c.GetString("firebaseId"), req.EventID, req.DeviceID, record, now)
+		summary[result.Result]++
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"summary": summary,
+	})
+}
+
+func syncCheckIn(operatorID string, eventID uint, deviceID string, record CheckInSyncRecord, now time.Time) CheckInSyncResult {
+	result := CheckInSyncResult{ClientRef: record.ClientRef}
+
+	// A retried upload gets the outcome of the first one
+	if synced, ok := syncedCheckIn(deviceID, record.ClientRef); ok {
+		return synced
+	}
+
+	// Device clocks drift; a scan cannot have happened in the future
+	scannedAt := record.ScannedAt
+	if scannedAt.After(now) {
+		scannedAt = now
+	}
+
+	scan := models.CheckInRequest{
+		EventID:    eventID,
+		Code:       record.Code,
+		Gate:       record.Gate,
+		OperatorID: operatorID,
+		ScannedAt:  scannedAt,
+		Source:     "offline",
+		DeviceID:   deviceID,
+		ClientRef:  record.ClientRef,
+	}
+
+	passCode, err := resolvePassCode(record.Code)
+	if err != nil {
+		if err := models.LogRejectedScan(scan); errors.Is(err, models.ErrCheckInSynced) {
+			if synced, ok := syncedCheckIn(deviceID, record.ClientRef); ok {
+				return synced
+			}
+		} else if err != nil {
+			fmt.Printf("Failed to log rejected scan: %v\n", err)
+		}
+		result.Result = models.CheckInResultRejected
+		result.Message = "Invalid ticket code"
+		return result
+	}
+
+	scan.Code = passCode
+	pass, err := models.CheckInPass(scan)
+	if pass.ID != 0 && !errors.Is(err, models.ErrPassWrongEvent) {
+		result.Pass = &pass
+	}
+
+	switch {
+	case err == nil:
+		result.Result = models.CheckInResultAccepted
+	case errors.Is(err, models.ErrCheckInSynced):
+		// The same upload was merged concurrently
+		if synced, ok := syncedCheckIn(deviceID, record.ClientRef); ok {
+			return synced
+		}
+		result.Result = "error"
+		result.Message = "Failed to check in, retry the upload"
+	case errors.Is(err, models.ErrPassAlreadyUsed):
+		result.Result = models.CheckInResultDuplicate
+		result.Message = alreadyUsedMessage(pass)
+	case errors.Is(err, models.ErrPassVoid):
+		result.Result = models.CheckInResultVoid
+		result.Message = "Ticket has been cancelled"
+	case errors.Is(err, models.ErrPassNotFound):
+		result.Result = models.CheckInResultRejected
+		result.Message = "Unknown ticket"
+	case errors.Is(err, models.ErrBookingNotAdmissible):
+		result.Result = models.CheckInResultRejected
+		result.Message = "Booking is not paid"
+	case errors.Is(err, models.ErrPassWrongEvent):
+		result.Result = models.CheckInResultRejected
+		result.Message = "Ticket is for another event"
+	default:
+		result.Result = "error"
+		result.Message = "Failed to check in, retry the upload"
+	}
+
+	return result
+}
+
+// syncedCheckIn returns the outcome recorded for a device record that was
+// already uploaded
+func syncedCheckIn(deviceID, clientRef string) (CheckInSyncResult, bool) {
+	existing, err := models.GetCheckInByClientRef(deviceID, clientRef)
+	if err != nil {
+		return CheckInSyncResult{}, false
+	}
+	return CheckInSyncResult{
+		ClientRef: clientRef,
+		Result:    existing.Result,
+		Message:   "Already synced",
+	}, true
+}
+
+// resolvePassCode turns a scanned value into a pass code. Signed QR tokens
+// are verified; a bare pass code is accepted for manual entry since pass
+// codes are random and cannot be guessed the way booking numbers can.
+func resolvePassCode(scanned string) (string, error) {
+	scanned = strings.TrimSpace(scanned)
+
+	if strings.HasPrefix(scanned, helper.TicketTokenPrefix+".") {
+		claims, err := config.TicketKeys.Verify(scanned)
+		if err != nil {
+			return "", err
+		}
+		return claims.PassCode, nil
+	}
+
+	if strings.HasPrefix(scanned, "PS-") {
+		return scanned, nil
+	}
+
+	return "", helper.ErrTicketTokenMalformed
+}
+
+func respondCheckInError(c *gin.Context, pass models.Pass, err error) {
+	switch {
+	case errors.Is(err, models.ErrPassNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown ticket"})
+	case errors.Is(err, models.ErrPassAlreadyUsed):
+		c.JSON(http.StatusConflict, gin.H{"error": alreadyUsedMessage(pass), "pass": pass})
+	case errors.Is(err, models.ErrPassVoid):
+		c.JSON(http.StatusGone, gin.H{"error": "Ticket has been cancelled", "pass": pass})
+	case errors.Is(err, models.ErrBookingNotAdmissible):
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking is not paid", "pass": pass})
+	case errors.Is(err, models.ErrPassWrongEvent):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Ticket is for another event"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+	}
+}
+
+// alreadyUsedMessage tells the gate operator where and when a pass was used,
+// e.g. "Already used at 17:42 Gate 2"
+func alreadyUsedMessage(pass models.Pass) string {
+	if pass.CheckedInAt == nil {
+		return "Already used"
+	}
+
+	return fmt.Sprintf("Already used at %s %s", pass.CheckedInAt.In(eventLocation()).Format("15:04"), pass.CheckedInGate)
+}
+
+// eventLocation is the time zone times are shown in at the venue,
+// EVENT_TIMEZONE or India Standard Time by default
+func eventLocation() *time.Location {
+	name := os.Getenv("EVENT_TIMEZONE")
+	if name == "" {
+		name = "Asia/Kolkata"
+	}
+
+	if location, err := time.LoadLocation(name); err == nil {
+		return location
+	}
+	return time.FixedZone("IST", 5*60*60+30*60)
+}
@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// maxCompBatch caps how many guests one bulk issuance may list
+const maxCompBatch = 500
+
+// GetCompCategories lists complimentary categories with how many tickets each
+// has issued, optionally only those of the event given by ?eventId
+func GetCompCategories(c *gin.Context) {
+	var eventID uint64
+	if value := c.Query("eventId"); value != "" {
+		var err error
+		if eventID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+			return
+		}
+	}
+
+	categories, err := models.GetCompCategories(uint(eventID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get complimentary categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"categories": categories,
+	})
+}
+
+func CreateCompCategory(c *gin.Context) {
+	var category models.CompCategory
+
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	category.ID = 0
+	category.Name = strings.TrimSpace(category.Name)
+	if msg := validateCompCategory(category); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if _, err := models.GetEventByID(category.EventID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	createdCategory, err := models.CreateCompCategory(category)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create complimentary category: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"message":  "Complimentary category created successfully",
+		"category": createdCategory,
+	})
+}
+
+// UpdateCompCategoryRequest lists the category fields that can change;
+// omitted fields keep their value. A category cannot move to another event.
+type UpdateCompCategoryRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Quota       *int    `json:"quota"`
+}
+
+// UpdateCompCategory changes a category. Lowering the quota below what was
+// already issued only stops further tickets; issued ones are kept.
+func UpdateCompCategory(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid complimentary category ID"})
+		return
+	}
+
+	category, err := models.GetCompCategoryByID(uint(categoryID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Complimentary category not found"})
+		return
+	}
+
+	var req UpdateCompCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		category.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		category.Description = *req.Description
+	}
+	if req.Quota != nil {
+		category.Quota = *req.Quota
+	}
+
+	if msg := validateCompCategory(category); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	category, err = models.UpdateCompCategory(category)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update complimentary category: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Complimentary category updated successfully",
+		"category": category,
+	})
+}
+
+// DeleteCompCategory removes a category that has not issued any tickets
+func DeleteCompCategory(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid complimentary category ID"})
+		return
+	}
+
+	if _, err := models.GetCompCategoryByID(uint(categoryID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Complimentary category not found"})
+		return
+	}
+
+	err = models.DeleteCompCategory(uint(categoryID))
+	if errors.Is(err, models.ErrCompCategoryInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Complimentary category has issued tickets and cannot be deleted"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete complimentary category: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Complimentary category deleted successfully",
+	})
+}
+
+// validateCompCategory returns the reason a category cannot be saved, or "" when it is valid
+func validateCompCategory(category models.CompCategory) string {
+	if category.EventID == 0 {
+		return "Complimentary category needs an eventId"
+	}
+	if category.Name == "" {
+		return "Complimentary category name is required"
+	}
+	if category.Quota < 0 {
+		return "Quota cannot be negative"
+	}
+	return ""
+}
+
+type CompGuest struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	TicketCount int    `json:"ticketCount"`
+}
+
+type IssueComplimentaryRequest struct {
+	CategoryID uint        `json:"categoryId" binding:"required"`
+	TicketID   uint        `json:"ticketId" binding:"required"`
+	Reason     string      `json:"reason"`
+	Guests     []CompGuest `json:"guests" binding:"required"`
+}
+
+// validateCompGuests returns why a guest list cannot be issued, or "".
+// Guests without a ticket count get one ticket.
+func validateCompGuests(guests []CompGuest) string {
+	if len(guests) == 0 {
+		return "At least one guest is required"
+	}
+	if len(guests) > maxCompBatch {
+		return fmt.Sprintf("At most %d guests can be issued at once", maxCompBatch)
+	}
+
+	for i := range guests {
+		guests[i].Name = strings.TrimSpace(guests[i].Name)
+		guests[i].Email = models.NormalizeEmail(guests[i].Email)
+		if guests[i].TicketCount == 0 {
+			guests[i].TicketCount = 1
+		}
+
+		if guests[i].Name == "" {
+			return fmt.Sprintf("Guest %d needs a name", i+1)
+		}
+		if guests[i].Email != "" && !strings.Contains(guests[i].Email, "@") {
+			return fmt.Sprintf("Guest %d has an invalid email address", i+1)
+		}
+		if guests[i].TicketCount < 1 {
+			return fmt.Sprintf("Guest %d: %s", i+1, models.ErrInvalidTicketCount.Error())
+		}
+	}
+	return ""
+}
+
+// IssueComplimentaryTickets gives free tickets to a list of guests in one
+// category, one booking per guest. The bookings are paid straight away, take
+// seats like any other and count towards attendance but not revenue. Guests
+// with an email get their passes by email; the booking belongs to the
+// account using that email, or to the issuing admin. The whole list is issued
+// or, when it does not fit the quota or the seats left, none of it.
+func IssueComplimentaryTickets(c *gin.Context) {
+	var req IssueComplimentaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if msg := validateCompGuests(req.Guests); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	category, err := models.GetCompCategoryByID(req.CategoryID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Complimentary category not found"})
+		return
+	}
+
+	ticket, err := models.GetTicketByID(req.TicketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if ticket.EventID == nil || *ticket.EventID != category.EventID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket is not for the category's event"})
+		return
+	}
+
+	adminID := c.GetString("firebaseId")
+	bookingNumbers := make(map[string]bool, len(req.Guests))
+	bookings := make([]models.Booking, 0, len(req.Guests))
+	comps := make([]models.ComplimentaryTicket, 0, len(req.Guests))
+	for _, guest := range req.Guests {
+		userID := adminID
+		if guest.Email != "" {
+			if user, err := models.GetUserByEmail(guest.Email); err == nil {
+				userID = user.FirebaseID
+			}
+		}
+
+		bookingNumber, ok := uniqueBatchBookingNumber(c, bookingNumbers)
+		if !ok {
+			return
+		}
+		bookingNumbers[bookingNumber] = true
+
+		bookings = append(bookings, models.Booking{
+			BookingNumber: bookingNumber,
+			UserID:        userID,
+			TicketID:      ticket.ID,
+			TicketCount:   guest.TicketCount,
+		})
+		comps = append(comps, models.ComplimentaryTicket{
+			Reason:     strings.TrimSpace(req.Reason),
+			GuestName:  guest.Name,
+			GuestEmail: guest.Email,
+			IssuedBy:   adminID,
+		})
+	}
+
+	comps, err = models.IssueComplimentaryTickets(category.ID, bookings, comps)
+	if errors.Is(err, models.ErrCompQuotaExceeded) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     fmt.Sprintf("%s can give out at most %d tickets", category.Name, category.Quota),
+			"quota":     category.Quota,
+			"issued":    category.Issued,
+			"remaining": max(category.Quota-category.Issued, 0),
+		})
+		return
+	}
+	if errors.Is(err, models.ErrSoldOut) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough tickets available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue complimentary tickets"})
+		return
+	}
+
+	for _, comp := range comps {
+		if comp.GuestEmail != "" {
+			go sendComplimentaryEmail(comp)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("Issued complimentary tickets to %d guests", len(comps)),
+		"tickets": comps,
+	})
+}
+
+// sendComplimentaryEmail sends the usual confirmation email with the passes to
+// the guest rather than the booking's owner, who may be the issuing admin
+func sendComplimentaryEmail(comp models.ComplimentaryTicket) {
+	booking, err := models.GetBookingWithEmailData(comp.Booking.BookingNumber)
+	if err != nil {
+		fmt.Printf("Failed to get booking data for %s: %v\n", comp.Booking.BookingNumber, err)
+		return
+	}
+
+	booking.User.Email = comp.GuestEmail
+	booking.User.FullName = comp.GuestName
+	emailBookingConfirmation(booking)
+}
+
+// GetComplimentaryTickets lists issued complimentary tickets, optionally only
+// those of the category given by ?categoryId
+func GetComplimentaryTickets(c *gin.Context) {
+	var categoryID uint64
+	if value := c.Query("categoryId"); value != "" {
+		var err error
+		if categoryID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid complimentary category ID"})
+			return
+		}
+	}
+
+	comps, err := models.GetComplimentaryTickets(uint(categoryID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get complimentary tickets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"tickets": comps,
+	})
+}
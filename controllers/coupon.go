@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+type ValidateCouponRequest struct {
+	Code        string `json:"code" binding:"required"`
+	TicketID    uint   `json:"ticketId" binding:"required"`
+	TicketCount int    `json:"ticketCount" binding:"required"`
+	ReferralID  string `json:"referralId"`
+}
+
+// ValidateCoupon checks a promo code against the booking the customer is
+// about to make and returns the price they would pay with it
+func ValidateCoupon(c *gin.Context) {
+	var req ValidateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ticket, err := models.GetTicketByID(req.TicketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	quote, ok := priceBooking(c, ticket, req.TicketCount, req.ReferralID, req.Code, time.Now())
+	if !ok {
+		return
+	}
+
+	message := "Coupon applied"
+	if quote.CouponCode == "" {
+		message = "Your referral offer is a better deal than this coupon"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":   quote.CouponCode != "",
+		"message": message,
+		"quote":   quote,
+	})
+}
+
+// findUsableCoupon looks up a coupon and checks it can be used on the booking
+func findUsableCoupon(code string, ticketID uint, ticketCount int, userID string, now time.Time) (models.Coupon, error) {
+	coupon, err := models.GetCouponByCode(code)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	if err := coupon.CheckApplicable(ticketID, ticketCount, now); err != nil {
+		return models.Coupon{}, err
+	}
+	if err := models.CheckCouponUsage(coupon, userID); err != nil {
+		return models.Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func respondCouponError(c *gin.Context, err error) {
+	message := couponErrorMessage(err)
+	if message == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check coupon"})
+		return
+	}
+
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": message, "valid": false})
+}
+
+// couponErrorMessage explains to the customer why a coupon was refused, or
+// returns "" for errors that are not about the coupon
+func couponErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, models.ErrCouponNotFound), errors.Is(err, models.ErrCouponInactive):
+		return "Invalid coupon code"
+	case errors.Is(err, models.ErrCouponNotStarted):
+		return "This coupon is not valid yet"
+	case errors.Is(err, models.ErrCouponExpired):
+		return "This coupon has expired"
+	case errors.Is(err, models.ErrCouponNotApplicable):
+		return "This coupon cannot be used for this ticket"
+	case errors.Is(err, models.ErrCouponMinTickets):
+		return "Book more tickets to use this coupon"
+	case errors.Is(err, models.ErrCouponUsedUp):
+		return "This coupon has been fully redeemed"
+	case errors.Is(err, models.ErrCouponUserLimit):
+		return "You have already used this coupon"
+	}
+	return ""
+}
+
+func GetAllCoupons(c *gin.Context) {
+	coupons, err := models.GetAllCoupons()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"coupons": coupons,
+	})
+}
+
+// GetCoupon returns a coupon with how many times it is in use
+func GetCoupon(c *gin.Context) {
+	couponID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	coupon, err := models.GetCouponByID(uint(couponID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	usage, err := models.GetCouponUsage(coupon.ID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get coupon usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"coupon":  coupon,
+		"uses":    usage.Uses,
+	})
+}
+
+func CreateCoupon(c *gin.Context) {
+	var coupon models.Coupon
+
+	if err := c.ShouldBindBodyWithJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	coupon.ID = 0
+	coupon.Code = models.NormalizeCouponCode(coupon.Code)
+	// New coupons are live unless the request says otherwise
+	coupon.Active = true
+	var raw struct {
+		Active *bool `json:"active"`
+	}
+	if err := c.ShouldBindBodyWithJSON(&raw); err == nil && raw.Active != nil {
+		coupon.Active = *raw.Active
+	}
+
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if _, err := models.GetCouponByCode(coupon.Code); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	}
+
+	createdCoupon, err := models.CreateCoupon(coupon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create coupon: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Coupon created successfully",
+		"coupon":  createdCoupon,
+	})
+}
+
+// UpdateCouponRequest lists the coupon fields that can change; omitted fields
+// keep their value. The code cannot change once bookings may have used it.
+type UpdateCouponRequest struct {
+	Description        *string                    `json:"description"`
+	DiscountType       *models.CouponDiscountType `json:"discountType"`
+	DiscountValue      *float64                   `json:"discountValue"`
+	MaxDiscount        *float64                   `json:"maxDiscount"`
+	TicketIDs          []uint                     `json:"ticketIds"`
+	MaxUses            *int                       `json:"maxUses"`
+	MaxUsesPerUser     *int                       `json:"maxUsesPerUser"`
+	MinTickets         *int                       `json:"minTickets"`
+	ValidFrom          *time.Time                 `json:"validFrom"`
+	ValidUntil         *time.Time                 `json:"validUntil"`
+	StacksWithReferral *bool                      `json:"stacksWithReferral"`
+	Active             *bool                      `json:"active"`
+}
+
+func UpdateCoupon(c *gin.Context) {
+	couponID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	coupon, err := models.GetCouponByID(uint(couponID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	var req UpdateCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Description != nil {
+		coupon.Description = *req.Description
+	}
+	if req.DiscountType != nil {
+		coupon.DiscountType = *req.DiscountType
+	}
+	if req.DiscountValue != nil {
+		coupon.DiscountValue = *req.DiscountValue
+	}
+	if req.MaxDiscount != nil {
+		coupon.MaxDiscount = *req.MaxDiscount
+	}
+	if req.TicketIDs != nil {
+		coupon.TicketIDs = req.TicketIDs
+	}
+	if req.MaxUses != nil {
+		coupon.MaxUses = *req.MaxUses
+	}
+	if req.MaxUsesPerUser != nil {
+		coupon.MaxUsesPerUser = *req.MaxUsesPerUser
+	}
+	if req.MinTickets != nil {
+		coupon.MinTickets = *req.MinTickets
+	}
+	if req.ValidFrom != nil {
+		coupon.ValidFrom = req.ValidFrom
+	}
+	if req.ValidUntil != nil {
+		coupon.ValidUntil = req.ValidUntil
+	}
+	if req.StacksWithReferral != nil {
+		coupon.StacksWithReferral = *req.StacksWithReferral
+	}
+	if req.Active != nil {
+		coupon.Active = *req.Active
+	}
+
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	coupon, err = models.UpdateCoupon(coupon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update coupon: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Coupon updated successfully",
+		"coupon":  coupon,
+	})
+}
+
+// DeleteCoupon removes a coupon no booking has used; used coupons should be
+// deactivated instead so bookings keep pointing at them
+func DeleteCoupon(c *gin.Context) {
+	couponID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	if _, err := models.GetCouponByID(uint(couponID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	used, err := models.CouponHasBookings(uint(couponID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check coupon usage"})
+		return
+	}
+	if used {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon has been used; deactivate it instead"})
+		return
+	}
+
+	if err := models.DeleteCoupon(uint(couponID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete coupon: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Coupon deleted successfully",
+	})
+}
+
+// validateCoupon returns the reason a coupon cannot be saved, or "" when it is valid
+func validateCoupon(coupon models.Coupon) string {
+	if coupon.Code == "" {
+		return "Coupon code is required"
+	}
+	if !slices.Contains([]models.CouponDiscountType{models.CouponDiscountPercentage, models.CouponDiscountFlat}, coupon.DiscountType) {
+		return "Discount type must be percentage or flat"
+	}
+	if coupon.DiscountValue <= 0 {
+		return "Discount value must be greater than 0"
+	}
+	if coupon.DiscountType == models.CouponDiscountPercentage && coupon.DiscountValue > 100 {
+		return "Percentage discount cannot be more than 100"
+	}
+	if coupon.MaxDiscount < 0 || coupon.MaxUses < 0 || coupon.MaxUsesPerUser < 0 || coupon.MinTickets < 0 {
+		return "Coupon limits cannot be negative"
+	}
+	if coupon.ValidFrom != nil && coupon.ValidUntil != nil && !coupon.ValidUntil.After(*coupon.ValidFrom) {
+		return "Coupon end time must be after its start time"
+	}
+	return ""
+}
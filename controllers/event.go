@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// GetPublicEvents lists published events, upcoming ones only unless ?past=true
+func GetPublicEvents(c *gin.Context) {
+	events, err := models.GetPublicEvents(c.Query("past") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"events":  events,
+	})
+}
+
+// GetPublicEvent returns a published event with its tickets
+func GetPublicEvent(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := models.GetPublicEventByID(uint(eventID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// GetAllEvents lists every event, drafts included, for admins
+func GetAllEvents(c *gin.Context) {
+	events, err := models.GetAllEvents()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"events":  events,
+	})
+}
+
+func CreateEvent(c *gin.Context) {
+	var event models.Event
+
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	event.ID = 0
+	event.Tickets = nil
+	if event.Status == "" {
+		event.Status = models.EventStatusDraft
+	}
+	if event.Timezone == "" {
+		event.Timezone = models.DefaultEventTimezone
+	}
+	if event.Artists == nil {
+		event.Artists = make([]string, 0)
+	}
+
+	if msg := validateEvent(event); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	createdEvent, err := models.CreateEvent(event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create event: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Event created successfully",
+		"event":   createdEvent,
+	})
+}
+
+func UpdateEvent(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	existingEvent, err := models.GetEventByID(uint(eventID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	var updateData models.Event
+	if err := c.ShouldBindBodyWithJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// Update only the provided fields
+	if updateData.Name != "" {
+		existingEvent.Name = updateData.Name
+	}
+	if updateData.Description != "" {
+		existingEvent.Description = updateData.Description
+	}
+	if updateData.Venue != "" {
+		existingEvent.Venue = updateData.Venue
+	}
+	if updateData.Address != "" {
+		existingEvent.Address = updateData.Address
+	}
+	if !updateData.StartTime.IsZero() {
+		existingEvent.StartTime = updateData.StartTime
+	}
+	if updateData.EndTime != nil {
+		existingEvent.EndTime = updateData.EndTime
+	}
+	if updateData.Timezone != "" {
+		existingEvent.Timezone = updateData.Timezone
+	}
+	if updateData.Status != "" {
+		existingEvent.Status = updateData.Status
+	}
+	if updateData.BannerURL != "" {
+		existingEvent.BannerURL = updateData.BannerURL
+	}
+	if updateData.Artists != nil {
+		existingEvent.Artists = updateData.Artists
+	}
+	// The limit can be set back to 0 for no limit, so only a value present
+	// in the request changes it
+	var limit struct {
+		MaxTicketsPerUser *int `json:"maxTicketsPerUser"`
+	}
+	if err := c.ShouldBindBodyWithJSON(&limit); err == nil && limit.MaxTicketsPerUser != nil {
+		existingEvent.MaxTicketsPerUser = *limit.MaxTicketsPerUser
+	}
+
+	if msg := validateEvent(existingEvent); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	updatedEvent, err := models.UpdateEvent(existingEvent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Event updated successfully",
+		"event":   updatedEvent,
+	})
+}
+
+func DeleteEvent(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	if _, err := models.GetEventByID(uint(eventID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	err = models.DeleteEvent(uint(eventID))
+	if errors.Is(err, models.ErrEventHasTickets) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delete or move the event's tickets first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Event deleted successfully",
+	})
+}
+
+// validateEvent returns the reason an event cannot be saved, or "" when it is valid
+func validateEvent(event models.Event) string {
+	if event.Name == "" {
+		return "Event name is required"
+	}
+	if event.Venue == "" {
+		return "Event venue is required"
+	}
+	if event.StartTime.IsZero() {
+		return "Event start time is required"
+	}
+	if event.EndTime != nil && event.EndTime.Before(event.StartTime) {
+		return "Event end time cannot be before its start time"
+	}
+	if _, err := time.LoadLocation(event.Timezone); err != nil {
+		return "Invalid event timezone"
+	}
+	if !slices.Contains(models.EventStatuses, event.Status) {
+		return "Invalid event status"
+	}
+	if event.MaxTicketsPerUser < 0 {
+		return "Tickets per user cannot be negative"
+	}
+	return ""
+}
+
+// emailEventDetails describes a ticket's event for customer emails
+func emailEventDetails(ticket models.Ticket) helper.EventDetails {
+	if ticket.Event == nil {
+		return helper.EventDetails{Name: "Prince Group Vista", Date: "To be announced", Venue: "To be announced"}
+	}
+
+	return helper.EventDetails{
+		Name:    ticket.Event.Name,
+		Date:    ticket.Event.DisplayDate(),
+		Venue:   ticket.Event.DisplayVenue(),
+		Artists: ticket.Event.Artists,
+	}
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// GetGroupOfferRules lists group offer rules, optionally only those of the
+// ticket or event given by ?ticketId or ?eventId
+func GetGroupOfferRules(c *gin.Context) {
+	var ticketID, eventID uint64
+	var err error
+	if value := c.Query("ticketId"); value != "" {
+		if ticketID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+			return
+		}
+	}
+	if value := c.Query("eventId"); value != "" {
+		if eventID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+			return
+		}
+	}
+
+	rules, err := models.GetGroupOfferRules(uint(ticketID), uint(eventID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group offers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"groupOffers": rules,
+	})
+}
+
+func CreateGroupOfferRule(c *gin.Context) {
+	var rule models.GroupOfferRule
+
+	if err := c.ShouldBindBodyWithJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	rule.ID = 0
+	// New rules are live unless the request says otherwise
+	rule.Active = true
+	var raw struct {
+		Active *bool `json:"active"`
+	}
+	if err := c.ShouldBindBodyWithJSON(&raw); err == nil && raw.Active != nil {
+		rule.Active = *raw.Active
+	}
+
+	if msg := validateGroupOfferRule(rule); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if msg, status := checkGroupOfferTarget(rule); msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	createdRule, err := models.CreateGroupOfferRule(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group offer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":    true,
+		"message":    "Group offer created successfully",
+		"groupOffer": createdRule,
+	})
+}
+
+// UpdateGroupOfferRuleRequest lists the rule fields that can change; omitted
+// fields keep their value. A rule cannot move to another ticket or event.
+type UpdateGroupOfferRuleRequest struct {
+	Name        *string `json:"name"`
+	MinTickets  *int    `json:"minTickets"`
+	FreeTickets *int    `json:"freeTickets"`
+	Repeat      *bool   `json:"repeat"`
+	Active      *bool   `json:"active"`
+}
+
+func UpdateGroupOfferRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group offer ID"})
+		return
+	}
+
+	rule, err := models.GetGroupOfferRuleByID(uint(ruleID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group offer not found"})
+		return
+	}
+
+	var req UpdateGroupOfferRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.MinTickets != nil {
+		rule.MinTickets = *req.MinTickets
+	}
+	if req.FreeTickets != nil {
+		rule.FreeTickets = *req.FreeTickets
+	}
+	if req.Repeat != nil {
+		rule.Repeat = *req.Repeat
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	if msg := validateGroupOfferRule(rule); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	rule, err = models.UpdateGroupOfferRule(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group offer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Group offer updated successfully",
+		"groupOffer": rule,
+	})
+}
+
+// DeleteGroupOfferRule removes a rule. Bookings keep the free tickets they
+// were given, since the split is stored on each booking.
+func DeleteGroupOfferRule(c *gin.Context) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group offer ID"})
+		return
+	}
+
+	if _, err := models.GetGroupOfferRuleByID(uint(ruleID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group offer not found"})
+		return
+	}
+
+	if err := models.DeleteGroupOfferRule(uint(ruleID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group offer: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Group offer deleted successfully",
+	})
+}
+
+// validateGroupOfferRule returns the reason a rule cannot be saved, or "" when it is valid
+func validateGroupOfferRule(rule models.GroupOfferRule) string {
+	if rule.Name == "" {
+		return "Group offer name is required"
+	}
+	if (rule.TicketID == nil) == (rule.EventID == nil) {
+		return "Group offer needs either a ticketId or an eventId"
+	}
+	if rule.MinTickets < 2 {
+		return "Group offer must need at least 2 tickets"
+	}
+	if rule.FreeTickets < 1 {
+		return "Group offer must give at least 1 free ticket"
+	}
+	if rule.FreeTickets >= rule.MinTickets {
+		return "Group offer must leave at least 1 ticket paid"
+	}
+	return ""
+}
+
+// checkGroupOfferTarget makes sure the ticket or event a new rule is for exists
+func checkGroupOfferTarget(rule models.GroupOfferRule) (string, int) {
+	if rule.TicketID != nil {
+		if _, err := models.GetTicketByID(*rule.TicketID); err != nil {
+			return "Ticket not found", http.StatusNotFound
+		}
+	}
+	if rule.EventID != nil {
+		if _, err := models.GetEventByID(*rule.EventID); err != nil {
+			return "Event not found", http.StatusNotFound
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/models"
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+// GetBookingHoldTTL reads BOOKING_HOLD_TTL, how long a new booking keeps its
+// seats while the customer pays (default 15m)
+func GetBookingHoldTTL() time.Duration {
+	if value := os.Getenv("BOOKING_HOLD_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return 15 * time.Minute
+}
+
+// GetHoldSweepInterval reads BOOKING_HOLD_SWEEP_INTERVAL (default 1m, 0
+// disables the sweeper)
+func GetHoldSweepInterval() time.Duration {
+	if value := os.Getenv("BOOKING_HOLD_SWEEP_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return time.Minute
+}
+
+// ExpireBookingHolds expires every pending booking whose hold has run out and
+// returns how many were expired
+func ExpireBookingHolds() (int, error) {
+	bookings, err := models.GetExpiredHoldBookings(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, booking := range bookings {
+		ok, err := expireBooking(booking, "hold_sweeper", "seat hold expired")
+		if err != nil {
+			fmt.Printf("Failed to expire booking %s: %v\n", booking.BookingNumber, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+// StartHoldSweeper runs ExpireBookingHolds and SweepWaitlists, and closes
+// lapsed transfers, every interval in the background
+func StartHoldSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := ExpireBookingHolds()
+			if err != nil {
+				fmt.Printf("Hold sweeper failed: %v\n", err)
+				continue
+			}
+			if expired > 0 {
+				fmt.Printf("Hold sweeper expired %d bookings\n", expired)
+			}
+
+			if err := SweepWaitlists(); err != nil {
+				fmt.Printf("Waitlist sweep failed: %v\n", err)
+			}
+			if _, err := models.ExpireBookingTransfers(time.Now()); err != nil {
+				fmt.Printf("Failed to expire transfers: %v\n", err)
+			}
+		}
+	}()
+}
+
+// expireBooking gives up an unpaid booking: its payment link is deactivated so
+// it can no longer be paid, the booking is marked expired and its seats are
+// released. A payment that completed just before the hold ran out is applied
+// instead. It reports whether the booking was expired.
+func expireBooking(booking models.Booking, source, reason string) (bool, error) {
+	// While the link may still be open, try again on the next sweep
+	paid, err := closePaymentLink(booking, source)
+	if paid || err != nil {
+		return false, err
+	}
+
+	expired, err := models.TransitionBooking(booking.ID, models.BookingStatusExpired, "system:"+source, reason)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		return false, nil
+	}
+	return expired, err
+}
+
+// closePaymentLink makes sure the payment link of an unpaid booking can no
+// longer be paid before the booking is given up. A payment that went through
+// first is applied instead, and paid reports it. An error means the link may
+// still be open, so the booking must be kept.
+func closePaymentLink(booking models.Booking, source string) (paid bool, err error) {
+	if booking.PaymentLinkID == "" {
+		return false, nil
+	}
+
+	status, err := config.PaymentGateway.GetLinkStatus(booking.PaymentLinkID)
+	if err != nil {
+		return false, err
+	}
+	if status.Status != "success" {
+		_, err := config.PaymentGateway.CancelLink(booking.PaymentLinkID)
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, payment.ErrLinkNotPayable) {
+			return false, err
+		}
+
+		// The link closed by itself, which it also does once it is paid
+		if status, err = config.PaymentGateway.GetLinkStatus(booking.PaymentLinkID); err != nil {
+			return false, err
+		}
+		if status.Status != "success" {
+			return false, nil
+		}
+	}
+
+	changed, err := applyPaymentStatus(booking, status.Status, source)
+	if changed {
+		recordPaymentTransaction(paymentTransactionFromStatus(booking, source, booking.PaymentLinkID, status))
+	}
+	return true, err
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+type AssignPassRequest struct {
+	AttendeeName string `json:"attendeeName"`
+}
+
+// GetBookingPasses lists the per-seat passes of a booking
+func GetBookingPasses(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionRead) {
+		return
+	}
+
+	passes, err := models.GetPassesByBookingID(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get passes"})
+		return
+	}
+
+	// Only passes that can still be used get a scannable token
+	for i := range passes {
+		if passes[i].Status == models.PassStatusIssued {
+			passes[i].Token, _ = signPassToken(booking, passes[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passes": passes,
+	})
+}
+
+// AssignPass sets or changes the attendee named on one of a booking's passes
+func AssignPass(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+
+	passID, err := strconv.ParseUint(c.Param("passId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pass ID"})
+		return
+	}
+
+	var req AssignPassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	pass, err := models.GetPassByID(uint(passID))
+	if err != nil || pass.BookingID != booking.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pass not found"})
+		return
+	}
+
+	pass, err = models.AssignPassAttendee(pass.ID, strings.TrimSpace(req.AttendeeName))
+	if errors.Is(err, models.ErrPassNotIssued) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only unused passes can be reassigned"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pass"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pass": pass,
+	})
+}
+
+// GetTicketSigningKeys publishes the public keys that verify ticket QR codes,
+// so gate scanners can check tickets without a connection
+func GetTicketSigningKeys(c *gin.Context) {
+	keys := gin.H{}
+	for kid, key := range config.TicketKeys.PublicKeys {
+		keys[kid] = base64.StdEncoding.EncodeToString(key)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm": "Ed25519",
+		"activeKid": config.TicketKeys.ActiveKeyID,
+		"keys":      keys,
+	})
+}
+
+// signPassToken returns the signed QR payload of a pass
+func signPassToken(booking models.Booking, pass models.Pass) (string, error) {
+	claims := helper.TicketClaims{
+		PassCode:      pass.Code,
+		BookingNumber: booking.BookingNumber,
+		TicketID:      booking.TicketID,
+		IssuedAt:      pass.CreatedAt.Unix(),
+	}
+	if booking.Ticket.EventID != nil {
+		claims.EventID = *booking.Ticket.EventID
+	}
+
+	return config.TicketKeys.Sign(claims)
+}
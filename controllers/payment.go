@@ -1,121 +1,35 @@
 package controllers
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
 	"github.com/jezhtech/prince-group-backend/helper"
 	"github.com/jezhtech/prince-group-backend/models"
+	"github.com/jezhtech/prince-group-backend/payment"
+	"gorm.io/gorm"
 )
 
-// Cashfree Payment Links API Request/Response structures based on official documentation
-type CashfreePaymentLinkRequest struct {
-	LinkID          string `json:"link_id,omitempty"`
-	CustomerDetails struct {
-		CustomerEmail string `json:"customer_email"`
-		CustomerName  string `json:"customer_name"`
-		CustomerPhone string `json:"customer_phone"`
-	} `json:"customer_details"`
-	LinkAmount   float64 `json:"link_amount"`
-	LinkCurrency string  `json:"link_currency"`
-	LinkPurpose  string  `json:"link_purpose"`
-	LinkMeta     struct {
-		NotifyURL string `json:"notify_url"`
-		ReturnURL string `json:"return_url"`
-	} `json:"link_meta"`
-	LinkNotify struct {
-		SendEmail bool `json:"send_email"`
-		SendSMS   bool `json:"send_sms"`
-	} `json:"link_notify"`
-	LinkAutoReminders bool `json:"link_auto_reminders"`
-}
-
-type CashfreePaymentLinkResponse struct {
-	CfLinkID        string  `json:"cf_link_id"`
-	LinkID          string  `json:"link_id"`
-	LinkStatus      string  `json:"link_status"`
-	LinkCurrency    string  `json:"link_currency"`
-	LinkAmount      float64 `json:"link_amount"`
-	LinkAmountPaid  float64 `json:"link_amount_paid"`
-	LinkPurpose     string  `json:"link_purpose"`
-	LinkCreatedAt   string  `json:"link_created_at"`
-	CustomerDetails struct {
-		CustomerName  string `json:"customer_name"`
-		CustomerPhone string `json:"customer_phone"`
-		CustomerEmail string `json:"customer_email"`
-	} `json:"customer_details"`
-	LinkMeta struct {
-		NotifyURL string `json:"notify_url"`
-		ReturnURL string `json:"return_url"`
-	} `json:"link_meta"`
-	LinkURL        string `json:"link_url"`
-	LinkExpiryTime string `json:"link_expiry_time"`
-	LinkQRCode     string `json:"link_qrcode"`
-	LinkNotify     struct {
-		SendSMS   bool `json:"send_sms"`
-		SendEmail bool `json:"send_email"`
-	} `json:"link_notify"`
-}
-
-type CashfreePaymentDetails struct {
-	CfPaymentID     string  `json:"cf_payment_id"`
-	OrderID         string  `json:"order_id"`
-	Entity          string  `json:"entity"`
-	OrderAmount     float64 `json:"order_amount"`
-	PaymentAmount   float64 `json:"payment_amount"`
-	PaymentCurrency string  `json:"payment_currency"`
-	PaymentStatus   string  `json:"payment_status"`
-	PaymentMessage  string  `json:"payment_message"`
-	BankReference   string  `json:"bank_reference"`
-	AuthID          string  `json:"auth_id"`
-	PaymentMethod   struct {
-		PaymentMethod string `json:"payment_method"`
-		CardNetwork   string `json:"card_network,omitempty"`
-		CardIssuer    string `json:"card_issuer,omitempty"`
-		CardType      string `json:"card_type,omitempty"`
-	} `json:"payment_method"`
-	PaymentTime     string `json:"payment_time"`
-	PaymentGroup    string `json:"payment_group"`
-	CustomerDetails struct {
-		CustomerID    string `json:"customer_id"`
-		CustomerName  string `json:"customer_name"`
-		CustomerEmail string `json:"customer_email"`
-		CustomerPhone string `json:"customer_phone"`
-	} `json:"customer_details"`
-}
-
-type PaymentStatus struct {
-	OrderID       string    `json:"orderId"`
-	PaymentID     string    `json:"paymentId"`
-	TransactionID string    `json:"transactionId"`
-	Status        string    `json:"status"`
-	Amount        float64   `json:"amount"`
-	Currency      string    `json:"currency"`
-	PaymentMethod string    `json:"paymentMethod"`
-	PaymentDate   time.Time `json:"paymentDate"`
-	Message       string    `json:"message,omitempty"`
-}
-
 type CreatePaymentRequest struct {
 	BookingID     string  `json:"bookingId"`
 	Amount        float64 `json:"amount"`
-	Currency      string  `json:"currency"`
 	CustomerName  string  `json:"customerName"`
 	CustomerEmail string  `json:"customerEmail"`
 	CustomerPhone string  `json:"customerPhone"`
 	OrderNote     string  `json:"orderNote,omitempty"`
 }
 
-// CreatePaymentLink creates a new payment link with Cashfree
+// CreatePaymentLink creates a new payment link with the payment gateway
 func CreatePaymentLink(c *gin.Context) {
 	// Get Firebase ID from context (set by middleware)
 	_, exists := c.Get("firebaseId")
@@ -135,60 +49,106 @@ func CreatePaymentLink(c *gin.Context) {
 
 	booking, err := models.GetBookingByBookingNumber(req.BookingID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+
+	switch booking.Status {
+	case models.BookingStatusCreated, models.BookingStatusAwaitingPayment, models.BookingStatusFailed:
+	case models.BookingStatusPaid, models.BookingStatusCheckedIn:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Booking is already paid"})
+		return
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking can no longer be paid"})
+		return
+	}
+	if errors.Is(booking.Ticket.SaleError(time.Now()), models.ErrEventNotOnSale) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This event is not open for booking"})
+		return
+	}
+	if booking.HoldExpiresAt != nil && time.Now().After(*booking.HoldExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Booking hold has expired, please book again"})
+		return
+	}
+
+	// The booking price was computed server-side; refuse to charge anything else
+	if math.Abs(req.Amount-booking.PaymentPrice) > 0.005 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Payment amount does not match booking price",
+			"expectedAmount": booking.PaymentPrice,
+		})
+		return
+	}
+
+	// Only the newest link may be paid, so retries cannot charge twice
+	if booking.PaymentLinkID != "" {
+		if _, err := config.PaymentGateway.CancelLink(booking.PaymentLinkID); err != nil {
+			fmt.Printf("Failed to cancel previous payment link %s: %v\n", booking.PaymentLinkID, err)
+		}
+	}
+
+	// Retrying after a failed payment takes the booking's seats again
+	_, err = models.TransitionBooking(booking.ID, models.BookingStatusAwaitingPayment, c.GetString("firebaseId"), "payment link created")
+	if errors.Is(err, models.ErrSoldOut) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough tickets available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
 		return
 	}
 
 	booking.PaymentLinkID = linkID
-	models.UpdateBooking(booking)
-
-	// Prepare Cashfree Payment Link request according to their API documentation
-	cashfreeReq := CashfreePaymentLinkRequest{
-		LinkID:       linkID,
-		LinkAmount:   req.Amount,
-		LinkCurrency: req.Currency,
-		LinkPurpose:  req.OrderNote,
-		CustomerDetails: struct {
-			CustomerEmail string `json:"customer_email"`
-			CustomerName  string `json:"customer_name"`
-			CustomerPhone string `json:"customer_phone"`
-		}{
-			CustomerEmail: req.CustomerEmail,
-			CustomerName:  req.CustomerName,
-			CustomerPhone: req.CustomerPhone,
-		},
-		LinkMeta: struct {
-			NotifyURL string `json:"notify_url"`
-			ReturnURL string `json:"return_url"`
-		}{
-			NotifyURL: os.Getenv("CASHFREE_NOTIFY_URL"),
-			ReturnURL: os.Getenv("CASHFREE_RETURN_URL") + "?orderId=" + linkID + "&bookingId=" + req.BookingID,
-		},
-		LinkNotify: struct {
-			SendEmail bool `json:"send_email"`
-			SendSMS   bool `json:"send_sms"`
-		}{
-			SendEmail: false,
-			SendSMS:   false,
-		},
-		LinkAutoReminders: true,
+	if err := models.SetBookingPaymentLink(booking.ID, linkID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
+		return
 	}
 
-	// Call Cashfree Payment Links API
-	response, err := createCashfreePaymentLink(cashfreeReq)
+	var expiresAt time.Time
+	if booking.HoldExpiresAt != nil {
+		expiresAt = *booking.HoldExpiresAt
+	}
+
+	// Create the payment link with the configured gateway
+	response, err := config.PaymentGateway.CreateLink(payment.LinkRequest{
+		LinkID:        linkID,
+		Amount:        booking.PaymentPrice,
+		Currency:      "INR", // bookings are priced in rupees only
+		Purpose:       req.OrderNote,
+		CustomerName:  req.CustomerName,
+		CustomerEmail: req.CustomerEmail,
+		CustomerPhone: req.CustomerPhone,
+		NotifyURL:     os.Getenv("CASHFREE_NOTIFY_URL"),
+		ReturnURL:     os.Getenv("CASHFREE_RETURN_URL") + "?orderId=" + linkID + "&bookingId=" + req.BookingID,
+		ExpiresAt:     expiresAt,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment link: " + err.Error()})
 		return
 	}
 
+	recordPaymentTransaction(models.PaymentTransaction{
+		BookingID:       booking.ID,
+		Source:          "link_created",
+		LinkID:          linkID,
+		ProviderOrderID: response.ProviderLinkID,
+		Amount:          response.Amount,
+		Currency:        response.Currency,
+		Status:          payment.MapPaymentLinkStatus(response.Status),
+		RawPayload:      response.RawPayload,
+	})
+
 	// Return response in our expected format with the custom linkID
 	c.JSON(http.StatusOK, gin.H{
-		"paymentSessionId": response.CfLinkID,
+		"paymentSessionId": response.ProviderLinkID,
 		"orderId":          linkID, // Use our custom linkID instead of Cashfree's
-		"orderAmount":      response.LinkAmount,
-		"orderCurrency":    response.LinkCurrency,
-		"status":           response.LinkStatus,
-		"paymentLink":      response.LinkURL,
+		"orderAmount":      response.Amount,
+		"orderCurrency":    response.Currency,
+		"status":           response.Status,
+		"paymentLink":      response.URL,
 		"linkId":           linkID, // Include the linkID for frontend reference
 	})
 }
@@ -208,20 +168,31 @@ func CheckPaymentStatus(c *gin.Context) {
 		return
 	}
 
-	// Call Cashfree API to check status
-	status, err := getCashfreePaymentLinkStatus(linkID)
+	booking, err := models.GetBookingByOrderID(linkID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionRead) {
+		return
+	}
+
+	// Ask the payment gateway for the status
+	status, err := config.PaymentGateway.GetLinkStatus(linkID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check payment status: " + err.Error()})
 		return
 	}
 
-	// If payment is successful, send confirmation email
-	if status.Status == "success" {
-		// Get booking by linkID
-		booking, err := models.GetBookingByOrderID(linkID)
-		if err == nil {
-			sendPaymentConfirmationEmail(booking.BookingNumber)
-		}
+	// Record the outcome; the confirmation email goes out only on the first success.
+	// Polls that don't change anything are not written to the ledger, since the
+	// frontend polls repeatedly while the customer is paying.
+	changed, err := applyPaymentStatus(booking, status.Status, "status_poll")
+	if err != nil {
+		fmt.Printf("Failed to update booking for link %s: %v\n", linkID, err)
+	}
+	if changed {
+		recordPaymentTransaction(paymentTransactionFromStatus(booking, "status_poll", linkID, status))
 	}
 
 	c.JSON(http.StatusOK, status)
@@ -236,11 +207,61 @@ func GetPaymentHistory(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement payment history retrieval from database
-	// For now, return empty array
-	payments := []PaymentStatus{}
+	firebaseId := c.GetString("firebaseId")
+
+	// Get pagination parameters from query string
+	pageStr := c.DefaultQuery("page", "1")
+	pageSizeStr := c.DefaultQuery("pageSize", "10")
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	history, err := models.GetPaymentTransactionsByUserPaginated(firebaseId, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment history"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"payments": payments})
+	c.JSON(http.StatusOK, gin.H{
+		"payments": history.Transactions,
+		"pagination": gin.H{
+			"total":       history.Total,
+			"page":        history.Page,
+			"pageSize":    history.PageSize,
+			"totalPages":  history.TotalPages,
+			"hasNext":     history.HasNext,
+			"hasPrevious": history.HasPrevious,
+		},
+	})
+}
+
+// GetBookingPaymentTransactions returns the full payment ledger of a booking for support staff
+func GetBookingPaymentTransactions(c *gin.Context) {
+	bookingNumber := c.Param("bookingNumber")
+
+	booking, err := models.GetBookingByBookingNumber(bookingNumber)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	transactions, err := models.GetPaymentTransactionsByBookingID(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"booking":      booking,
+		"transactions": transactions,
+	})
 }
 
 // PaymentWebhook handles Cashfree webhook notifications
@@ -252,24 +273,87 @@ func PaymentWebhook(c *gin.Context) {
 		return
 	}
 
-	// Verify webhook signature (implement signature verification)
-	if !verifyWebhookSignature(c.Request.Header.Get("X-Webhook-Signature"), body) {
+	// Verify webhook signature before trusting anything in the body
+	if err := config.PaymentGateway.VerifyWebhook(c.Request.Header, body); err != nil {
+		fmt.Printf("Rejected webhook: %v\n", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
 		return
 	}
 
-	// Parse webhook data
-	var webhookData map[string]interface{}
-	if err := json.Unmarshal(body, &webhookData); err != nil {
+	// Parse webhook envelope
+	var event payment.CashfreeWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
 		return
 	}
 
-	// Process webhook data
-	// Update booking status based on payment status
-	// Send confirmation emails, etc.
+	var linkIDs []string
+	var status string
+	transaction := models.PaymentTransaction{
+		Source:     "webhook",
+		RawPayload: string(body),
+	}
+
+	switch event.Type {
+	case "PAYMENT_LINK_EVENT":
+		var data payment.CashfreePaymentLinkEventData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+			return
+		}
+		linkIDs = []string{string(data.LinkID), string(data.CfLinkID)}
+		status = payment.MapPaymentLinkStatus(data.LinkStatus)
+		transaction.ProviderOrderID = string(data.Order.OrderID)
+		transaction.ProviderPaymentID = string(data.Order.TransactionID)
+		transaction.Amount = data.LinkAmountPaid.Float()
+		transaction.Currency = data.LinkCurrency
+	case "PAYMENT_SUCCESS_WEBHOOK", "PAYMENT_FAILED_WEBHOOK", "PAYMENT_USER_DROPPED_WEBHOOK":
+		var data payment.CashfreePaymentEventData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+			return
+		}
+		linkIDs = []string{string(data.Order.OrderTags.LinkID), string(data.Order.OrderTags.CfLinkID)}
+		status = payment.MapPaymentStatus(data.Payment.PaymentStatus)
+		transaction.ProviderOrderID = string(data.Order.OrderID)
+		transaction.ProviderPaymentID = string(data.Payment.CfPaymentID)
+		transaction.Amount = data.Payment.PaymentAmount.Float()
+		transaction.Currency = data.Payment.PaymentCurrency
+		transaction.Method = data.Payment.PaymentGroup
+	case "REFUND_STATUS_WEBHOOK":
+		var data payment.CashfreeRefundEventData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+			return
+		}
+		err := applyRefundStatus(data.Refund.RefundID, payment.MapRefundStatus(data.Refund.RefundStatus), string(data.Refund.CfRefundID), string(body))
+		if err != nil {
+			fmt.Printf("Failed to apply refund webhook for %s: %v\n", data.Refund.RefundID, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		return
+	default:
+		// Acknowledge events we don't act on so Cashfree stops retrying them
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+
+	booking, err := findBookingByLinkIDs(linkIDs)
+	if err != nil {
+		fmt.Printf("Webhook %s did not match any booking (links %v)\n", event.Type, linkIDs)
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
 
-	fmt.Printf("Webhook received: %+v\n", webhookData)
+	transaction.BookingID = booking.ID
+	transaction.LinkID = booking.PaymentLinkID
+	transaction.Status = status
+	recordPaymentTransaction(transaction)
+
+	if _, err := applyPaymentStatus(booking, status, "webhook"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
@@ -278,8 +362,6 @@ func PaymentWebhook(c *gin.Context) {
 func PaymentCallback(c *gin.Context) {
 	// Get query parameters from Cashfree redirect
 	orderID := c.Query("order_id")
-	paymentStatus := c.Query("payment_status")
-	cfLinkID := c.Query("cf_link_id")
 
 	if orderID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order ID is required"})
@@ -293,39 +375,27 @@ func PaymentCallback(c *gin.Context) {
 		return
 	}
 
-	// Update booking status based on payment status
-	var paymentStatusStr string
-
-	switch paymentStatus {
-	case "SUCCESS":
-		paymentStatusStr = "success"
-	case "FAILED":
-		paymentStatusStr = "failed"
-	default:
-		paymentStatusStr = "pending"
+	// The redirect is a public URL, so confirm the outcome with Cashfree
+	// instead of trusting the payment_status query parameter
+	paymentStatus := "pending"
+	if status, err := config.PaymentGateway.GetLinkStatus(orderID); err == nil {
+		paymentStatus = status.Status
+		recordPaymentTransaction(paymentTransactionFromStatus(booking, "callback", orderID, status))
+	} else {
+		fmt.Printf("Failed to confirm payment status for %s: %v\n", orderID, err)
 	}
 
-	// Update booking
-	booking.PaymentStatus = paymentStatusStr
-	booking.PaymentLinkID = cfLinkID
-
-	updatedBooking, err := models.UpdateBooking(booking)
-	if err != nil {
+	if _, err := applyPaymentStatus(booking, paymentStatus, "callback"); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
 		return
 	}
 
-	// Send confirmation email if payment is successful
-	if paymentStatus == "SUCCESS" {
-		sendPaymentConfirmationEmail(updatedBooking.BookingNumber)
-	}
-
 	// Redirect to frontend with status and orderID
 	redirectURL := os.Getenv("FRONTEND_URL") + "/payment/result"
-	if paymentStatus == "SUCCESS" {
-		redirectURL += "?status=success&bookingId=" + updatedBooking.BookingNumber + "&orderId=" + orderID
+	if paymentStatus == "success" {
+		redirectURL += "?status=success&bookingId=" + booking.BookingNumber + "&orderId=" + orderID
 	} else {
-		redirectURL += "?status=failed&bookingId=" + updatedBooking.BookingNumber + "&orderId=" + orderID
+		redirectURL += "?status=failed&bookingId=" + booking.BookingNumber + "&orderId=" + orderID
 	}
 
 	c.Redirect(http.StatusFound, redirectURL)
@@ -346,6 +416,19 @@ func SendPaymentConfirmationEmail(c *gin.Context) {
 		return
 	}
 
+	booking, err := models.GetBookingByBookingNumber(bookingNumber)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+	if booking.Status != models.BookingStatusPaid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking is not paid"})
+		return
+	}
+
 	// Send the confirmation email
 	sendPaymentConfirmationEmail(bookingNumber)
 
@@ -355,265 +438,177 @@ func SendPaymentConfirmationEmail(c *gin.Context) {
 	})
 }
 
-// Helper function to create Cashfree payment link using their API
-func createCashfreePaymentLink(req CashfreePaymentLinkRequest) (*CashfreePaymentLinkResponse, error) {
-	clientID := os.Getenv("CASHFREE_CLIENT_ID")
-	clientSecret := os.Getenv("CASHFREE_CLIENT_SECRET")
-	apiURL := os.Getenv("CASHFREE_API_URL")
-
-	if clientID == "" || clientSecret == "" || apiURL == "" {
-		return nil, fmt.Errorf("cashfree configuration missing")
+// SimulateFakePayment settles a link of the in-memory fake gateway with the
+// given outcome (paid, failed or expired) and applies it to the booking,
+// standing in for the Cashfree webhook during local development. Only the
+// booking's current link can be settled; a link replaced by a retry gets 409.
+func SimulateFakePayment(c *gin.Context) {
+	fake, ok := config.PaymentGateway.(*payment.FakeGateway)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Fake payment gateway is not enabled"})
+		return
 	}
 
-	// Convert request to JSON
-	jsonData, err := json.Marshal(req)
+	linkID := c.Param("linkId")
+	booking, err := models.GetBookingByOrderID(linkID)
 	if err != nil {
-		return nil, err
+		respondReplacedLink(c, linkID)
+		return
 	}
-
-	// Debug: Print the JSON being sent
-	fmt.Printf("Sending JSON to Cashfree: %s\n", string(jsonData))
-
-	// Create HTTP request to Cashfree's Create Payment Link API
-	httpReq, err := http.NewRequest("POST", apiURL+"/links", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
 	}
 
-	// Set headers according to Cashfree documentation
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-client-id", clientID)
-	httpReq.Header.Set("x-client-secret", clientSecret)
-	httpReq.Header.Set("x-api-version", "2025-01-01")
-
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return nil, err
+	if err := fake.Simulate(linkID, c.Param("outcome")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+	status, err := fake.GetLinkStatus(linkID)
 	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cashfree API error: %s", string(respBody))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check payment status: " + err.Error()})
+		return
 	}
 
-	// Parse response
-	var cashfreeResp CashfreePaymentLinkResponse
-	if err := json.Unmarshal(respBody, &cashfreeResp); err != nil {
-		return nil, err
+	const source = "fake_gateway"
+	recordPaymentTransaction(paymentTransactionFromStatus(booking, source, linkID, status))
+	if _, err := applyPaymentStatus(booking, status.Status, source); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
+		return
 	}
 
-	return &cashfreeResp, nil
+	c.JSON(http.StatusOK, status)
 }
 
-// Helper function to get payment link status from Cashfree
-func getCashfreePaymentLinkStatus(linkID string) (*PaymentStatus, error) {
-	clientID := os.Getenv("CASHFREE_CLIENT_ID")
-	clientSecret := os.Getenv("CASHFREE_CLIENT_SECRET")
-	apiURL := os.Getenv("CASHFREE_API_URL")
-
-	if clientID == "" || clientSecret == "" || apiURL == "" {
-		return nil, fmt.Errorf("cashfree configuration missing")
-	}
-
-	// Create HTTP request to Cashfree's Get Orders for a Payment Link API
-	// Using the correct endpoint from the documentation: /links/{link_id}/orders
-	httpReq, err := http.NewRequest("GET", apiURL+"/links/"+linkID+"/orders", nil)
+// respondReplacedLink answers for a link that is no booking's current link:
+// 409 to those who may act on the booking it was created for, 404 otherwise
+func respondReplacedLink(c *gin.Context, linkID string) {
+	bookingID, err := models.GetBookingIDByLinkID(linkID)
 	if err != nil {
-		return nil, err
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
 	}
-
-	// Set headers according to Cashfree documentation
-	httpReq.Header.Set("x-client-id", clientID)
-	httpReq.Header.Set("x-client-secret", clientSecret)
-	httpReq.Header.Set("x-api-version", "2023-08-01") // Using the correct API version
-
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	booking, err := models.GetBookingByID(bookingID)
 	if err != nil {
-		return nil, err
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cashfree API error: %s", string(respBody))
-	}
-
-	// Parse response - Cashfree returns an array of orders
-	var ordersResponse []struct {
-		CfOrderID        string  `json:"cf_order_id"`
-		OrderID          string  `json:"order_id"`
-		OrderAmount      float64 `json:"order_amount"`
-		OrderCurrency    string  `json:"order_currency"`
-		OrderStatus      string  `json:"order_status"`
-		OrderNote        string  `json:"order_note"`
-		CreatedAt        string  `json:"created_at"`
-		PaymentSessionID string  `json:"payment_session_id"`
-		CustomerDetails  struct {
-			CustomerName  string `json:"customer_name"`
-			CustomerEmail string `json:"customer_email"`
-			CustomerPhone string `json:"customer_phone"`
-		} `json:"customer_details"`
-	}
-
-	if err := json.Unmarshal(respBody, &ordersResponse); err != nil {
-		return nil, err
-	}
-
-	// If no orders found, return a pending status
-	if len(ordersResponse) == 0 {
-		return &PaymentStatus{
-			OrderID:       linkID,
-			PaymentID:     linkID,
-			TransactionID: linkID,
-			Status:        "pending",
-			Amount:        0,
-			Currency:      "INR",
-			PaymentMethod: "cashfree",
-			PaymentDate:   time.Now(),
-			Message:       "No orders found for this payment link",
-		}, nil
-	}
-
-	// Get the first order (most recent)
-	order := ordersResponse[0]
-
-	// Convert to our PaymentStatus format
-	status := &PaymentStatus{
-		OrderID:       order.OrderID,
-		PaymentID:     order.CfOrderID,
-		TransactionID: order.PaymentSessionID,
-		Status:        mapOrderStatus(order.OrderStatus),
-		Amount:        order.OrderAmount,
-		Currency:      order.OrderCurrency,
-		PaymentMethod: "cashfree",
-		PaymentDate:   time.Now(),
-		Message:       order.OrderNote,
-	}
-
-	return status, nil
+	c.JSON(http.StatusConflict, gin.H{"error": "Payment link was replaced by a newer one"})
 }
 
-// Helper function to get payment details from Cashfree
-func getCashfreePaymentDetails(orderID string) (*CashfreePaymentDetails, error) {
-	clientID := os.Getenv("CASHFREE_CLIENT_ID")
-	clientSecret := os.Getenv("CASHFREE_CLIENT_SECRET")
-	apiURL := os.Getenv("CASHFREE_API_URL")
-
-	if clientID == "" || clientSecret == "" || apiURL == "" {
-		return nil, fmt.Errorf("cashfree configuration missing")
-	}
+// findBookingByLinkIDs returns the booking for the first link ID that matches.
+// Older callbacks overwrote payment_link_id with Cashfree's cf_link_id, so
+// webhooks try both identifiers.
+func findBookingByLinkIDs(linkIDs []string) (models.Booking, error) {
+	err := gorm.ErrRecordNotFound
+	for _, linkID := range linkIDs {
+		if linkID == "" {
+			continue
+		}
 
-	// Create HTTP request to Cashfree's Get Payments for Order API
-	httpReq, err := http.NewRequest("GET", apiURL+"/orders/"+orderID+"/payments", nil)
-	if err != nil {
-		return nil, err
+		var booking models.Booking
+		booking, err = models.GetBookingByOrderID(linkID)
+		if err == nil {
+			return booking, nil
+		}
 	}
 
-	// Set headers according to Cashfree documentation
-	httpReq.Header.Set("x-client-id", clientID)
-	httpReq.Header.Set("x-client-secret", clientSecret)
-	httpReq.Header.Set("x-api-version", "2023-08-01")
+	return models.Booking{}, err
+}
 
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return nil, err
+// applyPaymentStatus records a payment outcome against the booking on behalf
+// of source (callback, webhook, status_poll, ...). A success can override an
+// earlier failed attempt or an expired hold, but nothing moves a booking out
+// of paid. The confirmation email is only sent by the call that actually
+// moved the booking to paid, so it goes out exactly once no matter how many
+// of the callback, webhook and status polling paths observe the payment.
+func applyPaymentStatus(booking models.Booking, status, source string) (bool, error) {
+	var to models.BookingStatus
+	switch status {
+	case "success":
+		to = models.BookingStatusPaid
+	case "failed":
+		to = models.BookingStatusFailed
+	default:
+		return false, nil
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+	changed, err := models.TransitionBooking(booking.ID, to, "system:"+source, "payment "+status)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		return false, nil
+	}
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cashfree API error: %s", string(respBody))
+	if changed && to == models.BookingStatusPaid {
+		sendPaymentConfirmationEmail(booking.BookingNumber)
 	}
 
-	// Parse response - Cashfree returns an array of payments
-	var paymentsResponse struct {
-		Payments []CashfreePaymentDetails `json:"payments"`
+	return changed, nil
+}
+
+// recordPaymentTransaction appends an entry to the payment ledger. Failures are
+// only logged: the ledger must never block a payment update.
+func recordPaymentTransaction(transaction models.PaymentTransaction) {
+	if transaction.Provider == "" {
+		transaction.Provider = "cashfree"
 	}
-	if err := json.Unmarshal(respBody, &paymentsResponse); err != nil {
-		return nil, err
+	if transaction.Currency == "" {
+		transaction.Currency = "INR"
 	}
 
-	// Return the first successful payment
-	if len(paymentsResponse.Payments) > 0 {
-		return &paymentsResponse.Payments[0], nil
+	if _, err := models.CreatePaymentTransaction(transaction); err != nil {
+		fmt.Printf("Failed to record %s payment transaction for booking %s: %v\n", transaction.Source, transaction.BookingID, err)
 	}
-
-	return nil, fmt.Errorf("no payment details found")
 }
 
-// Helper function to map Cashfree payment link status to our status
-func mapPaymentLinkStatus(cashfreeStatus string) string {
-	switch cashfreeStatus {
-	case "ACTIVE":
-		return "pending"
-	case "PAID":
-		return "success"
-	case "EXPIRED":
-		return "failed"
-	case "CANCELLED":
-		return "failed"
-	default:
-		return "pending"
+// paymentTransactionFromStatus builds a ledger entry from a gateway status lookup
+func paymentTransactionFromStatus(booking models.Booking, source, linkID string, status *payment.PaymentStatus) models.PaymentTransaction {
+	return models.PaymentTransaction{
+		BookingID:         booking.ID,
+		Source:            source,
+		LinkID:            linkID,
+		ProviderOrderID:   status.OrderID,
+		ProviderPaymentID: status.PaymentID,
+		Amount:            status.Amount,
+		Currency:          status.Currency,
+		Status:            status.Status,
+		RawPayload:        status.RawPayload,
 	}
 }
 
-// Helper function to map Cashfree order status to our status
-func mapOrderStatus(cashfreeOrderStatus string) string {
-	switch cashfreeOrderStatus {
-	case "ACTIVE":
-		return "pending"
-	case "PAID":
-		return "success"
-	case "EXPIRED":
-		return "failed"
-	case "CANCELLED":
-		return "failed"
-	case "PENDING":
-		return "pending"
-	case "FAILED":
-		return "failed"
-	default:
-		return "pending"
+// entryPasses lists the booking's valid passes for the confirmation email
+func entryPasses(booking models.Booking) []helper.EntryPass {
+	passes, err := models.GetPassesByBookingID(booking.ID)
+	if err != nil {
+		fmt.Printf("Failed to get passes for %s: %v\n", booking.BookingNumber, err)
+		return nil
 	}
-}
 
-// Helper function to verify webhook signature
-func verifyWebhookSignature(signature string, body []byte) bool {
-	// Implement signature verification based on Cashfree documentation
-	// This is a placeholder - implement according to Cashfree's webhook signature verification
-	webhookSecret := os.Getenv("CASHFREE_WEBHOOK_SECRET")
-	if webhookSecret == "" {
-		return false
-	}
+	entryPasses := []helper.EntryPass{}
+	for _, pass := range passes {
+		if pass.Status == models.PassStatusVoid {
+			continue
+		}
+		token, err := signPassToken(booking, pass)
+		if err != nil {
+			fmt.Printf("Failed to sign pass %s: %v\n", pass.Code, err)
+			continue
+		}
 
-	// Create signature
-	h := sha256.New()
-	h.Write(body)
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
+		entryPasses = append(entryPasses, helper.EntryPass{
+			Code:         pass.Code,
+			AttendeeName: pass.AttendeeName,
+			QRPayload:    token,
+		})
+	}
 
-	return signature == expectedSignature
+	return entryPasses
 }
 
 // sendPaymentConfirmationEmail sends a confirmation email for successful payments
@@ -625,30 +620,30 @@ func sendPaymentConfirmationEmail(bookingNumber string) {
 		return
 	}
 
-	// Calculate free tickets based on ticket count
+	emailBookingConfirmation(booking)
+}
+
+// emailBookingConfirmation sends the confirmation email with the passes of a
+// booking loaded by GetBookingWithEmailData to booking.User
+func emailBookingConfirmation(booking models.Booking) {
 	ticketCount := booking.TicketCount
-	freeTickets := 0
-	if ticketCount >= 8 {
-		freeTickets = 2
-	} else if ticketCount >= 4 {
-		freeTickets = 1
-	}
 
 	// Send confirmation email
 	fmt.Printf("Sending email to: %s, Name: %s, Booking: %s, Ticket: %s, Count: %d, Amount: %.2f, Free: %d\n",
 		booking.User.Email, booking.User.FullName, booking.BookingNumber,
-		booking.Ticket.Name, ticketCount, booking.PaymentPrice, freeTickets)
+		booking.Ticket.Name, ticketCount, booking.PaymentPrice, booking.FreeTickets)
 
-	err = helper.SendPaymentConfirmationEmail(
+	err := helper.SendPaymentConfirmationEmail(
 		booking.User.Email,
 		booking.User.FullName,
 		booking.BookingNumber,
 		booking.Ticket.Name,
 		fmt.Sprintf("%d", ticketCount),
 		fmt.Sprintf("%.2f", booking.PaymentPrice),
-		"September 20, 2025 • 5:00 PM",
-		"Concordia High School Ground, Nagercoil",
-		freeTickets,
+		emailEventDetails(booking.Ticket),
+		booking.PaidTickets,
+		booking.FreeTickets,
+		entryPasses(booking),
 	)
 	if err != nil {
 		fmt.Printf("Failed to send confirmation email: %v\n", err)
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+type bookingAction int
+
+const (
+	bookingActionRead bookingAction = iota
+	bookingActionWrite
+)
+
+// canAccessBooking decides whether the authenticated user may act on a
+// booking. Owners and admins may do anything; clients may only read.
+func canAccessBooking(c *gin.Context, booking models.Booking, action bookingAction) bool {
+	firebaseId := c.GetString("firebaseId")
+	if firebaseId == "" {
+		return false
+	}
+	if booking.UserID == firebaseId {
+		return true
+	}
+
+	switch requestRole(c) {
+	case "admin":
+		return true
+	case "client":
+		return action == bookingActionRead
+	}
+	return false
+}
+
+// authorizeBooking responds 404 when the user may not act on the booking, so
+// booking numbers and IDs of other customers cannot be probed. It reports
+// whether the handler may continue.
+func authorizeBooking(c *gin.Context, booking models.Booking, action bookingAction) bool {
+	if canAccessBooking(c, booking, action) {
+		return true
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+	return false
+}
+
+// requestRole returns the role of the authenticated user, loading it once per
+// request for routes behind UserMiddleware, which does not set user_role
+func requestRole(c *gin.Context) string {
+	if role := c.GetString("user_role"); role != "" {
+		return role
+	}
+
+	user, err := models.GetUserByFirebaseId(c.GetString("firebaseId"))
+	if err != nil {
+		return ""
+	}
+
+	c.Set("user_role", user.Role)
+	return user.Role
+}
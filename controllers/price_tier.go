@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// GetPriceTiers lists a ticket's price tiers in the order they are tried
+func GetPriceTiers(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	tiers, err := models.GetPriceTiersByTicketID(uint(ticketID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get price tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"priceTiers": tiers,
+	})
+}
+
+func CreatePriceTier(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	if _, err := models.GetTicketByID(uint(ticketID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+
+	var tier models.PriceTier
+	if err := c.ShouldBindJSON(&tier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	tier.ID = 0
+	tier.TicketID = uint(ticketID)
+	if msg := validatePriceTier(tier); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	createdTier, err := models.CreatePriceTier(tier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create price tier: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"message":   "Price tier created successfully",
+		"priceTier": createdTier,
+	})
+}
+
+func UpdatePriceTier(c *gin.Context) {
+	existingTier, ok := ticketPriceTier(c)
+	if !ok {
+		return
+	}
+
+	var updateData models.PriceTier
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// Update only the provided fields
+	if updateData.Name != "" {
+		existingTier.Name = updateData.Name
+	}
+	if updateData.Price > 0 {
+		existingTier.Price = updateData.Price
+	}
+	if updateData.UntilSeat >= 0 {
+		existingTier.UntilSeat = updateData.UntilSeat
+	}
+	if updateData.EndsAt != nil {
+		existingTier.EndsAt = updateData.EndsAt
+	}
+	if updateData.SortOrder != 0 {
+		existingTier.SortOrder = updateData.SortOrder
+	}
+
+	if msg := validatePriceTier(existingTier); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	updatedTier, err := models.UpdatePriceTier(existingTier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update price tier: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Price tier updated successfully",
+		"priceTier": updatedTier,
+	})
+}
+
+func DeletePriceTier(c *gin.Context) {
+	tier, ok := ticketPriceTier(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeletePriceTier(tier.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete price tier: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Price tier deleted successfully",
+	})
+}
+
+// ticketPriceTier loads the tier in the URL, responding 404 unless it belongs
+// to the ticket in the URL
+func ticketPriceTier(c *gin.Context) (models.PriceTier, bool) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return models.PriceTier{}, false
+	}
+	tierID, err := strconv.ParseUint(c.Param("tierId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price tier ID"})
+		return models.PriceTier{}, false
+	}
+
+	tier, err := models.GetPriceTierByID(uint(tierID))
+	if err != nil || tier.TicketID != uint(ticketID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Price tier not found"})
+		return models.PriceTier{}, false
+	}
+
+	return tier, true
+}
+
+// validatePriceTier returns the reason a tier cannot be saved, or "" when it is valid
+func validatePriceTier(tier models.PriceTier) string {
+	if tier.Name == "" {
+		return "Price tier name is required"
+	}
+	if tier.Price <= 0 {
+		return "Price tier price must be greater than 0"
+	}
+	if tier.UntilSeat < 0 {
+		return "Price tier seat limit cannot be negative"
+	}
+	if tier.UntilSeat == 0 && tier.EndsAt == nil {
+		return "Price tier needs a seat limit or an end time"
+	}
+	return ""
+}
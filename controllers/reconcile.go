@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// ReconcileReport summarises one pass over the pending bookings
+type ReconcileReport struct {
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Checked    int                 `json:"checked"`
+	Updated    int                 `json:"updated"`
+	Expired    int                 `json:"expired"`
+	Errors     int                 `json:"errors"`
+	Mismatches []ReconcileMismatch `json:"mismatches"`
+}
+
+// ReconcileMismatch is a booking whose state disagreed with the payment gateway
+type ReconcileMismatch struct {
+	BookingNumber string  `json:"bookingNumber"`
+	LinkID        string  `json:"linkId"`
+	BookingStatus string  `json:"bookingStatus"`
+	GatewayStatus string  `json:"gatewayStatus"`
+	BookingAmount float64 `json:"bookingAmount"`
+	GatewayAmount float64 `json:"gatewayAmount"`
+	Resolution    string  `json:"resolution"`
+}
+
+// ReconcilePendingPayments asks the payment gateway about every pending booking
+// that has a payment link and applies the outcome, so bookings no longer stay
+// pending when the customer never returned to the site. Bookings still unpaid
+// after pendingTTL are expired.
+func ReconcilePendingPayments(pendingTTL time.Duration) (ReconcileReport, error) {
+	report := ReconcileReport{
+		StartedAt:  time.Now(),
+		Mismatches: []ReconcileMismatch{},
+	}
+
+	bookings, err := models.GetPendingBookingsWithPaymentLink()
+	if err != nil {
+		return report, err
+	}
+
+	for _, booking := range bookings {
+		report.Checked++
+
+		status, err := config.PaymentGateway.GetLinkStatus(booking.PaymentLinkID)
+		if err != nil {
+			report.Errors++
+			fmt.Printf("Reconcile: failed to check link %s of booking %s: %v\n", booking.PaymentLinkID, booking.BookingNumber, err)
+			continue
+		}
+
+		if status.Status != "pending" {
+			mismatch := ReconcileMismatch{
+				BookingNumber: booking.BookingNumber,
+				LinkID:        booking.PaymentLinkID,
+				BookingStatus: string(booking.Status),
+				GatewayStatus: status.Status,
+				BookingAmount: booking.PaymentPrice,
+				GatewayAmount: status.Amount,
+				Resolution:    "updated",
+			}
+			if status.Status == "success" && math.Abs(status.Amount-booking.PaymentPrice) > 0.005 {
+				mismatch.Resolution = "updated; amount differs from booking price"
+			}
+
+			changed, err := applyPaymentStatus(booking, status.Status, "reconcile")
+			if err != nil {
+				report.Errors++
+				mismatch.Resolution = "update failed: " + err.Error()
+			} else if changed {
+				report.Updated++
+				recordPaymentTransaction(paymentTransactionFromStatus(booking, "reconcile", booking.PaymentLinkID, status))
+			} else {
+				mismatch.Resolution = "already updated elsewhere"
+			}
+
+			report.Mismatches = append(report.Mismatches, mismatch)
+			continue
+		}
+
+		holdExpired := booking.HoldExpiresAt != nil && time.Now().After(*booking.HoldExpiresAt)
+		if holdExpired || (pendingTTL > 0 && time.Since(booking.CreatedAt) > pendingTTL) {
+			expired, err := expireBooking(booking, "reconcile", "payment not completed in time")
+			if err != nil {
+				report.Errors++
+				continue
+			}
+			if expired {
+				report.Expired++
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// StartPaymentReconciler runs ReconcilePendingPayments every interval in the
+// background and logs a summary of each pass
+func StartPaymentReconciler(interval, pendingTTL time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			report, err := ReconcilePendingPayments(pendingTTL)
+			if err != nil {
+				fmt.Printf("Reconcile: pass failed: %v\n", err)
+				continue
+			}
+			logReconcileReport(report)
+		}
+	}()
+}
+
+// GetReconcileConfig reads PAYMENT_RECONCILE_INTERVAL (default 10m, 0 disables
+// the background job) and PAYMENT_PENDING_TTL (default 24h)
+func GetReconcileConfig() (time.Duration, time.Duration) {
+	interval := 10 * time.Minute
+	if value := os.Getenv("PAYMENT_RECONCILE_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			interval = parsed
+		}
+	}
+
+	pendingTTL := 24 * time.Hour
+	if value := os.Getenv("PAYMENT_PENDING_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			pendingTTL = parsed
+		}
+	}
+
+	return interval, pendingTTL
+}
+
+func logReconcileReport(report ReconcileReport) {
+	fmt.Printf("Reconcile: checked %d, updated %d, expired %d, errors %d, mismatches %d (%s)\n",
+		report.Checked, report.Updated, report.Expired, report.Errors, len(report.Mismatches),
+		report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+
+	for _, mismatch := range report.Mismatches {
+		fmt.Printf("Reconcile: booking %s was %s, gateway reports %s (₹%.2f vs ₹%.2f): %s\n",
+			mismatch.BookingNumber, mismatch.BookingStatus, mismatch.GatewayStatus,
+			mismatch.BookingAmount, mismatch.GatewayAmount, mismatch.Resolution)
+	}
+}
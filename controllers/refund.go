@@ -0,0 +1,405 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+type CancelBookingRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RefundBookingRequest struct {
+	// Amount to refund; 0 refunds whatever has not been refunded yet
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// CancelBooking lets the owner (or an admin) cancel a booking. Unpaid bookings are
+// cancelled straight away once their payment link is closed; paid ones create
+// a refund request for an admin.
+func CancelBooking(c *gin.Context) {
+	firebaseId := c.GetString("firebaseId")
+
+	var req CancelBookingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+
+	switch booking.Status {
+	case models.BookingStatusCreated, models.BookingStatusAwaitingPayment, models.BookingStatusFailed:
+		// A payment made before the link is closed keeps the booking
+		paid, err := closePaymentLink(booking, "cancel")
+		if err != nil {
+			fmt.Printf("Failed to close payment link %s: %v\n", booking.PaymentLinkID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Could not close the payment link, please try again"})
+			return
+		}
+		if paid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Booking has already been paid, request a cancellation to get a refund"})
+			return
+		}
+
+		cancelled, err := models.TransitionBooking(booking.ID, models.BookingStatusCancelled, firebaseId, req.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+			return
+		}
+		if cancelled {
+			sendBookingCancellationEmail(booking, 0)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "cancelled",
+			"message": "Booking cancelled successfully",
+		})
+	case models.BookingStatusPaid:
+		refund, created, err := models.RequestRefund(booking.ID, models.Refund{
+			Amount:      booking.PaymentPrice,
+			Reason:      req.Reason,
+			RequestedBy: firebaseId,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request cancellation"})
+			return
+		}
+		if !created {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "requested",
+				"message": "Cancellation already requested",
+				"refund":  refund,
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  "requested",
+			"message": "Cancellation requested. You will receive an email once the refund is processed.",
+			"refund":  refund,
+		})
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking cannot be cancelled in its current state"})
+	}
+}
+
+// GetRefunds lists refunds by status for admins, defaulting to the customer
+// requests that are still waiting to be processed
+func GetRefunds(c *gin.Context) {
+	refunds, err := models.GetRefundsByStatus(c.DefaultQuery("status", "requested"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"refunds": refunds,
+	})
+}
+
+// RefundBooking refunds all or part of a paid booking and cancels it. Online
+// bookings are refunded through the payment gateway; a refund whose outcome
+// the gateway left unknown stays pending, and the next call sends it again
+// under the same refund ID. Box office sales are paid back at the counter, so
+// the refund is only recorded. Complimentary bookings were never paid for and
+// are cancelled without a refund. Any open customer request for the booking
+// is processed by this call.
+func RefundBooking(c *gin.Context) {
+	adminId := c.GetString("firebaseId")
+
+	var req RefundBookingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	switch booking.Status {
+	case models.BookingStatusPaid, models.BookingStatusCancelled, models.BookingStatusRefunded:
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid bookings can be refunded"})
+		return
+	}
+
+	var refund models.Refund
+	var ok bool
+	message := "Refund initiated successfully"
+	switch booking.Channel {
+	case models.BookingChannelComplimentary:
+		cancelComplimentaryBooking(c, booking, adminId, req)
+		return
+	case models.BookingChannelBoxOffice:
+		refund, ok = refundBoxOfficeSale(c, booking, adminId, req)
+		message = "Refund recorded, pay it back at the box office"
+	default:
+		refund, ok = refundOnlinePayment(c, booking, adminId, req)
+	}
+	if !ok {
+		return
+	}
+
+	// Any refund cancels the booking; a partial refund keeps a cancellation fee
+	_, err = models.TransitionBooking(booking.ID, models.BookingStatusCancelled, adminId, refund.Reason)
+	if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+		return
+	}
+	if refund.Status == "success" {
+		if err := markBookingRefunded(booking.ID, adminId, refund.RefundID); err != nil {
+			fmt.Printf("Failed to mark booking %s as refunded: %v\n", booking.BookingNumber, err)
+		}
+	}
+
+	if booking.Channel == models.BookingChannelBoxOffice {
+		sendBoxOfficeCancellationEmail(booking, refund.Amount)
+	} else {
+		sendBookingCancellationEmail(booking, refund.Amount)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"refund":  refund,
+	})
+}
+
+// startRefund sets aside the requested amount of the booking for a refund of
+// the given provider order, responding and returning false when it cannot
+func startRefund(c *gin.Context, booking models.Booking, adminId string, req RefundBookingRequest, orderID string) (models.Refund, bool) {
+	refund, remaining, err := models.StartRefund(booking.ID, req.Amount, models.Refund{
+		RequestedBy:     adminId,
+		ProcessedBy:     adminId,
+		ProviderOrderID: orderID,
+		Reason:          req.Reason,
+	})
+	if errors.Is(err, models.ErrRefundExceedsBalance) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":            "Refund amount exceeds the refundable balance",
+			"refundableAmount": remaining,
+		})
+		return models.Refund{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create refund"})
+		return models.Refund{}, false
+	}
+
+	return refund, true
+}
+
+// refundOnlinePayment sends a refund of the booking's paid order to the
+// payment gateway, responding and returning false unless the gateway took it
+func refundOnlinePayment(c *gin.Context, booking models.Booking, adminId string, req RefundBookingRequest) (models.Refund, bool) {
+	// Refunds are issued against the provider order that was paid
+	status, err := config.PaymentGateway.GetLinkStatus(booking.PaymentLinkID)
+	if err != nil || status.Status != "success" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not find the paid order for this booking"})
+		return models.Refund{}, false
+	}
+
+	refund, ok := startRefund(c, booking, adminId, req, status.OrderID)
+	if !ok {
+		return models.Refund{}, false
+	}
+
+	result, err := config.PaymentGateway.Refund(payment.RefundRequest{
+		OrderID:  refund.ProviderOrderID,
+		RefundID: refund.RefundID,
+		Amount:   refund.Amount,
+		Note:     refund.Reason,
+	})
+	if errors.Is(err, payment.ErrInvalidRefund) {
+		refund.Status = "failed"
+		refund.RawPayload = err.Error()
+		if _, err := models.UpdateRefund(refund); err != nil {
+			fmt.Printf("Failed to mark refund %s as failed: %v\n", refund.RefundID, err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Refund was declined by the payment gateway", "refund": refund})
+		return models.Refund{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Could not confirm the refund with the payment gateway, retry to send it again: " + err.Error(),
+			"refund": refund,
+		})
+		return models.Refund{}, false
+	}
+
+	refund.ProviderRefundID = result.ProviderRefundID
+	refund.Status = result.Status
+	refund.RawPayload = result.RawPayload
+	refund, err = models.UpdateRefund(refund)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refund"})
+		return models.Refund{}, false
+	}
+
+	if refund.Status == "failed" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Refund was declined by the payment gateway", "refund": refund})
+		return models.Refund{}, false
+	}
+
+	return refund, true
+}
+
+// refundBoxOfficeSale records a refund of a counter sale. The money goes back
+// the way it was collected, by hand, so the refund is recorded as made
+// against the sale's receipt and shows in the box office totals.
+func refundBoxOfficeSale(c *gin.Context, booking models.Booking, adminId string, req RefundBookingRequest) (models.Refund, bool) {
+	sale, err := models.GetBoxOfficeSaleByBookingID(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get box office sale"})
+		return models.Refund{}, false
+	}
+
+	refund, ok := startRefund(c, booking, adminId, req, sale.ReceiptNumber)
+	if !ok {
+		return models.Refund{}, false
+	}
+
+	refund.Status = "success"
+	refund.RawPayload = "paid back by " + sale.PaymentMethod + " at the box office"
+	refund, err = models.UpdateRefund(refund)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refund"})
+		return models.Refund{}, false
+	}
+
+	return refund, true
+}
+
+// cancelComplimentaryBooking cancels a free booking, giving its seats back to
+// the ticket and its category's quota. There is nothing to refund.
+func cancelComplimentaryBooking(c *gin.Context, booking models.Booking, adminId string, req RefundBookingRequest) {
+	if req.Amount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Complimentary bookings have nothing to refund"})
+		return
+	}
+
+	_, err := models.TransitionBooking(booking.ID, models.BookingStatusCancelled, adminId, req.Reason)
+	if err != nil && !errors.Is(err, models.ErrInvalidTransition) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "cancelled",
+		"message": "Complimentary booking cancelled",
+	})
+}
+
+// RejectRefundRequest declines a customer's open cancellation request
+func RejectRefundRequest(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	refunds, err := models.GetRefundsByBookingID(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get refunds"})
+		return
+	}
+
+	for _, refund := range refunds {
+		if refund.Status != "requested" {
+			continue
+		}
+
+		refund.Status = "rejected"
+		refund.ProcessedBy = c.GetString("firebaseId")
+		refund, err = models.UpdateRefund(refund)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update refund"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Cancellation request rejected",
+			"refund":  refund,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "No open cancellation request for this booking"})
+}
+
+// applyRefundStatus records a refund status reported by the payment gateway
+// and marks the booking refunded once the money has gone back
+func applyRefundStatus(refundID, status, providerRefundID, rawPayload string) error {
+	refund, err := models.GetRefundByRefundID(refundID)
+	if err != nil {
+		return err
+	}
+
+	refund.Status = status
+	if providerRefundID != "" {
+		refund.ProviderRefundID = providerRefundID
+	}
+	refund.RawPayload = rawPayload
+	if _, err := models.UpdateRefund(refund); err != nil {
+		return err
+	}
+
+	if status == "success" {
+		return markBookingRefunded(refund.BookingID, "system:webhook", refund.RefundID)
+	}
+	return nil
+}
+
+// markBookingRefunded moves a cancelled booking to refunded once a refund
+// succeeded. Bookings already refunded by an earlier refund are left alone.
+func markBookingRefunded(bookingID uuid.UUID, actor, refundID string) error {
+	_, err := models.TransitionBooking(bookingID, models.BookingStatusRefunded, actor, "refund "+refundID)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// sendBookingCancellationEmail notifies the customer; refundAmount 0 means
+// nothing was charged
+func sendBookingCancellationEmail(booking models.Booking, refundAmount float64) {
+	amount := ""
+	if refundAmount > 0 {
+		amount = fmt.Sprintf("%.2f", refundAmount)
+	}
+
+	err := helper.SendBookingCancellationEmail(
+		booking.User.Email,
+		booking.User.FullName,
+		booking.BookingNumber,
+		emailEventDetails(booking.Ticket).Name,
+		booking.Ticket.Name,
+		amount,
+	)
+	if err != nil {
+		fmt.Printf("Failed to send cancellation email: %v\n", err)
+	}
+}
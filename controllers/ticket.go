@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jezhtech/prince-group-backend/models"
@@ -22,19 +24,52 @@ func GetTicket(c *gin.Context) {
 		return
 	}
 
+	pricing := ticket.PricingAt(time.Now())
+	ticket.Pricing = &pricing
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"ticket":  ticket,
 	})
 }
 
+// GetPublicTickets lists the tickets of events that are not drafts,
+// optionally only those of ?eventId=
+func GetPublicTickets(c *gin.Context) {
+	listTickets(c, models.GetPublicTickets)
+}
+
+// GetAllTickets lists every ticket, draft events' included, for admins
 func GetAllTickets(c *gin.Context) {
-	tickets, err := models.GetAllTickets()
+	listTickets(c, models.GetAllTickets)
+}
+
+// listTickets responds with the tickets list returns for ?eventId=, each
+// priced as of now
+func listTickets(c *gin.Context, list func(eventID uint) ([]models.Ticket, error)) {
+	var eventID uint64
+	if raw := c.Query("eventId"); raw != "" {
+		var err error
+		eventID, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+			return
+		}
+	}
+
+	tickets, err := list(uint(eventID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tickets"})
 		return
 	}
 
+	// Every ticket is priced at the same moment so the listing is consistent
+	now := time.Now()
+	for i := range tickets {
+		pricing := tickets[i].PricingAt(now)
+		tickets[i].Pricing = &pricing
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"tickets": tickets,
@@ -54,6 +89,14 @@ func CreateTicket(c *gin.Context) {
 	fmt.Printf("Benefits type: %T, value: %+v\n", ticket.Benefits, ticket.Benefits)
 
 	// Validate required fields
+	if ticket.EventID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket event is required"})
+		return
+	}
+	if _, err := models.GetEventByID(*ticket.EventID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event not found"})
+		return
+	}
 	if ticket.Name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ticket name is required"})
 		return
@@ -86,6 +129,14 @@ func CreateTicket(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Available tickets cannot be greater than total tickets"})
 		return
 	}
+	if !validSaleWindow(ticket) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sale end time must be after the sale start time"})
+		return
+	}
+	if msg := validatePurchaseLimits(ticket); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	// Ensure Benefits is not nil and is a proper slice
 	if ticket.Benefits == nil {
@@ -121,12 +172,20 @@ func UpdateTicket(c *gin.Context) {
 
 	// Bind the update data
 	var updateData models.Ticket
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	if err := c.ShouldBindBodyWithJSON(&updateData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
 
 	// Update only the provided fields
+	if updateData.EventID != nil {
+		if _, err := models.GetEventByID(*updateData.EventID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Event not found"})
+			return
+		}
+		existingTicket.EventID = updateData.EventID
+		existingTicket.Event = nil
+	}
 	if updateData.Name != "" {
 		existingTicket.Name = updateData.Name
 	}
@@ -159,18 +218,50 @@ func UpdateTicket(c *gin.Context) {
 	if updateData.Benefits != nil {
 		existingTicket.Benefits = updateData.Benefits
 	}
+	if updateData.SaleStartsAt != nil {
+		existingTicket.SaleStartsAt = updateData.SaleStartsAt
+	}
+	if updateData.SaleEndsAt != nil {
+		existingTicket.SaleEndsAt = updateData.SaleEndsAt
+	}
+	// Purchase limits can be set back to 0 for no limit, so only fields
+	// present in the request change them
+	var limits struct {
+		MaxPerBooking *int `json:"maxPerBooking"`
+		MaxPerUser    *int `json:"maxPerUser"`
+	}
+	if err := c.ShouldBindBodyWithJSON(&limits); err == nil {
+		if limits.MaxPerBooking != nil {
+			existingTicket.MaxPerBooking = *limits.MaxPerBooking
+		}
+		if limits.MaxPerUser != nil {
+			existingTicket.MaxPerUser = *limits.MaxPerUser
+		}
+	}
 
 	// Validate business rules
 	if existingTicket.AvailableTickets > existingTicket.TotalTickets {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Available tickets cannot be greater than total tickets"})
 		return
 	}
+	if !validSaleWindow(existingTicket) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sale end time must be after the sale start time"})
+		return
+	}
+	if msg := validatePurchaseLimits(existingTicket); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
 	updatedTicket, err := models.UpdateTicket(existingTicket)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ticket: " + err.Error()})
 		return
 	}
+	// Extra seats, or a sale window reopened, go to the waitlist first
+	if updatedTicket.AvailableTickets > 0 {
+		go OfferWaitlistSeats(updatedTicket.ID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -204,3 +295,32 @@ func DeleteTicket(c *gin.Context) {
 		"message": "Ticket deleted successfully",
 	})
 }
+
+// validSaleWindow reports whether a ticket's sale window, when both ends are
+// set, ends after it starts
+func validSaleWindow(ticket models.Ticket) bool {
+	return ticket.SaleStartsAt == nil || ticket.SaleEndsAt == nil || ticket.SaleEndsAt.After(*ticket.SaleStartsAt)
+}
+
+// validatePurchaseLimits returns the reason a ticket's purchase limits cannot
+// be saved, or "" when they are valid
+func validatePurchaseLimits(ticket models.Ticket) string {
+	if ticket.MaxPerBooking < 0 || ticket.MaxPerUser < 0 {
+		return "Purchase limits cannot be negative"
+	}
+	if ticket.MaxPerBooking > 0 && ticket.MaxPerUser > 0 && ticket.MaxPerBooking > ticket.MaxPerUser {
+		return "Tickets per booking cannot be more than tickets per user"
+	}
+	return ""
+}
+
+// saleErrorMessage explains to a customer why a ticket cannot be booked now
+func saleErrorMessage(err error) string {
+	if errors.Is(err, models.ErrSaleNotStarted) {
+		return "Ticket sales have not started yet"
+	}
+	if errors.Is(err, models.ErrEventNotOnSale) {
+		return "This event is not open for booking"
+	}
+	return "Ticket sales have ended"
+}
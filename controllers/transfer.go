@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// GetTransferCutoff reads BOOKING_TRANSFER_CUTOFF, how long before an event
+// starts its tickets can no longer be transferred (default 24h)
+func GetTransferCutoff() time.Duration {
+	if value := os.Getenv("BOOKING_TRANSFER_CUTOFF"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return 24 * time.Hour
+}
+
+// transfersClosed reports whether the ticket's transfer cutoff has passed
+func transfersClosed(ticket models.Ticket, now time.Time) bool {
+	closesAt := ticket.TransferCutoff(GetTransferCutoff())
+	return closesAt != nil && !now.Before(*closesAt)
+}
+
+type TransferBookingRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// TransferBooking starts giving a paid booking to someone else by email. The
+// booking stays with its owner until the recipient accepts.
+func TransferBooking(c *gin.Context) {
+	var req TransferBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	email := models.NormalizeEmail(req.Email)
+	if !strings.Contains(email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+	if email == models.NormalizeEmail(booking.User.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot transfer a booking to yourself"})
+		return
+	}
+
+	now := time.Now()
+	if transfersClosed(booking.Ticket, now) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tickets can no longer be transferred for this event"})
+		return
+	}
+
+	transfer, err := models.CreateBookingTransfer(booking, email, booking.Ticket.TransferCutoff(GetTransferCutoff()))
+	if errors.Is(err, models.ErrTransferNotAllowed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only paid bookings that have not been checked in can be transferred"})
+		return
+	}
+	if errors.Is(err, models.ErrTransferPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This booking already has a pending transfer"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transfer"})
+		return
+	}
+
+	go sendTransferOfferEmail(booking, transfer)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"message":  "Transfer sent, it will complete once the recipient accepts it",
+		"transfer": transfer,
+	})
+}
+
+// CancelBookingTransfer withdraws the booking's pending transfer
+func CancelBookingTransfer(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionWrite) {
+		return
+	}
+
+	transfers, err := models.GetBookingTransfers(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transfers"})
+		return
+	}
+
+	for _, transfer := range transfers {
+		if transfer.Status != models.TransferStatusPending {
+			continue
+		}
+
+		transfer, err := models.CancelBookingTransfer(transfer.ID)
+		if errors.Is(err, models.ErrTransferNotPending) {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transfer"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"message":  "Transfer cancelled",
+			"transfer": transfer,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "No pending transfer for this booking"})
+}
+
+// GetBookingTransfers lists every transfer of a booking, its ownership history
+func GetBookingTransfers(c *gin.Context) {
+	booking, err := models.GetBookingByBookingNumber(c.Param("bookingNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+	if !authorizeBooking(c, booking, bookingActionRead) {
+		return
+	}
+
+	transfers, err := models.GetBookingTransfers(booking.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"transfers": transfers,
+	})
+}
+
+// GetIncomingTransfers lists the transfers waiting for the user to accept them
+func GetIncomingTransfers(c *gin.Context) {
+	user, err := models.GetUserByFirebaseId(c.GetString("firebaseId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	transfers, err := models.GetPendingTransfersTo(user.Email, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transfers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"transfers": transfers,
+	})
+}
+
+// AcceptBookingTransfer makes the user the owner of a booking sent to their
+// email and emails them its new passes
+func AcceptBookingTransfer(c *gin.Context) {
+	transferID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	user, err := models.GetUserByFirebaseId(c.GetString("firebaseId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Transfers to other addresses are reported as missing, like other
+	// customers' bookings
+	transfer, err := models.GetBookingTransferByID(uint(transferID))
+	if err != nil || transfer.ToEmail != models.NormalizeEmail(user.Email) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	}
+
+	now := time.Now()
+	if transfer.Booking != nil && transfersClosed(transfer.Booking.Ticket, now) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tickets can no longer be transferred for this event"})
+		return
+	}
+
+	transfer, err = models.AcceptBookingTransfer(transfer.ID, user.FirebaseID, user.Email, now)
+	if errors.Is(err, models.ErrTransferNotPending) {
+		c.JSON(http.StatusGone, gin.H{"error": "This transfer has expired or was cancelled"})
+		return
+	}
+	if errors.Is(err, models.ErrTransferNotAllowed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This booking can no longer be transferred"})
+		return
+	}
+	if errors.Is(err, models.ErrTransferRecipient) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transfer not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept transfer"})
+		return
+	}
+
+	booking, err := models.GetBookingByID(transfer.BookingID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get booking"})
+		return
+	}
+	go sendTicketsTransferredEmail(booking.BookingNumber)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "The tickets are now yours",
+		"transfer": transfer,
+		"booking":  booking,
+	})
+}
+
+func sendTransferOfferEmail(booking models.Booking, transfer models.BookingTransfer) {
+	event := emailEventDetails(booking.Ticket)
+
+	expiresAt := ""
+	if transfer.ExpiresAt != nil {
+		location := eventLocation()
+		if booking.Ticket.Event != nil {
+			location = booking.Ticket.Event.Location()
+		}
+		expiresAt = transfer.ExpiresAt.In(location).Format("Monday, January 2, 2006 at 3:04 PM")
+	}
+
+	acceptURL := fmt.Sprintf("%s/transfers/%d", os.Getenv("FRONTEND_URL"), transfer.ID)
+
+	err := helper.SendTransferOfferEmail(transfer.ToEmail, booking.User.FullName, event.Name, booking.Ticket.Name, booking.TicketCount, acceptURL, expiresAt)
+	if err != nil {
+		fmt.Printf("Failed to send transfer email for booking %s: %v\n", booking.BookingNumber, err)
+	}
+}
+
+func sendTicketsTransferredEmail(bookingNumber string) {
+	booking, err := models.GetBookingWithEmailData(bookingNumber)
+	if err != nil {
+		fmt.Printf("Failed to get booking data for %s: %v\n", bookingNumber, err)
+		return
+	}
+
+	err = helper.SendTicketsTransferredEmail(
+		booking.User.Email,
+		booking.User.FullName,
+		booking.BookingNumber,
+		booking.Ticket.Name,
+		booking.TicketCount,
+		emailEventDetails(booking.Ticket),
+		entryPasses(booking),
+	)
+	if err != nil {
+		fmt.Printf("Failed to send transferred tickets email for booking %s: %v\n", bookingNumber, err)
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -231,7 +232,9 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	// Update only the allowed fields
+	// Update only the allowed fields. Role is never taken from the request;
+	// admins change it with UpdateUserRole, and editing a profile must not
+	// demote admins or scanners.
 	user.FullName = updateData.FullName
 	user.Mobile = updateData.Mobile
 	user.Address = updateData.Address
@@ -240,9 +243,6 @@ func UpdateUser(c *gin.Context) {
 	user.Pincode = updateData.Pincode
 	user.Aadhaar = updateData.Aadhaar
 
-	// Explicitly set role to 'user' to prevent someone from sending role as admin and get easy get the admin access
-	user.Role = "user"
-
 	err = config.DB.Save(&user).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
@@ -302,3 +302,32 @@ func DeleteUser(c *gin.Context) {
 		"message": "User deleted successfully",
 	})
 }
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateUserRole lets an admin grant a role, e.g. scanner for gate staff
+func UpdateUserRole(c *gin.Context) {
+	var req UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if !slices.Contains(models.UserRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	user, err := models.SetUserRole(c.Param("firebaseId"), req.Role)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "User role updated successfully",
+		"user":    user,
+	})
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
+	"gorm.io/gorm"
+)
+
+// GetWaitlistOfferTTL reads WAITLIST_OFFER_TTL, how long a customer on the
+// waitlist has to claim the seats offered to them (default 1h)
+func GetWaitlistOfferTTL() time.Duration {
+	if value := os.Getenv("WAITLIST_OFFER_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return time.Hour
+}
+
+// OfferWaitlistSeats offers a ticket's available seats to the customers
+// waiting for it and emails them their claim links. It is run whenever seats
+// of the ticket may have been given back.
+func OfferWaitlistSeats(ticketID uint) {
+	offers, err := models.OfferWaitlistSeats(ticketID, time.Now(), GetWaitlistOfferTTL())
+	if err != nil {
+		fmt.Printf("Failed to offer waitlist seats of ticket %d: %v\n", ticketID, err)
+		return
+	}
+
+	for _, entry := range offers {
+		if err := sendWaitlistOfferEmail(entry); err != nil {
+			fmt.Printf("Failed to send waitlist offer email for entry %d: %v\n", entry.ID, err)
+		}
+	}
+}
+
+// SweepWaitlists expires unclaimed offers, giving their seats to the next
+// customers in line, and offers any seats that became available without
+// OfferWaitlistSeats being run, such as those released by another process
+func SweepWaitlists() error {
+	if _, err := models.ExpireWaitlistOffers(time.Now()); err != nil {
+		return err
+	}
+
+	ticketIDs, err := models.GetWaitlistedTicketIDs()
+	if err != nil {
+		return err
+	}
+	for _, ticketID := range ticketIDs {
+		OfferWaitlistSeats(ticketID)
+	}
+
+	return nil
+}
+
+func sendWaitlistOfferEmail(entry models.WaitlistEntry) error {
+	event := emailEventDetails(entry.Ticket)
+
+	location := eventLocation()
+	if entry.Ticket.Event != nil {
+		location = entry.Ticket.Event.Location()
+	}
+	expiresAt := ""
+	if entry.OfferExpiresAt != nil {
+		expiresAt = entry.OfferExpiresAt.In(location).Format("Monday, January 2, 2006 at 3:04 PM")
+	}
+
+	claimURL := os.Getenv("FRONTEND_URL") + "/waitlist/claim?token=" + entry.ClaimToken
+
+	return helper.SendWaitlistOfferEmail(entry.User.Email, entry.User.FullName, event.Name, entry.Ticket.Name, entry.TicketCount, claimURL, expiresAt)
+}
+
+type JoinWaitlistRequest struct {
+	TicketID    uint `json:"ticketId" binding:"required"`
+	TicketCount int  `json:"ticketCount" binding:"required"`
+}
+
+// JoinWaitlist puts the customer in line for a ticket that does not have
+// enough seats left for them
+func JoinWaitlist(c *gin.Context) {
+	var req JoinWaitlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.TicketCount < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidTicketCount.Error()})
+		return
+	}
+
+	ticket, err := models.GetTicketByID(req.TicketID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		return
+	}
+	if err := ticket.SaleError(time.Now()); errors.Is(err, models.ErrSaleEnded) || errors.Is(err, models.ErrEventNotOnSale) {
+		c.JSON(http.StatusConflict, gin.H{"error": saleErrorMessage(err)})
+		return
+	}
+	if err := ticket.CheckBookingSize(req.TicketCount); err != nil {
+		respondPurchaseLimitError(c, err)
+		return
+	}
+
+	entry, err := models.JoinWaitlist(models.WaitlistEntry{
+		TicketID:    ticket.ID,
+		UserID:      c.GetString("firebaseId"),
+		TicketCount: req.TicketCount,
+	})
+	if errors.Is(err, models.ErrSeatsAvailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tickets are available, you can book them now"})
+		return
+	}
+	if errors.Is(err, models.ErrAlreadyWaitlisted) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already on the waitlist for this ticket"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		return
+	}
+
+	position, err := models.GetWaitlistPosition(entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get waitlist position"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"message":  "You have joined the waitlist",
+		"entry":    entry,
+		"position": position,
+	})
+}
+
+// GetMyWaitlist lists the customer's waitlist entries with their place in line
+func GetMyWaitlist(c *gin.Context) {
+	entries, err := models.GetUserWaitlistEntries(c.GetString("firebaseId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get waitlist"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		position, err := models.GetWaitlistPosition(entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get waitlist position"})
+			return
+		}
+		result = append(result, gin.H{"entry": entry, "position": position})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"entries": result,
+	})
+}
+
+// LeaveWaitlist takes the customer out of line; seats held for them go to
+// the next customer
+func LeaveWaitlist(c *gin.Context) {
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid waitlist entry ID"})
+		return
+	}
+
+	entry, err := models.GetWaitlistEntryByID(uint(entryID))
+	if err != nil || entry.UserID != c.GetString("firebaseId") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return
+	}
+
+	entry, err = models.LeaveWaitlist(entry.ID)
+	if errors.Is(err, models.ErrWaitlistNotActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are no longer on this waitlist"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "You have left the waitlist",
+		"entry":   entry,
+	})
+}
+
+// GetWaitlistOffer shows the customer the seats held for them by a claim link
+// and what they would pay
+func GetWaitlistOffer(c *gin.Context) {
+	entry, ok := waitlistOffer(c)
+	if !ok {
+		return
+	}
+
+	quote, ok := priceWaitlistOffer(c, entry, c.Query("referralId"), c.Query("couponCode"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"entry":   entry,
+		"quote":   quote,
+	})
+}
+
+type ClaimWaitlistOfferRequest struct {
+	PaymentMethod string `json:"paymentMethod"`
+	ReferralID    string `json:"referralId"`
+	CouponCode    string `json:"couponCode"`
+}
+
+// ClaimWaitlistOffer turns the seats held by a claim link into a booking,
+// which is then paid for like any other
+func ClaimWaitlistOffer(c *gin.Context) {
+	var req ClaimWaitlistOfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	entry, ok := waitlistOffer(c)
+	if !ok {
+		return
+	}
+
+	quote, ok := priceWaitlistOffer(c, entry, req.ReferralID, req.CouponCode)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	holdExpiresAt := now.Add(GetBookingHoldTTL())
+	booking := models.Booking{
+		ReferralID:     req.ReferralID,
+		PaymentMethod:  req.PaymentMethod,
+		PaymentPrice:   quote.Total,
+		FreeTickets:    quote.FreeTickets,
+		PaidTickets:    quote.PaidTickets,
+		UnitPrice:      quote.UnitPrice,
+		PriceTierID:    quote.PriceTierID,
+		CouponID:       quote.CouponID,
+		CouponCode:     quote.CouponCode,
+		DiscountAmount: quote.Discount,
+		HoldExpiresAt:  &holdExpiresAt,
+	}
+
+	bookingNumber, ok := uniqueBookingNumber(c)
+	if !ok {
+		return
+	}
+	booking.BookingNumber = bookingNumber
+
+	booking, err := models.ClaimWaitlistOffer(entry.ClaimToken, c.GetString("firebaseId"), booking, now)
+	if errors.Is(err, models.ErrWaitlistOfferGone) || errors.Is(err, models.ErrWaitlistOfferOwner) {
+		c.JSON(http.StatusGone, gin.H{"error": "This offer has expired or was already claimed"})
+		return
+	}
+	if respondCreateBookingError(c, err) {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"booking": booking,
+		"quote":   quote,
+	})
+}
+
+// waitlistOffer loads the offer in the claim link, responding 404 unless it
+// was made to the requesting customer and 410 once it can no longer be claimed
+func waitlistOffer(c *gin.Context) (models.WaitlistEntry, bool) {
+	entry, err := models.GetWaitlistEntryByClaimToken(c.Param("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && entry.UserID != c.GetString("firebaseId")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist offer not found"})
+		return models.WaitlistEntry{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get waitlist offer"})
+		return models.WaitlistEntry{}, false
+	}
+
+	if entry.Status != models.WaitlistStatusOffered || entry.OfferExpiresAt == nil || !time.Now().Before(*entry.OfferExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "This offer has expired or was already claimed", "status": entry.Status})
+		return models.WaitlistEntry{}, false
+	}
+
+	return entry, true
+}
+
+// priceWaitlistOffer quotes the held seats of an offer. The seats are priced
+// as if they were not held yet, since claiming hands them over to the booking.
+func priceWaitlistOffer(c *gin.Context, entry models.WaitlistEntry, referralCode, couponCode string) (models.PriceQuote, bool) {
+	ticket := entry.Ticket
+	ticket.AvailableTickets += entry.TicketCount
+
+	return priceBooking(c, ticket, entry.TicketCount, referralCode, couponCode, time.Now())
+}
+
+// GetTicketWaitlist lists a ticket's waitlist in line order for admins
+func GetTicketWaitlist(c *gin.Context) {
+	ticketID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	entries, err := models.GetTicketWaitlist(uint(ticketID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"entries": entries,
+	})
+}
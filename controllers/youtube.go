@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
@@ -105,3 +106,22 @@ func checkYouTubeSubscriptionStatus(ctx context.Context, accessToken, channelID
 	// Check if there are any subscriptions (user is subscribed)
 	return len(subscriptionsResponse.Items) > 0, nil
 }
+
+// hasVerifiedYouTubeSubscription confirms with YouTube that the caller follows
+// the event channel (YOUTUBE_CHANNEL_ID) using the X-Google-Access-Token header.
+// Any missing piece or API failure counts as not subscribed.
+func hasVerifiedYouTubeSubscription(c *gin.Context) bool {
+	channelID := os.Getenv("YOUTUBE_CHANNEL_ID")
+	googleAccessToken := c.GetHeader("X-Google-Access-Token")
+	if channelID == "" || googleAccessToken == "" {
+		return false
+	}
+
+	isSubscribed, err := checkYouTubeSubscriptionStatus(c.Request.Context(), googleAccessToken, channelID)
+	if err != nil {
+		fmt.Printf("Failed to verify YouTube subscription: %v\n", err)
+		return false
+	}
+
+	return isSubscribed
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/sendgrid/sendgrid-go"
@@ -135,7 +134,7 @@ func SendOTPEmail(to, otp string) error {
 
 // SendBookingConfirmationEmail sends a booking confirmation email
 func SendBookingConfirmationEmail(to, customerName, bookingID, eventName, eventDate, eventLocation string) error {
-	subject := "Booking Confirmed - Rhythym of Kumari"
+	subject := "Booking Confirmed - " + eventName
 
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -159,7 +158,7 @@ func SendBookingConfirmationEmail(to, customerName, bookingID, eventName, eventD
         <div class="header">
             <div class="success-icon">🎉</div>
             <h1>Booking Confirmed!</h1>
-            <p>Rhythym of Kumari</p>
+            <p>%s</p>
         </div>
         <div class="content">
             <h2>Hello %s!</h2>
@@ -189,7 +188,7 @@ func SendBookingConfirmationEmail(to, customerName, bookingID, eventName, eventD
         </div>
     </div>
 </body>
-</html>`, customerName, bookingID, eventName, eventDate, eventLocation)
+</html>`, eventName, customerName, bookingID, eventName, eventDate, eventLocation)
 
 	return SendEmail(to, subject, htmlBody)
 }
@@ -207,41 +206,41 @@ func generateQRCodeAsBase64(text string) (string, error) {
 	return base64String, nil
 }
 
-// SendPaymentConfirmationEmail sends a payment confirmation email with ticket details
-func SendPaymentConfirmationEmail(to, customerName, bookingNumber, ticketName, ticketCount, totalAmount, eventDate, eventLocation string, freeTickets int) error {
-	subject := "Payment Successful - Rhythym of Kumari"
-
-	// Calculate paid tickets
-	paidTickets := ticketCount
-	if freeTickets > 0 {
-		// Extract the number from ticketCount string (e.g., "5" from "5 tickets")
-		if count, err := strconv.Atoi(strings.Fields(ticketCount)[0]); err == nil {
-			paidTickets = fmt.Sprintf("%d", count-freeTickets)
-		}
-	}
+// EventDetails is what customer emails show about the event a booking is for
+type EventDetails struct {
+	Name  string
+	Date  string
+	Venue string
+	// Artists is left out of the email when empty
+	Artists []string
+}
 
-	// Generate QR code for the booking number
-	qrCodeBase64, err := generateQRCodeAsBase64(bookingNumber)
-	if err != nil {
-		// If QR generation fails, use a placeholder
-		qrCodeBase64 = ""
-		fmt.Printf("Warning: Failed to generate QR code for booking %s: %v\n", bookingNumber, err)
+// EntryPass is one attendee pass in the confirmation email
+type EntryPass struct {
+	Code         string
+	AttendeeName string
+	// QRPayload is what the QR code encodes for the gate scanners
+	QRPayload string
+}
+
+// SendPaymentConfirmationEmail sends a payment confirmation email with ticket
+// details. paidTickets and freeTickets are the split stored on the booking.
+func SendPaymentConfirmationEmail(to, customerName, bookingNumber, ticketName, ticketCount, totalAmount string, event EventDetails, paidTickets, freeTickets int, passes []EntryPass) error {
+	subject := "Payment Successful - " + event.Name
+
+	// Bookings without passes fall back to a single QR code of the booking number
+	if len(passes) == 0 {
+		passes = []EntryPass{{Code: bookingNumber, QRPayload: bookingNumber}}
 	}
 
-	// Create QR code image HTML
 	qrCodeHTML := ""
-	if qrCodeBase64 != "" {
-		qrCodeHTML = fmt.Sprintf(`
-			<div style="background: #fff; border: 1px solid #ddd; border-radius: 8px; padding: 20px; display: inline-block;">
-				<img src="data:image/png;base64,%s" alt="QR Code for Booking %s" style="width: 120px; height: 120px; display: block; margin: 0 auto;" />
-			</div>`, qrCodeBase64, bookingNumber)
-	} else {
-		qrCodeHTML = `
-			<div style="background: #fff; border: 1px solid #ddd; border-radius: 8px; padding: 20px; display: inline-block;">
-				<div style="width: 120px; height: 120px; background: #f8f9fa; border: 2px dashed #adb5bd; border-radius: 8px; display: flex; align-items: center; justify-content: center; color: #666; font-size: 12px;">
-					QR Code<br>Unavailable
-				</div>
-			</div>`
+	for i, pass := range passes {
+		qrCodeHTML += entryPassHTML(pass, i+1, len(passes))
+	}
+
+	artistsHTML := ""
+	if len(event.Artists) > 0 {
+		artistsHTML = "<br>\n                    <strong>Artists:</strong> " + strings.Join(event.Artists, ", ")
 	}
 
 	htmlBody := fmt.Sprintf(`
@@ -306,7 +305,7 @@ func SendPaymentConfirmationEmail(to, customerName, bookingNumber, ticketName, t
                     </div>
                     <div>
                         <strong>Tickets Paid For:</strong><br>
-                        <span style="font-weight: bold;">%s</span>
+                        <span style="font-weight: bold;">%d</span>
                     </div>
                     <div>
                         <strong>Free Tickets:</strong><br>
@@ -316,17 +315,16 @@ func SendPaymentConfirmationEmail(to, customerName, bookingNumber, ticketName, t
             </div>
             
             <div class="event-details">
-                <h3 style="color: #856404; margin-top: 0;">🎵 Event Details</h3>
+                <h3 style="color: #856404; margin-top: 0;">🎵 %s</h3>
                 <div style="margin: 15px 0;">
                     <strong>Date & Time:</strong> %s<br>
-                    <strong>Venue:</strong> %s<br>
-                    <strong>Artists:</strong> Aditya Rkay, Sri Nisha, Aparnaa Pratheep
+                    <strong>Venue:</strong> %s%s
                 </div>
             </div>
             
             <div class="qr-section">
-                <h4 style="margin-top: 0; color: #666;">🎫 Entry Pass</h4>
-                <p style="color: #666; margin-bottom: 20px;">Scan this QR code at the venue for entry</p>
+                <h4 style="margin-top: 0; color: #666;">🎫 Entry Passes</h4>
+                <p style="color: #666; margin-bottom: 20px;">Each QR code admits one person; share them with your group so everyone can enter separately</p>
                 %s
                 <p style="color: #666; font-size: 12px; margin-top: 15px;">
                     <strong>Booking Number:</strong> %s
@@ -364,7 +362,267 @@ func SendPaymentConfirmationEmail(to, customerName, bookingNumber, ticketName, t
 				}())
 			}
 			return ""
-		}(), totalAmount, bookingNumber, paidTickets, freeTickets, eventDate, eventLocation, qrCodeHTML, bookingNumber)
+		}(), totalAmount, bookingNumber, paidTickets, freeTickets, event.Name, event.Date, event.Venue, artistsHTML, qrCodeHTML, bookingNumber)
+
+	return SendEmail(to, subject, htmlBody)
+}
+
+// entryPassHTML renders the QR code of a single pass
+func entryPassHTML(pass EntryPass, number, total int) string {
+	label := fmt.Sprintf("Pass %d of %d", number, total)
+	if pass.AttendeeName != "" {
+		label += " • " + pass.AttendeeName
+	}
+
+	qrCodeBase64, err := generateQRCodeAsBase64(pass.QRPayload)
+	if err != nil {
+		fmt.Printf("Warning: Failed to generate QR code for pass %s: %v\n", pass.Code, err)
+		return fmt.Sprintf(`
+			<div style="background: #fff; border: 1px solid #ddd; border-radius: 8px; padding: 20px; display: inline-block; margin: 10px;">
+				<div style="width: 120px; height: 120px; background: #f8f9fa; border: 2px dashed #adb5bd; border-radius: 8px; display: flex; align-items: center; justify-content: center; color: #666; font-size: 12px;">
+					QR Code<br>Unavailable
+				</div>
+				<p style="color: #666; font-size: 12px; margin: 10px 0 0;">%s<br><span style="font-family: monospace;">%s</span></p>
+			</div>`, label, pass.Code)
+	}
+
+	return fmt.Sprintf(`
+			<div style="background: #fff; border: 1px solid #ddd; border-radius: 8px; padding: 20px; display: inline-block; margin: 10px;">
+				<img src="data:image/png;base64,%s" alt="QR Code for %s" style="width: 120px; height: 120px; display: block; margin: 0 auto;" />
+				<p style="color: #666; font-size: 12px; margin: 10px 0 0;">%s<br><span style="font-family: monospace;">%s</span></p>
+			</div>`, qrCodeBase64, pass.Code, label, pass.Code)
+}
+
+// SendBookingCancellationEmail tells the customer their booking was cancelled
+// and, when refundAmount is not empty, that a refund is on its way
+func SendBookingCancellationEmail(to, customerName, bookingNumber, eventName, ticketName, refundAmount string) error {
+	subject := "Booking Cancelled - " + eventName
+
+	refundHTML := `<p>No payment was taken for this booking, so there is nothing to refund.</p>`
+	if refundAmount != "" {
+		refundHTML = fmt.Sprintf(`
+            <div class="refund-details">
+                <h3>Refund</h3>
+                <p><strong>Amount:</strong> ₹%s</p>
+                <p>The refund has been initiated to your original payment method. Depending on your bank it can take 5-7 working days to reflect in your account.</p>
+            </div>`, refundAmount)
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Booking Cancelled</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #4eb4a7 0%%, #60afb4 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .booking-details { background: white; padding: 20px; border-radius: 10px; margin: 20px 0; border-left: 4px solid #4eb4a7; }
+        .refund-details { background: #fff3cd; border: 1px solid #ffeaa7; padding: 20px; border-radius: 10px; margin: 20px 0; }
+        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Booking Cancelled</h1>
+            <p>%s</p>
+        </div>
+        <div class="content">
+            <h2>Hello %s,</h2>
+            <p>Your booking has been cancelled and its tickets are no longer valid for entry.</p>
+
+            <div class="booking-details">
+                <h3>Booking Details</h3>
+                <p><strong>Booking Number:</strong> %s</p>
+                <p><strong>Ticket:</strong> %s</p>
+            </div>
+            %s
+            <p>If you have any questions, please contact our support team.</p>
+        </div>
+        <div class="footer">
+            <p>© 2024 Prince Group Vista. All rights reserved.</p>
+            <p>This is an automated message, please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>`, eventName, customerName, bookingNumber, ticketName, refundHTML)
+
+	return SendEmail(to, subject, htmlBody)
+}
+
+// SendWaitlistOfferEmail tells a customer on the waitlist that seats are held
+// for them and how long they have to claim them
+func SendWaitlistOfferEmail(to, customerName, eventName, ticketName string, ticketCount int, claimURL, expiresAt string) error {
+	subject := "Tickets Available - " + eventName
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Tickets Available</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #4eb4a7 0%%, #60afb4 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .booking-details { background: white; padding: 20px; border-radius: 10px; margin: 20px 0; border-left: 4px solid #4eb4a7; }
+        .claim-button { display: inline-block; background: #4eb4a7; color: white; padding: 14px 28px; border-radius: 8px; text-decoration: none; font-weight: bold; }
+        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Your Tickets Are Waiting</h1>
+            <p>%s</p>
+        </div>
+        <div class="content">
+            <h2>Hello %s,</h2>
+            <p>Good news! Tickets you were waiting for have become available and we are holding them for you.</p>
+
+            <div class="booking-details">
+                <h3>Held For You</h3>
+                <p><strong>Ticket:</strong> %s</p>
+                <p><strong>Quantity:</strong> %d</p>
+                <p><strong>Claim before:</strong> %s</p>
+            </div>
+
+            <p style="text-align: center;"><a class="claim-button" href="%s">Claim Your Tickets</a></p>
+            <p>If you do not claim them in time, they will be offered to the next person on the waitlist.</p>
+        </div>
+        <div class="footer">
+            <p>© 2024 Prince Group Vista. All rights reserved.</p>
+            <p>This is an automated message, please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>`, eventName, customerName, ticketName, ticketCount, expiresAt, claimURL)
+
+	return SendEmail(to, subject, htmlBody)
+}
+
+// SendTransferOfferEmail tells the recipient of a ticket transfer who is
+// sending them tickets and where to accept them
+func SendTransferOfferEmail(to, senderName, eventName, ticketName string, ticketCount int, acceptURL, expiresAt string) error {
+	subject := senderName + " sent you tickets - " + eventName
+
+	expiryHTML := ""
+	if expiresAt != "" {
+		expiryHTML = fmt.Sprintf(`<p><strong>Accept before:</strong> %s</p>`, expiresAt)
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Tickets Sent To You</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #4eb4a7 0%%, #60afb4 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .booking-details { background: white; padding: 20px; border-radius: 10px; margin: 20px 0; border-left: 4px solid #4eb4a7; }
+        .claim-button { display: inline-block; background: #4eb4a7; color: white; padding: 14px 28px; border-radius: 8px; text-decoration: none; font-weight: bold; }
+        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>You Have Been Sent Tickets</h1>
+            <p>%s</p>
+        </div>
+        <div class="content">
+            <p>%s would like to give you their tickets. Log in with this email address to accept them.</p>
+
+            <div class="booking-details">
+                <h3>Tickets</h3>
+                <p><strong>Ticket:</strong> %s</p>
+                <p><strong>Quantity:</strong> %d</p>
+                %s
+            </div>
+
+            <p style="text-align: center;"><a class="claim-button" href="%s">Accept Tickets</a></p>
+            <p>Once you accept, you will receive your own entry passes by email.</p>
+        </div>
+        <div class="footer">
+            <p>© 2024 Prince Group Vista. All rights reserved.</p>
+            <p>This is an automated message, please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>`, eventName, senderName, ticketName, ticketCount, expiryHTML, acceptURL)
+
+	return SendEmail(to, subject, htmlBody)
+}
+
+// SendTicketsTransferredEmail confirms a transfer to its recipient with the
+// booking's new entry passes
+func SendTicketsTransferredEmail(to, customerName, bookingNumber, ticketName string, ticketCount int, event EventDetails, passes []EntryPass) error {
+	subject := "Your Tickets - " + event.Name
+
+	qrCodeHTML := ""
+	for i, pass := range passes {
+		qrCodeHTML += entryPassHTML(pass, i+1, len(passes))
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Your Tickets</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #4eb4a7 0%%, #60afb4 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .booking-details { background: white; padding: 20px; border-radius: 10px; margin: 20px 0; border-left: 4px solid #4eb4a7; }
+        .qr-section { background: #e9ecef; border: 2px dashed #adb5bd; border-radius: 10px; padding: 30px; text-align: center; margin: 20px 0; }
+        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>The Tickets Are Yours</h1>
+            <p>%s</p>
+        </div>
+        <div class="content">
+            <h2>Hello %s,</h2>
+            <p>You have accepted the tickets sent to you. The passes below are now yours; any passes issued before the transfer no longer work.</p>
+
+            <div class="booking-details">
+                <h3>Booking Details</h3>
+                <p><strong>Booking Number:</strong> %s</p>
+                <p><strong>Ticket:</strong> %s</p>
+                <p><strong>Quantity:</strong> %d</p>
+                <p><strong>Date & Time:</strong> %s</p>
+                <p><strong>Venue:</strong> %s</p>
+            </div>
+
+            <div class="qr-section">
+                <h4 style="margin-top: 0; color: #666;">🎫 Entry Passes</h4>
+                <p style="color: #666; margin-bottom: 20px;">Each QR code admits one person</p>
+                %s
+            </div>
+        </div>
+        <div class="footer">
+            <p>© 2024 Prince Group Vista. All rights reserved.</p>
+            <p>This is an automated message, please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>`, event.Name, customerName, bookingNumber, ticketName, ticketCount, event.Date, event.Venue, qrCodeHTML)
 
 	return SendEmail(to, subject, htmlBody)
 }
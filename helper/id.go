@@ -1,7 +1,9 @@
 package helper
 
 import (
+	cryptorand "crypto/rand"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"strings"
 	"time"
@@ -49,11 +51,40 @@ func GenerateBookingNumber() string {
 	seconds := time.Now().Unix() - epochBase
 
 	// Add randomness in the lower bits
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomBits := int64(r.Intn(1296)) // 36^2 possibilities (2 base36 digits)
+	randomBits := int64(rand.Intn(1296)) // 36^2 possibilities (2 base36 digits)
 
 	// Final number combines time and randomness
 	combined := seconds*1296 + randomBits // max 36^6 = 2,176,782,336 total space
 
 	return toBaseN(combined, 6)
 }
+
+// GeneratePassCode returns a random pass code such as "PS-7K2QX9M4TB". Unlike
+// booking numbers it carries no timestamp, so codes cannot be guessed from
+// one another.
+func GeneratePassCode() string {
+	return "PS-" + randomCode(10)
+}
+
+// randomCode returns length characters drawn uniformly from charset with a
+// cryptographic random source
+func randomCode(length int) string {
+	limit := big.NewInt(base)
+
+	code := make([]byte, length)
+	for i := range code {
+		n, err := cryptorand.Int(cryptorand.Reader, limit)
+		if err != nil {
+			panic(err)
+		}
+		code[i] = charset[n.Int64()]
+	}
+
+	return string(code)
+}
+
+// GenerateClaimToken returns a random token for a waitlist claim link. It is
+// long enough that offers cannot be found by guessing.
+func GenerateClaimToken() string {
+	return "WL-" + randomCode(24)
+}
@@ -0,0 +1,40 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassCode(t *testing.T) {
+	seen := map[string]bool{}
+	counts := map[rune]int{}
+
+	const codes = 20000
+	for i := 0; i < codes; i++ {
+		code := GeneratePassCode()
+		if len(code) != 13 || !strings.HasPrefix(code, "PS-") {
+			t.Fatalf("malformed pass code %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("pass code %q generated twice", code)
+		}
+		seen[code] = true
+
+		for _, r := range code[3:] {
+			if !strings.ContainsRune(charset, r) {
+				t.Fatalf("pass code %q has %q, which is not in the charset", code, r)
+			}
+			counts[r]++
+		}
+	}
+
+	// Every character should come up about as often as any other. Taking a
+	// random byte modulo 36 made the first 4 characters 8/7 times as likely
+	// as the rest, outside this margin.
+	expected := float64(codes*10) / float64(len(charset))
+	for _, r := range charset {
+		if got := float64(counts[r]); got < expected*0.9 || got > expected*1.1 {
+			t.Errorf("%q came up %v times, expected about %v", r, got, expected)
+		}
+	}
+}
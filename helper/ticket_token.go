@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TicketTokenPrefix marks signed ticket tokens, so scanners can tell them
+// apart from plain booking numbers on older tickets
+const TicketTokenPrefix = "PGT1"
+
+var (
+	ErrTicketTokenMalformed  = errors.New("ticket token malformed")
+	ErrTicketTokenUnknownKey = errors.New("ticket token signed with unknown key")
+	ErrTicketTokenInvalid    = errors.New("ticket token signature invalid")
+	ErrTicketKeyMissing      = errors.New("ticket signing key missing")
+)
+
+// TicketClaims is what a ticket QR code vouches for
+type TicketClaims struct {
+	PassCode      string `json:"p"`
+	BookingNumber string `json:"b"`
+	TicketID      uint   `json:"t"`
+	EventID       uint   `json:"e,omitempty"`
+	IssuedAt      int64  `json:"iat"`
+}
+
+// TicketKeyRing holds the Ed25519 keys for ticket tokens. Tokens are signed
+// with the active key; every key in PublicKeys verifies, so tickets issued
+// before a rotation stay valid as long as their public key is kept.
+type TicketKeyRing struct {
+	ActiveKeyID string
+	PrivateKeys map[string]ed25519.PrivateKey
+	PublicKeys  map[string]ed25519.PublicKey
+}
+
+// ParseTicketKeyRing builds a key ring from comma separated "kid:base64" lists.
+// privateKeys holds 32-byte Ed25519 seeds, publicKeys holds public keys of
+// retired signing keys that should still verify.
+func ParseTicketKeyRing(privateKeys, publicKeys, activeKeyID string) (*TicketKeyRing, error) {
+	ring := &TicketKeyRing{
+		ActiveKeyID: activeKeyID,
+		PrivateKeys: make(map[string]ed25519.PrivateKey),
+		PublicKeys:  make(map[string]ed25519.PublicKey),
+	}
+
+	err := parseKeyList(privateKeys, ed25519.SeedSize, func(kid string, seed []byte) {
+		key := ed25519.NewKeyFromSeed(seed)
+		ring.PrivateKeys[kid] = key
+		ring.PublicKeys[kid] = key.Public().(ed25519.PublicKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseKeyList(publicKeys, ed25519.PublicKeySize, func(kid string, key []byte) {
+		if _, ok := ring.PublicKeys[kid]; !ok {
+			ring.PublicKeys[kid] = ed25519.PublicKey(key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ring.PrivateKeys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("%w: active key %q", ErrTicketKeyMissing, activeKeyID)
+	}
+
+	return ring, nil
+}
+
+func parseKeyList(list string, size int, add func(kid string, key []byte)) error {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || strings.Contains(kid, ".") {
+			return fmt.Errorf("invalid ticket key entry %q", entry)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != size {
+			return fmt.Errorf("invalid ticket key %q", kid)
+		}
+
+		add(kid, key)
+	}
+
+	return nil
+}
+
+// GenerateTicketKey returns a new random Ed25519 seed and its public key, both
+// base64 encoded, for adding a key to TICKET_SIGNING_KEYS
+func GenerateTicketKey() (string, string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), nil
+}
+
+// Sign returns a compact token "PGT1.<kid>.<claims>.<signature>" with the
+// claims and signature base64url encoded. A nil ring, as in a process that
+// never loaded the keys, returns ErrTicketKeyMissing.
+func (r *TicketKeyRing) Sign(claims TicketClaims) (string, error) {
+	if r == nil {
+		return "", ErrTicketKeyMissing
+	}
+	key, ok := r.PrivateKeys[r.ActiveKeyID]
+	if !ok {
+		return "", ErrTicketKeyMissing
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := TicketTokenPrefix + "." + r.ActiveKeyID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks a token against every public key of the ring
+func (r *TicketKeyRing) Verify(token string) (TicketClaims, error) {
+	if r == nil {
+		return TicketClaims{}, ErrTicketKeyMissing
+	}
+	return VerifyTicketToken(token, r.PublicKeys)
+}
+
+// VerifyTicketToken checks a token's signature and returns its claims. It only
+// needs the public keys, so scanner devices can run it offline.
+func VerifyTicketToken(token string, publicKeys map[string]ed25519.PublicKey) (TicketClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != TicketTokenPrefix {
+		return TicketClaims{}, ErrTicketTokenMalformed
+	}
+
+	key, ok := publicKeys[parts[1]]
+	if !ok {
+		return TicketClaims{}, ErrTicketTokenUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return TicketClaims{}, ErrTicketTokenMalformed
+	}
+
+	signed := strings.Join(parts[:3], ".")
+	if !ed25519.Verify(key, []byte(signed), signature) {
+		return TicketClaims{}, ErrTicketTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return TicketClaims{}, ErrTicketTokenMalformed
+	}
+
+	var claims TicketClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return TicketClaims{}, ErrTicketTokenMalformed
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,17 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNilTicketKeyRing(t *testing.T) {
+	var ring *TicketKeyRing
+
+	if _, err := ring.Sign(TicketClaims{}); !errors.Is(err, ErrTicketKeyMissing) {
+		t.Errorf("Sign: got %v, want %v", err, ErrTicketKeyMissing)
+	}
+	if _, err := ring.Verify("PGT1.kid.e30.sig"); !errors.Is(err, ErrTicketKeyMissing) {
+		t.Errorf("Verify: got %v, want %v", err, ErrTicketKeyMissing)
+	}
+}
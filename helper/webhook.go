@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrWebhookSignatureMissing = errors.New("webhook signature or timestamp missing")
+	ErrWebhookSignatureInvalid = errors.New("webhook signature mismatch")
+	ErrWebhookTimestampInvalid = errors.New("webhook timestamp invalid")
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside tolerance window")
+	ErrWebhookToleranceInvalid = errors.New("webhook tolerance must be positive")
+)
+
+// SignCashfreeWebhook computes the signature Cashfree sends in the
+// x-webhook-signature header: base64(HMAC-SHA256(secret, timestamp + body))
+func SignCashfreeWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCashfreeWebhookSignature checks a webhook signature in constant time and
+// rejects timestamps further than tolerance from now, so a captured request
+// cannot be replayed later. The timestamp is the raw x-webhook-timestamp header
+// value (milliseconds since epoch; plain seconds are accepted too). A
+// tolerance that is not positive is a configuration error and fails every
+// webhook rather than letting any timestamp through.
+func VerifyCashfreeWebhookSignature(secret, signature, timestamp string, body []byte, now time.Time, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		return ErrWebhookToleranceInvalid
+	}
+	if secret == "" || signature == "" || timestamp == "" {
+		return ErrWebhookSignatureMissing
+	}
+
+	sentAt, err := parseWebhookTimestamp(timestamp)
+	if err != nil {
+		return ErrWebhookTimestampInvalid
+	}
+
+	drift := now.Sub(sentAt)
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	expected := SignCashfreeWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrWebhookSignatureInvalid
+	}
+
+	return nil
+}
+
+func parseWebhookTimestamp(timestamp string) (time.Time, error) {
+	value, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || value <= 0 {
+		return time.Time{}, ErrWebhookTimestampInvalid
+	}
+
+	// Anything below 1e12 is too small to be milliseconds for a current date
+	if value < 1e12 {
+		return time.Unix(value, 0), nil
+	}
+	return time.UnixMilli(value), nil
+}
@@ -0,0 +1,237 @@
+package helper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "cf_test_webhook_secret"
+
+// Sample Cashfree webhooks with the headers they were delivered with, signed
+// with testWebhookSecret
+var (
+	successWebhook = webhookSample{
+		timestamp: "1755178334000",
+		signature: "I3K64ZLjGIe2G/ovedxAYkZhmDL4sLdTXd9ZAOsdebg=",
+		body:      `{"data":{"order":{"order_id":"CFPay_prince_7f3c2a9e","order_amount":1000.00,"order_currency":"INR","order_tags":{"link_id":"5b1f8f0e-2f4c-4a53-9c11-0d5a3c7e2b10"}},"payment":{"cf_payment_id":"5114910433141","payment_status":"SUCCESS","payment_amount":1000.00,"payment_currency":"INR","payment_message":"Transaction Success","payment_time":"2025-08-14T19:02:11+05:30","bank_reference":"422716581232","payment_group":"upi","payment_method":{"upi":{"channel":"collect","upi_id":"customer@okaxis"}}},"customer_details":{"customer_name":"Test Customer","customer_id":"cust_01","customer_email":"customer@example.com","customer_phone":"9999999999"}},"event_time":"2025-08-14T19:02:14+05:30","type":"PAYMENT_SUCCESS_WEBHOOK"}`,
+	}
+	failedWebhook = webhookSample{
+		timestamp: "1755177942000",
+		signature: "4m40Xs6mR3obcrudMbqd3SkefhUsQGZG/MheU/Lu750=",
+		body:      `{"data":{"order":{"order_id":"CFPay_prince_7f3c2a9e","order_amount":1000.00,"order_currency":"INR","order_tags":{"link_id":"5b1f8f0e-2f4c-4a53-9c11-0d5a3c7e2b10"}},"payment":{"cf_payment_id":"5114910433777","payment_status":"FAILED","payment_amount":1000.00,"payment_currency":"INR","payment_message":"Insufficient funds","payment_time":"2025-08-14T18:55:40+05:30","payment_group":"upi"}},"event_time":"2025-08-14T18:55:42+05:30","type":"PAYMENT_FAILED_WEBHOOK"}`,
+	}
+	// successWebhook as sent by integrations that use seconds in x-webhook-timestamp
+	successWebhookSeconds = webhookSample{
+		timestamp: "1755178334",
+		signature: "wzLbMezzbZ8+ZGlQSD2YSPVAvMd/yQVEVikGcaiky+M=",
+		body:      successWebhook.body,
+	}
+)
+
+type webhookSample struct {
+	timestamp string
+	signature string
+	body      string
+}
+
+func TestSignCashfreeWebhook(t *testing.T) {
+	for _, sample := range []webhookSample{successWebhook, failedWebhook, successWebhookSeconds} {
+		got := SignCashfreeWebhook(testWebhookSecret, sample.timestamp, []byte(sample.body))
+		if got != sample.signature {
+			t.Errorf("signature for timestamp %s: got %s, want %s", sample.timestamp, got, sample.signature)
+		}
+	}
+}
+
+func TestVerifyCashfreeWebhookSignature(t *testing.T) {
+	successSentAt := time.UnixMilli(1755178334000)
+	failedSentAt := time.UnixMilli(1755177942000)
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		timestamp string
+		body      string
+		now       time.Time
+		want      error
+	}{
+		{
+			name:      "payment success",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt.Add(2 * time.Second),
+		},
+		{
+			name:      "payment failed",
+			secret:    testWebhookSecret,
+			signature: failedWebhook.signature,
+			timestamp: failedWebhook.timestamp,
+			body:      failedWebhook.body,
+			now:       failedSentAt,
+		},
+		{
+			name:      "timestamp in seconds",
+			secret:    testWebhookSecret,
+			signature: successWebhookSeconds.signature,
+			timestamp: successWebhookSeconds.timestamp,
+			body:      successWebhookSeconds.body,
+			now:       successSentAt,
+		},
+		{
+			name:      "late delivery within tolerance",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt.Add(tolerance),
+		},
+		{
+			name:      "clock behind within tolerance",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt.Add(-4 * time.Minute),
+		},
+		{
+			name:      "tampered amount",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      strings.Replace(successWebhook.body, `"order_amount":1000.00`, `"order_amount":1.00`, 1),
+			now:       successSentAt,
+			want:      ErrWebhookSignatureInvalid,
+		},
+		{
+			name:      "signature of another webhook",
+			secret:    testWebhookSecret,
+			signature: failedWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureInvalid,
+		},
+		{
+			name:      "wrong secret",
+			secret:    "some_other_secret",
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureInvalid,
+		},
+		{
+			name:      "garbage signature",
+			secret:    testWebhookSecret,
+			signature: "not-a-signature",
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureInvalid,
+		},
+		{
+			name:      "replayed with a fresh timestamp",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: "1755182000000",
+			body:      successWebhook.body,
+			now:       time.UnixMilli(1755182000000),
+			want:      ErrWebhookSignatureInvalid,
+		},
+		{
+			name:      "stale timestamp",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt.Add(tolerance + time.Second),
+			want:      ErrWebhookTimestampExpired,
+		},
+		{
+			name:      "stale replay a day later",
+			secret:    testWebhookSecret,
+			signature: failedWebhook.signature,
+			timestamp: failedWebhook.timestamp,
+			body:      failedWebhook.body,
+			now:       failedSentAt.Add(24 * time.Hour),
+			want:      ErrWebhookTimestampExpired,
+		},
+		{
+			name:      "timestamp in the future",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt.Add(-tolerance - time.Second),
+			want:      ErrWebhookTimestampExpired,
+		},
+		{
+			name:      "non-numeric timestamp",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: "2025-08-14T19:02:14+05:30",
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookTimestampInvalid,
+		},
+		{
+			name:      "negative timestamp",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			timestamp: "-1755178334000",
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookTimestampInvalid,
+		},
+		{
+			name:      "missing signature",
+			secret:    testWebhookSecret,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureMissing,
+		},
+		{
+			name:      "missing timestamp",
+			secret:    testWebhookSecret,
+			signature: successWebhook.signature,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureMissing,
+		},
+		{
+			name:      "no secret configured",
+			signature: successWebhook.signature,
+			timestamp: successWebhook.timestamp,
+			body:      successWebhook.body,
+			now:       successSentAt,
+			want:      ErrWebhookSignatureMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyCashfreeWebhookSignature(tt.secret, tt.signature, tt.timestamp, []byte(tt.body), tt.now, tolerance)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCashfreeWebhookSignatureTolerance(t *testing.T) {
+	sentAt := time.UnixMilli(1755178334000)
+
+	for _, tolerance := range []time.Duration{0, -time.Minute} {
+		err := VerifyCashfreeWebhookSignature(testWebhookSecret, successWebhook.signature, successWebhook.timestamp, []byte(successWebhook.body), sentAt, tolerance)
+		if !errors.Is(err, ErrWebhookToleranceInvalid) {
+			t.Errorf("tolerance %v: got %v, want %v", tolerance, err, ErrWebhookToleranceInvalid)
+		}
+	}
+}
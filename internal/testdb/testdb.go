@@ -0,0 +1,210 @@
+// Package testdb connects tests to the Postgres database in TEST_DATABASE_URL
+// and creates the rows they need. Tests using it are skipped when the
+// variable is not set.
+package testdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	once    sync.Once
+	db      *gorm.DB
+	openErr error
+	serial  atomic.Int64
+)
+
+// Open points config.DB at an empty, migrated test database and returns it.
+// Every test binary gets its own schema, so packages tested in parallel do
+// not wipe each other's rows; tables are emptied at the start of each test.
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	once.Do(func() {
+		db, openErr = openSchema(dsn, schemaName())
+		if openErr == nil {
+			openErr = models.Migrate(db)
+		}
+	})
+	if openErr != nil {
+		t.Fatalf("failed to open test database: %v", openErr)
+	}
+
+	tables := []string{}
+	for _, model := range models.MigratedModels() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("failed to parse %T: %v", model, err)
+		}
+		tables = append(tables, stmt.Schema.Table)
+	}
+	if err := db.Exec("TRUNCATE TABLE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+		t.Fatalf("failed to empty test database: %v", err)
+	}
+
+	config.DB = db
+	return db
+}
+
+// schemaName is derived from the test binary, e.g. test_models for models.test
+func schemaName() string {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".test")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+	return "test_" + name
+}
+
+func openSchema(dsn, schema string) (*gorm.DB, error) {
+	quiet := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+
+	base, err := gorm.Open(postgres.Open(dsn), quiet)
+	if err != nil {
+		return nil, err
+	}
+	if err := base.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %q`, schema)).Error; err != nil {
+		return nil, err
+	}
+	if sqlDB, err := base.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	return gorm.Open(postgres.Open(dsn), quiet)
+}
+
+// next returns a number no other fixture of this test binary has used
+func next() int64 {
+	return serial.Add(1)
+}
+
+// CreateUser adds a user with the given role
+func CreateUser(t *testing.T, role string) models.User {
+	t.Helper()
+
+	n := next()
+	user := models.User{
+		UserID:     fmt.Sprintf("user-%d", n),
+		FirebaseID: fmt.Sprintf("firebase-%d", n),
+		Role:       role,
+		FullName:   fmt.Sprintf("Test User %d", n),
+		Email:      fmt.Sprintf("user%d@example.com", n),
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return user
+}
+
+// CreateReferral adds a referral code bookings can point at
+func CreateReferral(t *testing.T) models.Referral {
+	t.Helper()
+
+	referral := models.Referral{
+		ReferralID:  fmt.Sprintf("REF%d", next()),
+		Name:        "Test referral",
+		SocialMedia: "test",
+	}
+	if err := config.DB.Create(&referral).Error; err != nil {
+		t.Fatalf("failed to create referral: %v", err)
+	}
+
+	return referral
+}
+
+// CreateTicket adds a ticket priced at 1000 with the given number of seats
+// for a published event a month away
+func CreateTicket(t *testing.T, seats int) models.Ticket {
+	t.Helper()
+
+	event := models.Event{
+		Name:      fmt.Sprintf("Test Event %d", next()),
+		Venue:     "Test Venue",
+		StartTime: time.Now().AddDate(0, 1, 0),
+		Timezone:  models.DefaultEventTimezone,
+		Status:    models.EventStatusPublished,
+	}
+	if err := config.DB.Create(&event).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+
+	ticket := models.Ticket{
+		EventID:                          &event.ID,
+		Name:                             "General",
+		Price:                            1000,
+		Type:                             "general",
+		Description:                      "Test ticket",
+		Benefits:                         []string{},
+		Status:                           "active",
+		TotalTickets:                     seats,
+		OfferPriceWithReferral:           1000,
+		OfferPriceWithReferralAndYoutube: 1000,
+		AvailableTickets:                 seats,
+	}
+	if err := config.DB.Omit("Event", "PriceTiers").Create(&ticket).Error; err != nil {
+		t.Fatalf("failed to create ticket: %v", err)
+	}
+	ticket.Event = &event
+
+	return ticket
+}
+
+// NewBooking returns an unsaved booking of count seats of the ticket for the
+// user, ready for models.CreateBooking
+func NewBooking(user models.User, referral models.Referral, ticket models.Ticket, count int) models.Booking {
+	return models.Booking{
+		BookingNumber: fmt.Sprintf("TEST%06d", next()),
+		UserID:        user.FirebaseID,
+		ReferralID:    referral.ReferralID,
+		TicketID:      ticket.ID,
+		TicketCount:   count,
+		PaymentMethod: "upi",
+		PaymentPrice:  float64(1000 * count),
+		PaidTickets:   count,
+		UnitPrice:     1000,
+	}
+}
+
+// AvailableSeats reads the ticket's available_tickets straight from the database
+func AvailableSeats(t *testing.T, ticketID uint) int {
+	t.Helper()
+
+	var available int
+	err := config.DB.Model(&models.Ticket{}).Select("available_tickets").Where("id = ?", ticketID).Scan(&available).Error
+	if err != nil {
+		t.Fatalf("failed to read available tickets: %v", err)
+	}
+
+	return available
+}
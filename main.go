@@ -1,18 +1,43 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/models"
 	"github.com/jezhtech/prince-group-backend/routes"
 )
 
 func main() {
+	// "reconcile" runs a single payment reconciliation pass and exits,
+	// e.g. from cron: ./prince-group-backend reconcile
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile()
+		return
+	}
+	// "ticket-keygen" prints a new ticket signing key for TICKET_SIGNING_KEYS
+	if len(os.Args) > 1 && os.Args[1] == "ticket-keygen" {
+		runTicketKeygen()
+		return
+	}
+
 	router := gin.Default()
 	config.InitDatabase()
 	config.InitFirebase()
+	config.InitPaymentGateway()
+	config.InitTicketSigning()
 	InitAutoMigrate()
 
+	// Seats given back by cancellations and expired holds go to the waitlist
+	models.OnSeatsReleased = controllers.OfferWaitlistSeats
+
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
 	corsConfig.AllowCredentials = true
@@ -21,5 +46,48 @@ func main() {
 
 	routes.AppRouter(router)
 
+	if interval, pendingTTL := controllers.GetReconcileConfig(); interval > 0 {
+		controllers.StartPaymentReconciler(interval, pendingTTL)
+	}
+	if interval := controllers.GetHoldSweepInterval(); interval > 0 {
+		controllers.StartHoldSweeper(interval)
+	}
+
 	router.Run(":8000")
 }
+
+func runReconcile() {
+	config.InitDatabase()
+	config.InitPaymentGateway()
+	// Bookings found paid get their passes emailed with signed QR codes
+	config.InitTicketSigning()
+	// Seats of bookings expired here go to the waitlist like in the server.
+	// The hook runs in the background, so the waitlists are swept once more
+	// before exiting in case the process ends before it finishes.
+	models.OnSeatsReleased = controllers.OfferWaitlistSeats
+
+	_, pendingTTL := controllers.GetReconcileConfig()
+	report, err := controllers.ReconcilePendingPayments(pendingTTL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reconcile failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := controllers.SweepWaitlists(); err != nil {
+		fmt.Fprintf(os.Stderr, "Waitlist sweep failed: %v\n", err)
+	}
+
+	output, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(output))
+}
+
+func runTicketKeygen() {
+	seed, public, err := helper.GenerateTicketKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate key: %v\n", err)
+		os.Exit(1)
+	}
+
+	kid := time.Now().Format("20060102")
+	fmt.Printf("TICKET_SIGNING_KEYS entry:  %s:%s\n", kid, seed)
+	fmt.Printf("TICKET_VERIFY_KEYS entry:   %s:%s\n", kid, public)
+}
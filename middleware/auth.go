@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,16 @@ import (
 	"github.com/jezhtech/prince-group-backend/models"
 )
 
+// VerifyIDToken checks a Firebase ID token and returns the UID of its user.
+// Tests replace it so routes can be exercised without Firebase.
+var VerifyIDToken = func(ctx context.Context, idToken string) (string, error) {
+	token, err := config.FirebaseAuth.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return "", err
+	}
+	return token.UID, nil
+}
+
 // JWTMiddleware verifies JWT tokens from the backend OTP system
 func JWTMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -93,14 +104,14 @@ func CombinedAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Try Firebase if JWT failed
-		firebaseToken, err := config.FirebaseAuth.VerifyIDToken(context.Background(), tokenStr)
+		uid, err := VerifyIDToken(context.Background(), tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("firebaseId", firebaseToken.UID)
+		c.Set("firebaseId", uid)
 		c.Set("auth_type", "firebase")
 		c.Next()
 	}
@@ -109,44 +120,61 @@ func CombinedAuthMiddleware() gin.HandlerFunc {
 func UserMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
-		token, err := config.FirebaseAuth.VerifyIDToken(context.Background(), tokenStr)
+		uid, err := VerifyIDToken(context.Background(), tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		c.Set("firebaseId", token.UID)
+		c.Set("firebaseId", uid)
 		c.Next()
 	}
 }
 
-func AdminMiddleware() gin.HandlerFunc {
+// RoleMiddleware allows Firebase users whose role is one of roles and sets
+// user_role for the handlers
+func RoleMiddleware(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
-		token, err := config.FirebaseAuth.VerifyIDToken(context.Background(), tokenStr)
+		uid, err := VerifyIDToken(context.Background(), tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		c.Set("firebaseId", token.UID)
-		user, err := models.GetUserByFirebaseId(token.UID)
+		c.Set("firebaseId", uid)
+		user, err := models.GetUserByFirebaseId(uid)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Forbidden"})
 			c.Abort()
 			return
 		}
 
-		if user.Role != "admin" {
+		if !slices.Contains(roles, user.Role) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 			c.Abort()
 			return
 		}
 
+		c.Set("user_role", user.Role)
 		c.Next()
 	}
 }
 
+func AdminMiddleware() gin.HandlerFunc {
+	return RoleMiddleware("admin")
+}
+
+// ScannerMiddleware allows gate scanner operators and admins
+func ScannerMiddleware() gin.HandlerFunc {
+	return RoleMiddleware("scanner", "admin")
+}
+
+// BoxOfficeMiddleware allows box office operators and admins
+func BoxOfficeMiddleware() gin.HandlerFunc {
+	return RoleMiddleware("box_office", "admin")
+}
+
 // ClientMiddleware allows both admin and regular users to access client endpoints
 func ClientMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -183,7 +211,7 @@ func ClientMiddleware() gin.HandlerFunc {
 		}
 
 		// Try Firebase if JWT failed
-		firebaseToken, err := config.FirebaseAuth.VerifyIDToken(context.Background(), tokenStr)
+		uid, err := VerifyIDToken(context.Background(), tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -191,14 +219,14 @@ func ClientMiddleware() gin.HandlerFunc {
 		}
 
 		// Get user to check role
-		user, err := models.GetUserByFirebaseId(firebaseToken.UID)
+		user, err := models.GetUserByFirebaseId(uid)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
-		c.Set("firebaseId", firebaseToken.UID)
+		c.Set("firebaseId", uid)
 		c.Set("auth_type", "firebase")
 		c.Set("user_role", user.Role)
 		c.Next()
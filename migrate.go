@@ -1,14 +1,35 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/jezhtech/prince-group-backend/config"
 	"github.com/jezhtech/prince-group-backend/models"
 )
 
 func InitAutoMigrate() {
 	// Migrate models in order to handle foreign key dependencies
-	config.DB.AutoMigrate(&models.User{})
-	config.DB.AutoMigrate(&models.Referral{})
-	config.DB.AutoMigrate(&models.Ticket{})
-	config.DB.AutoMigrate(&models.Booking{})
+	if err := models.Migrate(config.DB); err != nil {
+		fmt.Printf("Failed to migrate models: %v\n", err)
+	}
+
+	// Bookings made before the status column existed get it derived from payment_status
+	if err := models.BackfillBookingStatus(); err != nil {
+		fmt.Printf("Failed to backfill booking status: %v\n", err)
+	}
+	// Count legacy bookings against availability so only seats they took are given back
+	if err := models.BackfillSeatsReserved(); err != nil {
+		fmt.Printf("Failed to backfill reserved seats: %v\n", err)
+	}
+	if err := models.BackfillPasses(); err != nil {
+		fmt.Printf("Failed to backfill passes: %v\n", err)
+	}
+	// Tickets created before events existed belong to the first concert
+	if err := models.BackfillTicketEvents(); err != nil {
+		fmt.Printf("Failed to backfill ticket events: %v\n", err)
+	}
+	// The old hard-coded group offer becomes rules on each event
+	if err := models.BackfillGroupOffers(); err != nil {
+		fmt.Printf("Failed to backfill group offers: %v\n", err)
+	}
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Booking struct {
@@ -15,9 +17,36 @@ type Booking struct {
 	TicketID      uint      `gorm:"column:ticket_id;not null" json:"ticketId"`
 	TicketCount   int       `gorm:"column:ticket_count;not null" json:"ticketCount"`
 	PaymentMethod string    `gorm:"column:payment_method;not null;" json:"paymentMethod"`
-	PaymentStatus string    `gorm:"column:payment_status;not null;enum:pending,success,failed" json:"paymentStatus"`
-	PaymentPrice  float64   `gorm:"column:payment_price;not null" json:"paymentPrice"`
-	PaymentLinkID string    `gorm:"column:payment_link_id;not null" json:"paymentLinkId"`
+	// Channel is where the booking came from: online, box_office or
+	// complimentary
+	Channel string `gorm:"column:channel;type:varchar(20);not null;default:'online';index" json:"channel"`
+	// FreeTickets of the TicketCount seats came with a group offer; only
+	// PaidTickets were charged for
+	FreeTickets int `gorm:"column:free_tickets;not null;default:0" json:"freeTickets"`
+	PaidTickets int `gorm:"column:paid_tickets;not null;default:0" json:"paidTickets"`
+	// Status is the booking lifecycle state; change it with TransitionBooking
+	Status BookingStatus `gorm:"column:status;type:varchar(20);not null;default:'created';index" json:"status"`
+	// PaymentStatus mirrors Status for older clients (pending, success, failed,
+	// expired, cancelled or refunded)
+	PaymentStatus string  `gorm:"column:payment_status;not null" json:"paymentStatus"`
+	PaymentPrice  float64 `gorm:"column:payment_price;not null" json:"paymentPrice"`
+	PaymentLinkID string  `gorm:"column:payment_link_id;not null" json:"paymentLinkId"`
+	// UnitPrice is the per-seat price the booking was quoted; PriceTierID is
+	// the tier it came from, nil for the ticket's regular price
+	UnitPrice   int   `gorm:"column:unit_price;not null;default:0" json:"unitPrice"`
+	PriceTierID *uint `gorm:"column:price_tier_id" json:"priceTierId"`
+	// CouponCode, CouponID and DiscountAmount record the promo code applied
+	// to the booking, if any
+	CouponCode     string  `gorm:"column:coupon_code;not null;default:''" json:"couponCode"`
+	CouponID       *uint   `gorm:"column:coupon_id;index" json:"couponId"`
+	DiscountAmount float64 `gorm:"column:discount_amount;not null;default:0" json:"discountAmount"`
+	// HoldExpiresAt is when an unpaid booking gives its seats back; nil for
+	// bookings made before seat holds existed
+	HoldExpiresAt *time.Time `gorm:"column:hold_expires_at;index" json:"holdExpiresAt"`
+	// SeatsReserved is whether the booking's seats are currently taken from
+	// Ticket.AvailableTickets. Unpaid bookings made before seats were reserved
+	// at booking time never took any, so they must not give any back.
+	SeatsReserved bool      `gorm:"column:seats_reserved;not null;default:false" json:"-"`
 	CreatedAt     time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 
@@ -42,7 +71,7 @@ func GetBookingByBookingNumber(bookingNumber string) (Booking, error) {
 
 	err := config.DB.Where("booking_number = ?", bookingNumber).
 		Preload("User").
-		Preload("Ticket").
+		Preload("Ticket.Event").
 		Preload("Referral").
 		First(&booking).Error
 	if err != nil {
@@ -104,22 +133,56 @@ func GetAllBookingsPaginated(page, pageSize int) (PaginatedBookings, error) {
 	}, nil
 }
 
+// CreateBooking stores a new booking in the created status and reserves its
+// seats in the same transaction. It returns ErrSoldOut when the ticket does not
+// have TicketCount seats left and a *PurchaseLimitError when the booking would
+// take its user over a purchase limit.
 func CreateBooking(booking Booking) (Booking, error) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return createBooking(tx, &booking)
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+
+	publishBookingChange("created", booking)
+	return booking, nil
+}
+
+// createBooking is CreateBooking inside the caller's transaction
+func createBooking(tx *gorm.DB, booking *Booking) error {
 	// Generate UUID if not provided
 	if booking.ID == uuid.Nil {
 		booking.ID = uuid.New()
 	}
 
-	err := config.DB.Create(&booking).Error
-	if err != nil {
-		return Booking{}, err
+	if booking.Channel == "" {
+		booking.Channel = BookingChannelOnline
 	}
+	booking.Status = BookingStatusCreated
+	booking.PaymentStatus = booking.Status.PaymentStatus()
 
-	return booking, nil
+	if err := checkPurchaseLimits(tx, *booking); err != nil {
+		return err
+	}
+	if err := reserveSeats(tx, booking.TicketID, booking.TicketCount); err != nil {
+		return err
+	}
+	booking.SeatsReserved = true
+	if err := checkQuotedPriceTier(tx, *booking); err != nil {
+		return err
+	}
+	if err := redeemCoupon(tx, *booking); err != nil {
+		return err
+	}
+
+	return tx.Create(booking).Error
 }
 
+// UpdateBooking saves a booking's details. Status and payment_status are left
+// untouched; they only change through TransitionBooking.
 func UpdateBooking(booking Booking) (Booking, error) {
-	err := config.DB.Save(&booking).Error
+	err := config.DB.Omit("status", "payment_status", clause.Associations).Save(&booking).Error
 	if err != nil {
 		return Booking{}, err
 	}
@@ -127,12 +190,37 @@ func UpdateBooking(booking Booking) (Booking, error) {
 	return booking, nil
 }
 
+// SetBookingPaymentLink points a booking at the payment link it should be paid through
+func SetBookingPaymentLink(id uuid.UUID, linkID string) error {
+	return config.DB.Model(&Booking{}).Where("id = ?", id).Update("payment_link_id", linkID).Error
+}
+
+// DeleteBooking removes a booking and returns any seats it still held
 func DeleteBooking(id uuid.UUID) error {
-	err := config.DB.Delete(&Booking{}, id).Error
+	var booking Booking
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&booking).Error
+		if err != nil {
+			return err
+		}
+
+		if booking.SeatsReserved {
+			if err := releaseSeats(tx, booking.TicketID, booking.TicketCount); err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&Booking{}, id).Error
+	})
 	if err != nil {
 		return err
 	}
 
+	publishBookingChange("deleted", booking)
+	if booking.SeatsReserved {
+		notifySeatsReleased(booking.TicketID)
+	}
 	return nil
 }
 
@@ -146,6 +234,16 @@ func GetBookingsByUserId(userId string) ([]Booking, error) {
 	return bookings, nil
 }
 
+func GetBookingByID(id uuid.UUID) (Booking, error) {
+	var booking Booking
+	err := config.DB.Where("id = ?", id).Preload("User").Preload("Ticket").Preload("Referral").First(&booking).Error
+	if err != nil {
+		return Booking{}, err
+	}
+
+	return booking, nil
+}
+
 func GetBookingByPaymentID(paymentID string) (Booking, error) {
 	var booking Booking
 	err := config.DB.Where("payment_id = ?", paymentID).Preload("User").Preload("Ticket").Preload("Referral").First(&booking).Error
@@ -170,13 +268,40 @@ func GetBookingByOrderID(orderID string) (Booking, error) {
 	return booking, nil
 }
 
-// GetBookingWithEmailData gets booking with preloaded user and ticket data
+// GetPendingBookingsWithPaymentLink returns bookings awaiting payment on a
+// payment link, oldest first, for reconciliation against the payment gateway
+func GetPendingBookingsWithPaymentLink() ([]Booking, error) {
+	var bookings []Booking
+	err := config.DB.Where("status = ? AND payment_link_id <> ''", BookingStatusAwaitingPayment).
+		Order("created_at ASC").
+		Find(&bookings).Error
+	if err != nil {
+		return []Booking{}, err
+	}
+
+	return bookings, nil
+}
+
+// GetExpiredHoldBookings returns unpaid bookings whose seat hold ran out before now
+func GetExpiredHoldBookings(now time.Time) ([]Booking, error) {
+	var bookings []Booking
+	err := config.DB.Where("status IN ? AND hold_expires_at < ?", []BookingStatus{BookingStatusCreated, BookingStatusAwaitingPayment}, now).
+		Order("hold_expires_at ASC").
+		Find(&bookings).Error
+	if err != nil {
+		return []Booking{}, err
+	}
+
+	return bookings, nil
+}
+
+// GetBookingWithEmailData gets booking with preloaded user, ticket and event data
 func GetBookingWithEmailData(bookingNumber string) (Booking, error) {
 	var booking Booking
 
 	err := config.DB.Where("booking_number = ?", bookingNumber).
 		Preload("User").
-		Preload("Ticket").
+		Preload("Ticket.Event").
 		First(&booking).Error
 
 	if err != nil {
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BookingChange describes something that happened to a booking, for live
+// dashboards. Kind is created, status, checked_in or deleted.
+type BookingChange struct {
+	Kind          string        `json:"kind"`
+	BookingID     uuid.UUID     `json:"bookingId"`
+	BookingNumber string        `json:"bookingNumber"`
+	TicketID      uint          `json:"ticketId"`
+	TicketCount   int           `json:"ticketCount"`
+	Status        BookingStatus `json:"status"`
+	At            time.Time     `json:"at"`
+}
+
+var bookingChanges = struct {
+	sync.Mutex
+	subscribers map[chan BookingChange]struct{}
+}{subscribers: make(map[chan BookingChange]struct{})}
+
+// SubscribeBookingChanges returns a channel that receives every booking change
+// in this process and a function to stop the subscription. Slow subscribers
+// miss changes rather than hold up bookings.
+func SubscribeBookingChanges() (<-chan BookingChange, func()) {
+	ch := make(chan BookingChange, 64)
+
+	bookingChanges.Lock()
+	bookingChanges.subscribers[ch] = struct{}{}
+	bookingChanges.Unlock()
+
+	return ch, func() {
+		bookingChanges.Lock()
+		delete(bookingChanges.subscribers, ch)
+		bookingChanges.Unlock()
+	}
+}
+
+// publishBookingChange notifies subscribers; call it after the change is committed
+func publishBookingChange(kind string, booking Booking) {
+	change := BookingChange{
+		Kind:          kind,
+		BookingID:     booking.ID,
+		BookingNumber: booking.BookingNumber,
+		TicketID:      booking.TicketID,
+		TicketCount:   booking.TicketCount,
+		Status:        booking.Status,
+		At:            time.Now(),
+	}
+
+	bookingChanges.Lock()
+	defer bookingChanges.Unlock()
+
+	for ch := range bookingChanges.subscribers {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/jezhtech/prince-group-backend/config"
+)
+
+// BookingStats are the sales and check-in counters of the client dashboard.
+// Complimentary bookings are counted on their own rather than as paid ones,
+// so they never reach revenue, but their passes count towards attendance.
+type BookingStats struct {
+	TotalBookings         int64   `json:"totalBookings"`
+	PaidBookings          int64   `json:"paidBookings"`
+	PendingBookings       int64   `json:"pendingBookings"`
+	FailedBookings        int64   `json:"failedBookings"`
+	ComplimentaryBookings int64   `json:"complimentaryBookings"`
+	TotalTickets          int64   `json:"totalTickets"`
+	PaidTickets           int64   `json:"paidTickets"`
+	PendingTickets        int64   `json:"pendingTickets"`
+	FailedTickets         int64   `json:"failedTickets"`
+	ComplimentaryTickets  int64   `json:"complimentaryTickets"`
+	Revenue               float64 `json:"revenue"`
+	TotalPasses           int64   `json:"totalPasses"`
+	CheckedInPasses       int64   `json:"checkedInPasses"`
+}
+
+// GetBookingStats computes the dashboard counters in the database instead of
+// loading every booking
+func GetBookingStats() (BookingStats, error) {
+	var stats BookingStats
+
+	err := config.DB.Model(&Booking{}).Select(`
+		COUNT(*) AS total_bookings,
+		COUNT(*) FILTER (WHERE payment_status = 'success' AND channel <> @comp) AS paid_bookings,
+		COUNT(*) FILTER (WHERE payment_status = 'pending') AS pending_bookings,
+		COUNT(*) FILTER (WHERE payment_status = 'failed') AS failed_bookings,
+		COUNT(*) FILTER (WHERE payment_status = 'success' AND channel = @comp) AS complimentary_bookings,
+		COALESCE(SUM(ticket_count), 0) AS total_tickets,
+		COALESCE(SUM(ticket_count) FILTER (WHERE payment_status = 'success' AND channel <> @comp), 0) AS paid_tickets,
+		COALESCE(SUM(ticket_count) FILTER (WHERE payment_status = 'pending'), 0) AS pending_tickets,
+		COALESCE(SUM(ticket_count) FILTER (WHERE payment_status = 'failed'), 0) AS failed_tickets,
+		COALESCE(SUM(ticket_count) FILTER (WHERE payment_status = 'success' AND channel = @comp), 0) AS complimentary_tickets,
+		COALESCE(SUM(payment_price) FILTER (WHERE payment_status = 'success' AND channel <> @comp), 0) AS revenue`,
+		sql.Named("comp", BookingChannelComplimentary)).
+		Scan(&stats).Error
+	if err != nil {
+		return BookingStats{}, err
+	}
+
+	err = config.DB.Model(&Pass{}).Select(`
+		COUNT(*) AS total_passes,
+		COUNT(*) FILTER (WHERE status = 'checked_in') AS checked_in_passes`).
+		Where("status <> ?", PassStatusVoid).
+		Scan(&stats).Error
+	if err != nil {
+		return BookingStats{}, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidTransition = errors.New("booking status transition not allowed")
+
+// BookingStatus is the lifecycle state of a booking. It only changes through
+// TransitionBooking, which enforces bookingTransitions and records history.
+type BookingStatus string
+
+const (
+	BookingStatusCreated         BookingStatus = "created"
+	BookingStatusAwaitingPayment BookingStatus = "awaiting_payment"
+	BookingStatusPaid            BookingStatus = "paid"
+	BookingStatusCheckedIn       BookingStatus = "checked_in"
+	BookingStatusFailed          BookingStatus = "failed"
+	BookingStatusExpired         BookingStatus = "expired"
+	BookingStatusCancelled       BookingStatus = "cancelled"
+	BookingStatusRefunded        BookingStatus = "refunded"
+)
+
+// bookingTransitions lists the statuses each status may move to. A payment
+// that lands after a failed attempt or an expired hold is still honoured.
+var bookingTransitions = map[BookingStatus][]BookingStatus{
+	BookingStatusCreated:         {BookingStatusAwaitingPayment, BookingStatusExpired, BookingStatusCancelled},
+	BookingStatusAwaitingPayment: {BookingStatusPaid, BookingStatusFailed, BookingStatusExpired, BookingStatusCancelled},
+	BookingStatusFailed:          {BookingStatusAwaitingPayment, BookingStatusPaid, BookingStatusExpired, BookingStatusCancelled},
+	BookingStatusExpired:         {BookingStatusPaid},
+	BookingStatusPaid:            {BookingStatusCheckedIn, BookingStatusCancelled},
+	BookingStatusCheckedIn:       {},
+	BookingStatusCancelled:       {BookingStatusRefunded},
+	BookingStatusRefunded:        {},
+}
+
+// CanTransition reports whether a booking may move from one status to another
+func CanTransition(from, to BookingStatus) bool {
+	for _, allowed := range bookingTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentStatus is the legacy payment_status value for a booking status
+func (s BookingStatus) PaymentStatus() string {
+	switch s {
+	case BookingStatusCreated, BookingStatusAwaitingPayment:
+		return "pending"
+	case BookingStatusPaid, BookingStatusCheckedIn:
+		return "success"
+	default:
+		return string(s)
+	}
+}
+
+// BookingStatusHistory records every booking status change. Actor is the
+// firebase ID of the user or admin who caused it, or "system:<source>" for
+// payment callbacks, webhooks and background jobs.
+type BookingStatusHistory struct {
+	ID         uint          `gorm:"primaryKey" json:"id"`
+	BookingID  uuid.UUID     `gorm:"type:uuid;not null;index" json:"bookingId"`
+	FromStatus BookingStatus `gorm:"column:from_status;not null" json:"fromStatus"`
+	ToStatus   BookingStatus `gorm:"column:to_status;not null" json:"toStatus"`
+	Actor      string        `gorm:"column:actor;not null" json:"actor"`
+	Reason     string        `gorm:"column:reason" json:"reason"`
+	CreatedAt  time.Time     `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (BookingStatusHistory) TableName() string {
+	return "booking_status_history"
+}
+
+// TransitionBooking moves a booking to the given status if bookingTransitions
+// allows it, keeping payment_status, the ticket's available seats and the
+// booking's passes in step and recording the change in
+// booking_status_history. It reports whether this call changed the booking;
+// a booking already in the target status is left alone, so concurrent
+// callers (callback, webhook, polling) can tell which of them actually made
+// the change. A disallowed move returns ErrInvalidTransition.
+func TransitionBooking(id uuid.UUID, to BookingStatus, actor, reason string) (bool, error) {
+	var booking Booking
+	changed := false
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		booking, changed, err = transitionBooking(tx, id, to, actor, reason)
+		return err
+	})
+
+	if err == nil && changed {
+		publishBookingChange("status", booking)
+		if !bookingHoldsSeats(to) {
+			notifySeatsReleased(booking.TicketID)
+		}
+	}
+
+	return changed, err
+}
+
+// transitionBooking is TransitionBooking inside the caller's transaction. It
+// returns the booking as it is after the transition.
+func transitionBooking(tx *gorm.DB, id uuid.UUID, to BookingStatus, actor, reason string) (Booking, bool, error) {
+	var booking Booking
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&booking).Error
+	if err != nil {
+		return Booking{}, false, err
+	}
+
+	if booking.Status == to {
+		return booking, false, nil
+	}
+	if !CanTransition(booking.Status, to) {
+		return booking, false, ErrInvalidTransition
+	}
+
+	err = tx.Model(&Booking{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         to,
+		"payment_status": to.PaymentStatus(),
+	}).Error
+	if err != nil {
+		return Booking{}, false, err
+	}
+
+	if err := adjustSeats(tx, booking, to); err != nil {
+		return Booking{}, false, err
+	}
+
+	switch to {
+	case BookingStatusPaid:
+		err = issuePasses(tx, booking)
+	case BookingStatusCancelled, BookingStatusRefunded, BookingStatusExpired:
+		err = voidPasses(tx, booking.ID)
+	}
+	if err != nil {
+		return Booking{}, false, err
+	}
+
+	err = tx.Create(&BookingStatusHistory{
+		BookingID:  id,
+		FromStatus: booking.Status,
+		ToStatus:   to,
+		Actor:      actor,
+		Reason:     reason,
+	}).Error
+	if err != nil {
+		return Booking{}, false, err
+	}
+
+	booking.Status = to
+	booking.PaymentStatus = to.PaymentStatus()
+	return booking, true, nil
+}
+
+// GetBookingStatusHistory returns a booking's status changes, oldest first
+func GetBookingStatusHistory(bookingID uuid.UUID) ([]BookingStatusHistory, error) {
+	var history []BookingStatusHistory
+	err := config.DB.Where("booking_id = ?", bookingID).Order("created_at ASC, id ASC").Find(&history).Error
+	if err != nil {
+		return []BookingStatusHistory{}, err
+	}
+
+	return history, nil
+}
+
+// BackfillBookingStatus derives status for bookings created before it existed,
+// which the migration adds as "created". A genuinely new booking is pending
+// without a payment link, so running this again changes nothing.
+func BackfillBookingStatus() error {
+	return config.DB.Exec(`UPDATE bookings SET status = CASE
+			WHEN payment_status = 'pending' THEN 'awaiting_payment'
+			WHEN payment_status = 'success' THEN 'paid'
+			ELSE payment_status
+		END
+		WHERE status = 'created' AND (payment_status <> 'pending' OR payment_link_id <> '')`).Error
+}
+
+// settleBooking moves a booking just made by createBooking straight to paid,
+// for bookings settled without the payment gateway. Its history shows it
+// passing through awaiting_payment like any other booking.
+func settleBooking(tx *gorm.DB, id uuid.UUID, actor, reason string) (Booking, error) {
+	if _, _, err := transitionBooking(tx, id, BookingStatusAwaitingPayment, actor, reason); err != nil {
+		return Booking{}, err
+	}
+
+	booking, _, err := transitionBooking(tx, id, BookingStatusPaid, actor, reason)
+	return booking, err
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrDuplicateReceipt = errors.New("receipt number already recorded")
+
+// Booking channels
+const (
+	BookingChannelOnline        = "online"
+	BookingChannelBoxOffice     = "box_office"
+	BookingChannelComplimentary = "complimentary"
+)
+
+// BoxOfficePaymentMethods are the ways a walk-in customer can pay at the counter
+var BoxOfficePaymentMethods = []string{"cash", "card", "upi"}
+
+// BoxOfficeSale records a booking sold at the counter: who sold it, the
+// receipt handed over and what was collected. The walk-in customer's contact
+// details are kept here because they may not have an account; the booking
+// then belongs to the operator.
+type BoxOfficeSale struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	BookingID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"bookingId"`
+	OperatorID      string    `gorm:"not null;index" json:"operatorId"`
+	ReceiptNumber   string    `gorm:"not null;uniqueIndex" json:"receiptNumber"`
+	PaymentMethod   string    `gorm:"type:varchar(20);not null" json:"paymentMethod"`
+	AmountCollected float64   `gorm:"not null" json:"amountCollected"`
+	CustomerName    string    `gorm:"not null" json:"customerName"`
+	CustomerEmail   string    `gorm:"not null;default:''" json:"customerEmail"`
+	CustomerMobile  string    `gorm:"not null;default:''" json:"customerMobile"`
+	CreatedAt       time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+
+	Booking  *Booking `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+	Operator *User    `gorm:"foreignKey:OperatorID;references:FirebaseID" json:"operator,omitempty"`
+}
+
+// BoxOfficeTotal is what one operator collected with one payment method, and
+// what was paid back for their sales the same way
+type BoxOfficeTotal struct {
+	OperatorID    string  `json:"operatorId"`
+	OperatorName  string  `json:"operatorName"`
+	PaymentMethod string  `json:"paymentMethod"`
+	Sales         int64   `json:"sales"`
+	Tickets       int64   `json:"tickets"`
+	Amount        float64 `json:"amount"`
+	Refunds       int64   `json:"refunds"`
+	Refunded      float64 `json:"refunded"`
+}
+
+// CreateBoxOfficeSale books seats for a walk-in customer and marks them paid
+// in one transaction, recording the sale and a payment ledger entry. The
+// booking is created like an online one, so it takes seats, checks the quoted
+// tier and gets passes; only the per-user purchase limits are left to the
+// operator. It returns ErrDuplicateReceipt when the receipt number was
+// already used.
+func CreateBoxOfficeSale(booking Booking, sale BoxOfficeSale) (Booking, BoxOfficeSale, error) {
+	booking.Channel = BookingChannelBoxOffice
+	booking.PaymentMethod = sale.PaymentMethod
+	booking.PaymentLinkID = ""
+	booking.HoldExpiresAt = nil
+
+	actor := sale.OperatorID
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		err := tx.Model(&BoxOfficeSale{}).Where("receipt_number = ?", sale.ReceiptNumber).Count(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrDuplicateReceipt
+		}
+
+		if err := createBooking(tx, &booking); err != nil {
+			return err
+		}
+
+		booking, err = settleBooking(tx, booking.ID, actor, "paid by "+sale.PaymentMethod+" at the box office")
+		if err != nil {
+			return err
+		}
+
+		sale.BookingID = booking.ID
+		if err := tx.Omit(clause.Associations).Create(&sale).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&PaymentTransaction{
+			BookingID:       booking.ID,
+			Provider:        "box_office",
+			Source:          "box_office",
+			ProviderOrderID: sale.ReceiptNumber,
+			Amount:          sale.AmountCollected,
+			Currency:        "INR",
+			Method:          sale.PaymentMethod,
+			Status:          "success",
+		}).Error
+	})
+	if err != nil {
+		return Booking{}, BoxOfficeSale{}, err
+	}
+
+	publishBookingChange("created", booking)
+	return booking, sale, nil
+}
+
+// GetBoxOfficeSaleByBookingID returns the counter sale behind a booking
+func GetBoxOfficeSaleByBookingID(bookingID uuid.UUID) (BoxOfficeSale, error) {
+	var sale BoxOfficeSale
+
+	err := config.DB.Where("booking_id = ?", bookingID).First(&sale).Error
+	if err != nil {
+		return BoxOfficeSale{}, err
+	}
+
+	return sale, nil
+}
+
+// GetBoxOfficeSales lists the counter sales made between from and to, newest
+// first. An empty operatorID lists every operator's sales.
+func GetBoxOfficeSales(from, to time.Time, operatorID string) ([]BoxOfficeSale, error) {
+	var sales []BoxOfficeSale
+
+	query := config.DB.Where("created_at >= ? AND created_at < ?", from, to)
+	if operatorID != "" {
+		query = query.Where("operator_id = ?", operatorID)
+	}
+
+	err := query.Preload("Booking.Ticket").Preload("Operator").Order("created_at DESC").Find(&sales).Error
+	if err != nil {
+		return []BoxOfficeSale{}, err
+	}
+
+	return sales, nil
+}
+
+// GetBoxOfficeTotals adds up the counter sales made between from and to per
+// operator and payment method, and the refunds of counter sales recorded in
+// the same period as reversals of the operator and payment method of the
+// sale. Sales later refunded stay in the period they were made, so what was
+// collected less what was paid back is the cash each operator should hold.
+// An empty operatorID totals every operator.
+func GetBoxOfficeTotals(from, to time.Time, operatorID string) ([]BoxOfficeTotal, error) {
+	var sales []BoxOfficeTotal
+	query := config.DB.Model(&BoxOfficeSale{}).
+		Select(`box_office_sales.operator_id,
+			COALESCE(users.full_name, '') AS operator_name,
+			box_office_sales.payment_method,
+			COUNT(*) AS sales,
+			COALESCE(SUM(bookings.ticket_count), 0) AS tickets,
+			COALESCE(SUM(box_office_sales.amount_collected), 0) AS amount`).
+		Joins("JOIN bookings ON bookings.id = box_office_sales.booking_id").
+		Joins("LEFT JOIN users ON users.firebase_id = box_office_sales.operator_id").
+		Where("box_office_sales.created_at >= ? AND box_office_sales.created_at < ?", from, to)
+	if operatorID != "" {
+		query = query.Where("box_office_sales.operator_id = ?", operatorID)
+	}
+	err := query.Group("box_office_sales.operator_id, users.full_name, box_office_sales.payment_method").
+		Scan(&sales).Error
+	if err != nil {
+		return []BoxOfficeTotal{}, err
+	}
+
+	var refunds []BoxOfficeTotal
+	query = config.DB.Model(&Refund{}).
+		Select(`box_office_sales.operator_id,
+			COALESCE(users.full_name, '') AS operator_name,
+			box_office_sales.payment_method,
+			COUNT(*) AS refunds,
+			COALESCE(SUM(refunds.amount), 0) AS refunded`).
+		Joins("JOIN box_office_sales ON box_office_sales.booking_id = refunds.booking_id").
+		Joins("LEFT JOIN users ON users.firebase_id = box_office_sales.operator_id").
+		Where("refunds.status = ? AND refunds.updated_at >= ? AND refunds.updated_at < ?", "success", from, to)
+	if operatorID != "" {
+		query = query.Where("box_office_sales.operator_id = ?", operatorID)
+	}
+	err = query.Group("box_office_sales.operator_id, users.full_name, box_office_sales.payment_method").
+		Scan(&refunds).Error
+	if err != nil {
+		return []BoxOfficeTotal{}, err
+	}
+
+	totals := sales
+	for _, refund := range refunds {
+		i := slices.IndexFunc(totals, func(total BoxOfficeTotal) bool {
+			return total.OperatorID == refund.OperatorID && total.PaymentMethod == refund.PaymentMethod
+		})
+		if i < 0 {
+			totals = append(totals, refund)
+			continue
+		}
+		totals[i].Refunds = refund.Refunds
+		totals[i].Refunded = refund.Refunded
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].OperatorName != totals[j].OperatorName {
+			return totals[i].OperatorName < totals[j].OperatorName
+		}
+		if totals[i].OperatorID != totals[j].OperatorID {
+			return totals[i].OperatorID < totals[j].OperatorID
+		}
+		return totals[i].PaymentMethod < totals[j].PaymentMethod
+	})
+	return totals, nil
+}
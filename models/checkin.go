@@ -0,0 +1,416 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPassNotFound         = errors.New("pass not found")
+	ErrPassAlreadyUsed      = errors.New("pass already checked in")
+	ErrPassVoid             = errors.New("pass is void")
+	ErrBookingNotAdmissible = errors.New("booking is not paid")
+	ErrNotEnoughPasses      = errors.New("not enough unused passes on booking")
+	ErrCheckInSynced        = errors.New("check-in already uploaded by the device")
+	ErrPassWrongEvent       = errors.New("pass is for another event")
+)
+
+// Check-in results recorded in the check-in log
+const (
+	CheckInResultAccepted  = "accepted"
+	CheckInResultDuplicate = "duplicate"
+	CheckInResultVoid      = "void"
+	CheckInResultRejected  = "rejected"
+)
+
+// CheckIn is one scan at the gate, whether it admitted someone or not, so
+// disputes at the entrance can be traced afterwards
+type CheckIn struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	PassID     *uint      `gorm:"index" json:"passId"`
+	BookingID  *uuid.UUID `gorm:"type:uuid;index" json:"bookingId"`
+	Code       string     `gorm:"not null" json:"code"`
+	Gate       string     `gorm:"not null" json:"gate"`
+	OperatorID string     `gorm:"column:operator_id;not null" json:"operatorId"`
+	Result     string     `gorm:"not null" json:"result"`                  // accepted, duplicate, void or rejected
+	Source     string     `gorm:"not null;default:'online'" json:"source"` // online or offline
+	// DeviceID and ClientRef identify a record uploaded by a scanner device,
+	// so a retried upload is not merged twice. Scans made online have neither.
+	DeviceID  string    `gorm:"column:device_id;uniqueIndex:idx_check_ins_device_client_ref,where:client_ref <> ''" json:"deviceId,omitempty"`
+	ClientRef string    `gorm:"column:client_ref;uniqueIndex:idx_check_ins_device_client_ref,where:client_ref <> ''" json:"clientRef,omitempty"`
+	ScannedAt time.Time `gorm:"not null" json:"scannedAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// CheckInRequest describes one scan of a pass code at the gates of an event
+type CheckInRequest struct {
+	EventID    uint
+	Code       string
+	Gate       string
+	OperatorID string
+	ScannedAt  time.Time
+	Source     string
+	DeviceID   string
+	ClientRef  string
+}
+
+// CheckInPass admits the holder of a pass. The pass row is locked so the same
+// pass scanned at two gates at once is only admitted once; the other scan gets
+// ErrPassAlreadyUsed together with the pass, whose CheckedInAt and
+// CheckedInGate say where it was used. Scans uploaded later by offline devices
+// are merged by scan time: the earliest scan wins and the one it displaces is
+// flagged as the duplicate. Every outcome is logged. Once all of a booking's
+// passes are used the booking moves to checked_in. A pass for another event
+// is refused with ErrPassWrongEvent. A device record that was already merged
+// changes nothing and returns ErrCheckInSynced.
+func CheckInPass(req CheckInRequest) (Pass, error) {
+	var pass Pass
+	var booking Booking
+	var checkInErr error
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", req.Code).First(&pass).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			checkInErr = ErrPassNotFound
+			return logCheckIn(tx, req, nil, CheckInResultRejected)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", pass.BookingID).First(&booking).Error; err != nil {
+			return err
+		}
+		atEvent, err := ticketAtEvent(tx, booking.TicketID, req.EventID)
+		if err != nil {
+			return err
+		}
+		if !atEvent {
+			checkInErr = ErrPassWrongEvent
+			return logCheckIn(tx, req, &pass, CheckInResultRejected)
+		}
+
+		// An earlier offline scan takes over the check-in from a later one
+		earlier := pass.Status == PassStatusCheckedIn && pass.CheckedInAt != nil && req.ScannedAt.Before(*pass.CheckedInAt)
+		if earlier {
+			err := tx.Model(&CheckIn{}).
+				Where("pass_id = ? AND result = ?", pass.ID, CheckInResultAccepted).
+				Update("result", CheckInResultDuplicate).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case pass.Status == PassStatusCheckedIn && !earlier:
+			checkInErr = ErrPassAlreadyUsed
+			return logCheckIn(tx, req, &pass, CheckInResultDuplicate)
+		case pass.Status == PassStatusVoid:
+			checkInErr = ErrPassVoid
+			return logCheckIn(tx, req, &pass, CheckInResultVoid)
+		case booking.Status != BookingStatusPaid && booking.Status != BookingStatusCheckedIn:
+			checkInErr = ErrBookingNotAdmissible
+			return logCheckIn(tx, req, &pass, CheckInResultRejected)
+		}
+
+		if err := admitPass(tx, req, &pass); err != nil {
+			return err
+		}
+		if earlier {
+			return nil
+		}
+
+		booking, err = completeBookingCheckIn(tx, booking, req)
+		return err
+	})
+	if err != nil {
+		return Pass{}, err
+	}
+
+	if checkInErr == nil {
+		publishBookingChange("checked_in", booking)
+	}
+
+	return pass, checkInErr
+}
+
+// GroupCheckIn is the outcome of a group check-in: the scanned pass and the
+// passes it admitted, or how many were left when there were too few
+type GroupCheckIn struct {
+	Scanned   Pass   `json:"scanned"`
+	Passes    []Pass `json:"passes"`
+	Remaining int    `json:"remaining"`
+}
+
+// CheckInGroup admits count people of a booking from one scanned pass: the
+// scanned pass first, then the booking's other unused passes in seat order.
+// The scanned pass must itself be unused, so a voided or already used QR code
+// never admits anyone on the booking's other passes. Either all count passes
+// are checked in or none are; a refused scan is logged like in CheckInPass,
+// and ErrNotEnoughPasses reports the unused passes in Remaining.
+func CheckInGroup(req CheckInRequest, count int) (GroupCheckIn, error) {
+	var result GroupCheckIn
+	var booking Booking
+	var checkInErr error
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		scanned := &result.Scanned
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", req.Code).First(scanned).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			checkInErr = ErrPassNotFound
+			return logCheckIn(tx, req, nil, CheckInResultRejected)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", scanned.BookingID).First(&booking).Error; err != nil {
+			return err
+		}
+		atEvent, err := ticketAtEvent(tx, booking.TicketID, req.EventID)
+		if err != nil {
+			return err
+		}
+		if !atEvent {
+			checkInErr = ErrPassWrongEvent
+			return logCheckIn(tx, req, scanned, CheckInResultRejected)
+		}
+
+		switch {
+		case scanned.Status == PassStatusCheckedIn:
+			checkInErr = ErrPassAlreadyUsed
+			return logCheckIn(tx, req, scanned, CheckInResultDuplicate)
+		case scanned.Status != PassStatusIssued:
+			checkInErr = ErrPassVoid
+			return logCheckIn(tx, req, scanned, CheckInResultVoid)
+		case booking.Status != BookingStatusPaid && booking.Status != BookingStatusCheckedIn:
+			checkInErr = ErrBookingNotAdmissible
+			return logCheckIn(tx, req, scanned, CheckInResultRejected)
+		}
+
+		var others []Pass
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("booking_id = ? AND status = ? AND id <> ?", scanned.BookingID, PassStatusIssued, scanned.ID).
+			Order("seat_number ASC").
+			Find(&others).Error
+		if err != nil {
+			return err
+		}
+
+		passes := append([]Pass{*scanned}, others...)
+		if len(passes) < count {
+			result.Remaining = len(passes)
+			checkInErr = ErrNotEnoughPasses
+			return nil
+		}
+
+		for i := range passes[:count] {
+			passReq := req
+			passReq.Code = passes[i].Code
+			if err := admitPass(tx, passReq, &passes[i]); err != nil {
+				return err
+			}
+		}
+		result.Passes = passes[:count]
+		result.Scanned = passes[0]
+		result.Remaining = len(passes) - count
+
+		booking, err = completeBookingCheckIn(tx, booking, req)
+		return err
+	})
+	if err != nil {
+		return GroupCheckIn{}, err
+	}
+
+	if checkInErr == nil {
+		publishBookingChange("checked_in", booking)
+	}
+
+	return result, checkInErr
+}
+
+// TicketAtEvent reports whether a ticket is for the given event
+func TicketAtEvent(ticketID, eventID uint) (bool, error) {
+	return ticketAtEvent(config.DB, ticketID, eventID)
+}
+
+func ticketAtEvent(tx *gorm.DB, ticketID, eventID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&Ticket{}).Where("id = ? AND event_id = ?", ticketID, eventID).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// admitPass checks in a pass locked by the caller and logs it as accepted
+func admitPass(tx *gorm.DB, req CheckInRequest, pass *Pass) error {
+	scannedAt := req.ScannedAt
+	pass.Status = PassStatusCheckedIn
+	pass.CheckedInAt = &scannedAt
+	pass.CheckedInGate = req.Gate
+	pass.CheckedInBy = req.OperatorID
+	err := tx.Model(&Pass{}).Where("id = ?", pass.ID).Updates(map[string]interface{}{
+		"status":          pass.Status,
+		"checked_in_at":   pass.CheckedInAt,
+		"checked_in_gate": pass.CheckedInGate,
+		"checked_in_by":   pass.CheckedInBy,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return logCheckIn(tx, req, pass, CheckInResultAccepted)
+}
+
+// completeBookingCheckIn moves the booking to checked_in once none of its
+// passes is left unused, returning the booking as it is afterwards
+func completeBookingCheckIn(tx *gorm.DB, booking Booking, req CheckInRequest) (Booking, error) {
+	var remaining int64
+	err := tx.Model(&Pass{}).Where("booking_id = ? AND status = ?", booking.ID, PassStatusIssued).Count(&remaining).Error
+	if err != nil {
+		return Booking{}, err
+	}
+	if remaining > 0 {
+		return booking, nil
+	}
+
+	updated, changed, err := transitionBooking(tx, booking.ID, BookingStatusCheckedIn, req.OperatorID, "all passes checked in at "+req.Gate)
+	if err != nil && !errors.Is(err, ErrInvalidTransition) {
+		return Booking{}, err
+	}
+	if changed {
+		return updated, nil
+	}
+	return booking, nil
+}
+
+// LogRejectedScan records a scan that never reached a pass, such as a QR
+// code with a bad signature
+func LogRejectedScan(req CheckInRequest) error {
+	return logCheckIn(config.DB, req, nil, CheckInResultRejected)
+}
+
+func logCheckIn(tx *gorm.DB, req CheckInRequest, pass *Pass, result string) error {
+	if req.Source == "" {
+		req.Source = "online"
+	}
+
+	checkIn := CheckIn{
+		Code:       req.Code,
+		Gate:       req.Gate,
+		OperatorID: req.OperatorID,
+		Result:     result,
+		Source:     req.Source,
+		ScannedAt:  req.ScannedAt,
+		DeviceID:   req.DeviceID,
+		ClientRef:  req.ClientRef,
+	}
+	if pass != nil {
+		checkIn.PassID = &pass.ID
+		checkIn.BookingID = &pass.BookingID
+	}
+
+	// Two uploads of the same device record can get past the caller's lookup
+	// at once; the unique client reference lets only the first one through
+	err := tx.Create(&checkIn).Error
+	if err != nil && checkIn.ClientRef != "" && isDuplicateKey(tx, err) {
+		return ErrCheckInSynced
+	}
+	return err
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// prepareCheckInClientRefIndex readies check_ins for the unique index on
+// device records. It drops the index that was not unique and clears the
+// reference of records merged twice before, keeping it on the first, so
+// the unique index can be created.
+func prepareCheckInClientRefIndex(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&CheckIn{}) {
+		return nil
+	}
+	if migrator.HasIndex(&CheckIn{}, "idx_check_in_client_ref") {
+		if err := migrator.DropIndex(&CheckIn{}, "idx_check_in_client_ref"); err != nil {
+			return err
+		}
+	}
+
+	return db.Exec(`UPDATE check_ins SET client_ref = ''
+		WHERE client_ref <> '' AND id NOT IN (
+			SELECT MIN(id) FROM check_ins WHERE client_ref <> '' GROUP BY device_id, client_ref
+		)`).Error
+}
+
+// CheckInProgress counts how many of a booking's valid passes have been used
+type CheckInProgress struct {
+	CheckedIn int64 `json:"checkedIn"`
+	Total     int64 `json:"total"`
+}
+
+func GetCheckInProgress(bookingID uuid.UUID) (CheckInProgress, error) {
+	var progress CheckInProgress
+
+	err := config.DB.Model(&Pass{}).
+		Select("COUNT(*) FILTER (WHERE status = ?) AS checked_in, COUNT(*) AS total", PassStatusCheckedIn).
+		Where("booking_id = ? AND status <> ?", bookingID, PassStatusVoid).
+		Scan(&progress).Error
+	if err != nil {
+		return CheckInProgress{}, err
+	}
+
+	return progress, nil
+}
+
+// GetCheckInByClientRef finds a record already uploaded by a scanner device
+func GetCheckInByClientRef(deviceID, clientRef string) (CheckIn, error) {
+	var checkIn CheckIn
+	err := config.DB.Where("device_id = ? AND client_ref = ?", deviceID, clientRef).First(&checkIn).Error
+	if err != nil {
+		return CheckIn{}, err
+	}
+
+	return checkIn, nil
+}
+
+// ManifestEntry is one admissible pass in the offline scanner manifest
+type ManifestEntry struct {
+	Code          string     `json:"code"`
+	BookingNumber string     `json:"bookingNumber"`
+	SeatNumber    int        `json:"seat"`
+	AttendeeName  string     `json:"attendeeName,omitempty"`
+	Status        PassStatus `json:"status"`
+	CheckedInAt   *time.Time `json:"checkedInAt,omitempty"`
+	CheckedInGate string     `json:"checkedInGate,omitempty"`
+}
+
+// GetCheckInManifest lists every pass of a paid booking for the event that
+// has not been voided, for scanner devices to check tickets while offline
+func GetCheckInManifest(eventID uint) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := config.DB.Model(&Pass{}).
+		Select("passes.code, bookings.booking_number, passes.seat_number, passes.attendee_name, passes.status, passes.checked_in_at, passes.checked_in_gate").
+		Joins("JOIN bookings ON bookings.id = passes.booking_id").
+		Joins("JOIN tickets ON tickets.id = bookings.ticket_id").
+		Where("tickets.event_id = ? AND bookings.status IN ? AND passes.status <> ?", eventID, []BookingStatus{BookingStatusPaid, BookingStatusCheckedIn}, PassStatusVoid).
+		Order("passes.id ASC").
+		Scan(&entries).Error
+	if err != nil {
+		return []ManifestEntry{}, err
+	}
+
+	return entries, nil
+}
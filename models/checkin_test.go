@@ -0,0 +1,157 @@
+package models_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// TestCheckInPassSameUploadConcurrent merges the same offline record from
+// several uploads at once and checks that it is logged and admitted once,
+// with every other upload told it was already synced
+func TestCheckInPassSameUploadConcurrent(t *testing.T) {
+	testdb.Open(t)
+
+	ticket := testdb.CreateTicket(t, 10)
+	booking, err := models.CreateBooking(testdb.NewBooking(testdb.CreateUser(t, "user"), testdb.CreateReferral(t), ticket, 1))
+	if err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+	for _, to := range []models.BookingStatus{models.BookingStatusAwaitingPayment, models.BookingStatusPaid} {
+		if _, err := models.TransitionBooking(booking.ID, to, "test", "test"); err != nil {
+			t.Fatalf("failed to move booking to %s: %v", to, err)
+		}
+	}
+	passes, err := models.GetPassesByBookingID(booking.ID)
+	if err != nil || len(passes) != 1 {
+		t.Fatalf("paid booking has %d passes: %v", len(passes), err)
+	}
+
+	scan := models.CheckInRequest{
+		EventID:    *ticket.EventID,
+		Code:       passes[0].Code,
+		Gate:       "gate-1",
+		OperatorID: "scanner",
+		ScannedAt:  time.Now().Add(-time.Minute),
+		Source:     "offline",
+		DeviceID:   "device-1",
+		ClientRef:  "record-1",
+	}
+
+	const uploads = 10
+	start := make(chan struct{})
+	errs := make([]error, uploads)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = models.CheckInPass(scan)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	accepted := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, models.ErrCheckInSynced):
+			t.Errorf("upload %d: got %v, want %v", i, err, models.ErrCheckInSynced)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("record was admitted %d times, want once", accepted)
+	}
+
+	var logged int64
+	if err := config.DB.Model(&models.CheckIn{}).Where("device_id = ? AND client_ref = ?", scan.DeviceID, scan.ClientRef).Count(&logged).Error; err != nil {
+		t.Fatalf("failed to count check-ins: %v", err)
+	}
+	if logged != 1 {
+		t.Errorf("record was logged %d times, want once", logged)
+	}
+
+	// Another device may use the same reference, and online scans have none
+	other := scan
+	other.DeviceID = "device-2"
+	if _, err := models.CheckInPass(other); !errors.Is(err, models.ErrPassAlreadyUsed) {
+		t.Errorf("record of another device: got %v, want %v", err, models.ErrPassAlreadyUsed)
+	}
+	online := scan
+	online.Source, online.DeviceID, online.ClientRef = "", "", ""
+	for i := 0; i < 2; i++ {
+		if _, err := models.CheckInPass(online); !errors.Is(err, models.ErrPassAlreadyUsed) {
+			t.Errorf("online scan %d: got %v, want %v", i, err, models.ErrPassAlreadyUsed)
+		}
+	}
+}
+
+// TestCheckInPassWrongEvent scans a pass at the gates of another event and
+// checks that it is refused and logged without being used, and that each
+// event's manifest only lists its own passes
+func TestCheckInPassWrongEvent(t *testing.T) {
+	testdb.Open(t)
+
+	ticket, other := testdb.CreateTicket(t, 10), testdb.CreateTicket(t, 10)
+	booking, err := models.CreateBooking(testdb.NewBooking(testdb.CreateUser(t, "user"), testdb.CreateReferral(t), ticket, 2))
+	if err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+	for _, to := range []models.BookingStatus{models.BookingStatusAwaitingPayment, models.BookingStatusPaid} {
+		if _, err := models.TransitionBooking(booking.ID, to, "test", "test"); err != nil {
+			t.Fatalf("failed to move booking to %s: %v", to, err)
+		}
+	}
+	passes, err := models.GetPassesByBookingID(booking.ID)
+	if err != nil || len(passes) != 2 {
+		t.Fatalf("paid booking has %d passes: %v", len(passes), err)
+	}
+
+	scan := models.CheckInRequest{
+		EventID:    *other.EventID,
+		Code:       passes[0].Code,
+		Gate:       "gate-1",
+		OperatorID: "scanner",
+		ScannedAt:  time.Now(),
+	}
+	if _, err := models.CheckInPass(scan); !errors.Is(err, models.ErrPassWrongEvent) {
+		t.Errorf("check in at another event: got %v, want %v", err, models.ErrPassWrongEvent)
+	}
+	if _, err := models.CheckInGroup(scan, 2); !errors.Is(err, models.ErrPassWrongEvent) {
+		t.Errorf("group check in at another event: got %v, want %v", err, models.ErrPassWrongEvent)
+	}
+
+	var rejected int64
+	if err := config.DB.Model(&models.CheckIn{}).Where("code = ? AND result = ?", scan.Code, models.CheckInResultRejected).Count(&rejected).Error; err != nil {
+		t.Fatalf("failed to count check-ins: %v", err)
+	}
+	if rejected != 2 {
+		t.Errorf("%d rejected scans logged, want 2", rejected)
+	}
+
+	if entries, err := models.GetCheckInManifest(*other.EventID); err != nil || len(entries) != 0 {
+		t.Errorf("manifest of the other event has %d passes (%v), want none", len(entries), err)
+	}
+	entries, err := models.GetCheckInManifest(*ticket.EventID)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("manifest of the booked event has %d passes (%v), want 2", len(entries), err)
+	}
+	for _, entry := range entries {
+		if entry.Status != models.PassStatusIssued {
+			t.Errorf("pass %s is %s after scans at another event, want %s", entry.Code, entry.Status, models.PassStatusIssued)
+		}
+	}
+
+	scan.EventID = *ticket.EventID
+	if _, err := models.CheckInPass(scan); err != nil {
+		t.Errorf("check in at the booked event: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCompQuotaExceeded = errors.New("complimentary ticket quota exceeded")
+	ErrCompCategoryInUse = errors.New("complimentary category has tickets issued")
+)
+
+// CompCategory groups the complimentary tickets of an event, such as
+// sponsors, press or the guest list. Quota caps how many tickets the category
+// may give out; 0 means no cap. Issued is filled in when categories are listed.
+type CompCategory struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	EventID     uint      `gorm:"not null;uniqueIndex:idx_comp_categories_event_name" json:"eventId"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_comp_categories_event_name" json:"name"`
+	Description string    `gorm:"not null;default:''" json:"description"`
+	Quota       int       `gorm:"not null;default:0" json:"quota"`
+	Issued      int       `gorm:"-" json:"issued"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Event *Event `gorm:"foreignKey:EventID;references:ID" json:"event,omitempty"`
+}
+
+// ComplimentaryTicket records a free booking given to a guest: its category,
+// why it was given and by whom. Like box office sales, the guest may not have
+// an account, so their details are kept here and the booking then belongs to
+// the issuing admin.
+type ComplimentaryTicket struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	BookingID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"bookingId"`
+	CategoryID uint      `gorm:"not null;index" json:"categoryId"`
+	Reason     string    `gorm:"not null;default:''" json:"reason"`
+	GuestName  string    `gorm:"not null" json:"guestName"`
+	GuestEmail string    `gorm:"not null;default:''" json:"guestEmail"`
+	IssuedBy   string    `gorm:"not null" json:"issuedBy"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
+	Booking  *Booking      `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+	Category *CompCategory `gorm:"foreignKey:CategoryID;references:ID" json:"category,omitempty"`
+}
+
+// compIssued adds up the tickets of the category's complimentary bookings
+// that still hold seats, so cancelled comps go back into the quota
+func compIssued(db *gorm.DB, categoryID uint) (int, error) {
+	var issued int
+	err := db.Model(&ComplimentaryTicket{}).
+		Select("COALESCE(SUM(bookings.ticket_count), 0)").
+		Joins("JOIN bookings ON bookings.id = complimentary_tickets.booking_id").
+		Where("complimentary_tickets.category_id = ? AND bookings.status IN ?", categoryID, seatHoldingStatuses()).
+		Scan(&issued).Error
+	return issued, err
+}
+
+// IssueComplimentaryTickets gives out a batch of complimentary bookings in one
+// category, pairing bookings[i] with comps[i]. Every booking takes its seats
+// and is paid straight away so its passes are issued; either the whole batch
+// is issued or none of it. It returns ErrCompQuotaExceeded when the batch
+// would take the category over its quota and ErrSoldOut when the ticket does
+// not have the seats.
+func IssueComplimentaryTickets(categoryID uint, bookings []Booking, comps []ComplimentaryTicket) ([]ComplimentaryTicket, error) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var category CompCategory
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", categoryID).First(&category).Error
+		if err != nil {
+			return err
+		}
+
+		if category.Quota > 0 {
+			issued, err := compIssued(tx, category.ID)
+			if err != nil {
+				return err
+			}
+			requested := 0
+			for _, booking := range bookings {
+				requested += booking.TicketCount
+			}
+			if issued+requested > category.Quota {
+				return ErrCompQuotaExceeded
+			}
+		}
+
+		for i := range bookings {
+			booking := bookings[i]
+			booking.Channel = BookingChannelComplimentary
+			booking.PaymentMethod = BookingChannelComplimentary
+			booking.PaymentPrice = 0
+			booking.FreeTickets = booking.TicketCount
+			booking.PaidTickets = 0
+			booking.PaymentLinkID = ""
+			booking.HoldExpiresAt = nil
+
+			if err := createBooking(tx, &booking); err != nil {
+				return err
+			}
+			booking, err = settleBooking(tx, booking.ID, comps[i].IssuedBy, "complimentary: "+category.Name)
+			if err != nil {
+				return err
+			}
+
+			comps[i].BookingID = booking.ID
+			comps[i].CategoryID = category.ID
+			if err := tx.Omit(clause.Associations).Create(&comps[i]).Error; err != nil {
+				return err
+			}
+			comps[i].Booking = &booking
+		}
+
+		return nil
+	})
+	if err != nil {
+		return []ComplimentaryTicket{}, err
+	}
+
+	for _, comp := range comps {
+		publishBookingChange("created", *comp.Booking)
+	}
+	return comps, nil
+}
+
+// GetComplimentaryTickets lists the complimentary tickets of a category, or of
+// every category when categoryID is 0, newest first
+func GetComplimentaryTickets(categoryID uint) ([]ComplimentaryTicket, error) {
+	var comps []ComplimentaryTicket
+
+	query := config.DB.Preload("Booking.Ticket").Preload("Category").Order("created_at DESC")
+	if categoryID != 0 {
+		query = query.Where("category_id = ?", categoryID)
+	}
+
+	err := query.Find(&comps).Error
+	if err != nil {
+		return []ComplimentaryTicket{}, err
+	}
+
+	return comps, nil
+}
+
+// GetCompCategories lists complimentary categories with the tickets each has
+// issued, optionally only those of one event
+func GetCompCategories(eventID uint) ([]CompCategory, error) {
+	var categories []CompCategory
+
+	query := config.DB.Order("event_id ASC, name ASC")
+	if eventID != 0 {
+		query = query.Where("event_id = ?", eventID)
+	}
+
+	if err := query.Find(&categories).Error; err != nil {
+		return []CompCategory{}, err
+	}
+
+	for i := range categories {
+		issued, err := compIssued(config.DB, categories[i].ID)
+		if err != nil {
+			return []CompCategory{}, err
+		}
+		categories[i].Issued = issued
+	}
+
+	return categories, nil
+}
+
+func GetCompCategoryByID(id uint) (CompCategory, error) {
+	var category CompCategory
+
+	err := config.DB.Where("id = ?", id).First(&category).Error
+	if err != nil {
+		return CompCategory{}, err
+	}
+
+	category.Issued, err = compIssued(config.DB, category.ID)
+	if err != nil {
+		return CompCategory{}, err
+	}
+
+	return category, nil
+}
+
+func CreateCompCategory(category CompCategory) (CompCategory, error) {
+	err := config.DB.Omit(clause.Associations).Create(&category).Error
+	if err != nil {
+		return CompCategory{}, err
+	}
+
+	return category, nil
+}
+
+func UpdateCompCategory(category CompCategory) (CompCategory, error) {
+	err := config.DB.Omit(clause.Associations).Save(&category).Error
+	if err != nil {
+		return CompCategory{}, err
+	}
+
+	return category, nil
+}
+
+// DeleteCompCategory removes a category that never issued a ticket; the
+// accounting of issued comps depends on their category
+func DeleteCompCategory(id uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&ComplimentaryTicket{}).Where("category_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCompCategoryInUse
+		}
+
+		return tx.Delete(&CompCategory{}, id).Error
+	})
+}
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CouponDiscountType string
+
+const (
+	CouponDiscountPercentage CouponDiscountType = "percentage"
+	CouponDiscountFlat       CouponDiscountType = "flat"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponInactive      = errors.New("coupon is not active")
+	ErrCouponNotStarted    = errors.New("coupon is not valid yet")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this ticket")
+	ErrCouponMinTickets    = errors.New("not enough tickets for this coupon")
+	ErrCouponUsedUp        = errors.New("coupon has been fully redeemed")
+	ErrCouponUserLimit     = errors.New("coupon already used the maximum number of times")
+)
+
+// Coupon is a promo code taking a percentage or a flat amount off the paid
+// tickets of a booking. Limits left at 0 and empty TicketIDs mean no limit.
+// A coupon is used by every booking that holds seats, so a booking that
+// expires or is cancelled gives its use back.
+type Coupon struct {
+	ID           uint               `gorm:"primaryKey" json:"id"`
+	Code         string             `gorm:"not null;unique" json:"code"`
+	Description  string             `json:"description"`
+	DiscountType CouponDiscountType `gorm:"type:varchar(20);not null" json:"discountType"`
+	// DiscountValue is a percentage for percentage coupons and rupees for flat ones
+	DiscountValue float64 `gorm:"not null" json:"discountValue"`
+	// MaxDiscount caps a percentage discount in rupees
+	MaxDiscount    float64    `gorm:"not null;default:0" json:"maxDiscount"`
+	TicketIDs      []uint     `gorm:"serializer:json" json:"ticketIds"`
+	MaxUses        int        `gorm:"not null;default:0" json:"maxUses"`
+	MaxUsesPerUser int        `gorm:"not null;default:0" json:"maxUsesPerUser"`
+	MinTickets     int        `gorm:"not null;default:0" json:"minTickets"`
+	ValidFrom      *time.Time `json:"validFrom"`
+	ValidUntil     *time.Time `json:"validUntil"`
+	// StacksWithReferral lets the coupon apply on top of the referral and
+	// YouTube offer prices; otherwise the customer gets the better of the two
+	StacksWithReferral bool      `gorm:"not null;default:false" json:"stacksWithReferral"`
+	Active             bool      `gorm:"not null" json:"active"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt          time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// NormalizeCouponCode is how coupon codes are stored and looked up, so
+// customers can type them in any case
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CheckApplicable returns why the coupon cannot be used on a booking of
+// ticketCount tickets of ticketID at now, or nil. Usage limits are checked
+// separately by CheckCouponUsage.
+func (c Coupon) CheckApplicable(ticketID uint, ticketCount int, now time.Time) error {
+	if !c.Active {
+		return ErrCouponInactive
+	}
+	if c.ValidFrom != nil && now.Before(*c.ValidFrom) {
+		return ErrCouponNotStarted
+	}
+	if c.ValidUntil != nil && !now.Before(*c.ValidUntil) {
+		return ErrCouponExpired
+	}
+	if len(c.TicketIDs) > 0 && !slices.Contains(c.TicketIDs, ticketID) {
+		return ErrCouponNotApplicable
+	}
+	if ticketCount < c.MinTickets {
+		return ErrCouponMinTickets
+	}
+	return nil
+}
+
+// DiscountFor is the discount on a subtotal, never more than the subtotal
+func (c Coupon) DiscountFor(subtotal float64) float64 {
+	var discount float64
+	switch c.DiscountType {
+	case CouponDiscountPercentage:
+		discount = subtotal * c.DiscountValue / 100
+		if c.MaxDiscount > 0 {
+			discount = math.Min(discount, c.MaxDiscount)
+		}
+	case CouponDiscountFlat:
+		discount = c.DiscountValue
+	}
+
+	return math.Round(math.Min(discount, subtotal)*100) / 100
+}
+
+func GetCouponByCode(code string) (Coupon, error) {
+	var coupon Coupon
+
+	err := config.DB.Where("code = ?", NormalizeCouponCode(code)).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Coupon{}, ErrCouponNotFound
+	}
+	if err != nil {
+		return Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func GetCouponByID(id uint) (Coupon, error) {
+	var coupon Coupon
+
+	err := config.DB.Where("id = ?", id).First(&coupon).Error
+	if err != nil {
+		return Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func GetAllCoupons() ([]Coupon, error) {
+	var coupons []Coupon
+
+	err := config.DB.Order("created_at DESC").Find(&coupons).Error
+	if err != nil {
+		return []Coupon{}, err
+	}
+
+	return coupons, nil
+}
+
+func CreateCoupon(coupon Coupon) (Coupon, error) {
+	coupon.Code = NormalizeCouponCode(coupon.Code)
+
+	err := config.DB.Create(&coupon).Error
+	if err != nil {
+		return Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func UpdateCoupon(coupon Coupon) (Coupon, error) {
+	coupon.Code = NormalizeCouponCode(coupon.Code)
+
+	err := config.DB.Save(&coupon).Error
+	if err != nil {
+		return Coupon{}, err
+	}
+
+	return coupon, nil
+}
+
+func DeleteCoupon(id uint) error {
+	return config.DB.Delete(&Coupon{}, id).Error
+}
+
+// CouponUsage is how often a coupon is in use, overall and by one user
+type CouponUsage struct {
+	Uses     int64 `json:"uses"`
+	UserUses int64 `json:"userUses"`
+}
+
+// GetCouponUsage counts the seat-holding bookings that used a coupon
+func GetCouponUsage(couponID uint, userID string) (CouponUsage, error) {
+	return getCouponUsage(config.DB, couponID, userID)
+}
+
+func getCouponUsage(db *gorm.DB, couponID uint, userID string) (CouponUsage, error) {
+	var usage CouponUsage
+
+	err := db.Model(&Booking{}).
+		Select("COUNT(*) AS uses, COUNT(*) FILTER (WHERE user_id = ?) AS user_uses", userID).
+		Where("coupon_id = ? AND status IN ?", couponID, seatHoldingStatuses()).
+		Scan(&usage).Error
+	if err != nil {
+		return CouponUsage{}, err
+	}
+
+	return usage, nil
+}
+
+// CouponHasBookings reports whether any booking, in any status, used the coupon
+func CouponHasBookings(couponID uint) (bool, error) {
+	var count int64
+	err := config.DB.Model(&Booking{}).Where("coupon_id = ?", couponID).Count(&count).Error
+	return count > 0, err
+}
+
+// CheckCouponUsage returns ErrCouponUsedUp or ErrCouponUserLimit when another
+// booking by userID would go over the coupon's limits
+func CheckCouponUsage(coupon Coupon, userID string) error {
+	usage, err := GetCouponUsage(coupon.ID, userID)
+	if err != nil {
+		return err
+	}
+	return coupon.checkUsage(usage)
+}
+
+func (c Coupon) checkUsage(usage CouponUsage) error {
+	if c.MaxUses > 0 && usage.Uses >= int64(c.MaxUses) {
+		return ErrCouponUsedUp
+	}
+	if c.MaxUsesPerUser > 0 && usage.UserUses >= int64(c.MaxUsesPerUser) {
+		return ErrCouponUserLimit
+	}
+	return nil
+}
+
+// redeemCoupon checks a booking's coupon is still within its limits as the
+// booking is created. The coupon row stays locked until the transaction
+// ends, so concurrent bookings cannot both take its last use.
+func redeemCoupon(tx *gorm.DB, booking Booking) error {
+	if booking.CouponID == nil {
+		return nil
+	}
+
+	var coupon Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *booking.CouponID).First(&coupon).Error
+	if err != nil {
+		return err
+	}
+
+	usage, err := getCouponUsage(tx, coupon.ID, booking.UserID)
+	if err != nil {
+		return err
+	}
+	return coupon.checkUsage(usage)
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+)
+
+type EventStatus string
+
+const (
+	EventStatusDraft     EventStatus = "draft"
+	EventStatusPublished EventStatus = "published"
+	EventStatusCancelled EventStatus = "cancelled"
+	EventStatusCompleted EventStatus = "completed"
+)
+
+var EventStatuses = []EventStatus{EventStatusDraft, EventStatusPublished, EventStatusCancelled, EventStatusCompleted}
+
+var ErrEventHasTickets = errors.New("event still has tickets")
+
+// DefaultEventTimezone is used for events created without a timezone
+const DefaultEventTimezone = "Asia/Kolkata"
+
+// Event is a concert tickets are sold for. Draft events are only visible to
+// admins; everything else is listed publicly.
+type Event struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	Name        string      `gorm:"not null" json:"name"`
+	Description string      `json:"description"`
+	Venue       string      `gorm:"not null" json:"venue"`
+	Address     string      `json:"address"`
+	StartTime   time.Time   `gorm:"not null;index" json:"startTime"`
+	EndTime     *time.Time  `json:"endTime"`
+	Timezone    string      `gorm:"not null;default:'Asia/Kolkata'" json:"timezone"`
+	Status      EventStatus `gorm:"type:varchar(20);not null;default:'draft';index" json:"status"`
+	BannerURL   string      `json:"bannerUrl"`
+	Artists     []string    `gorm:"serializer:json" json:"artists"`
+	// MaxTicketsPerUser caps the tickets one account can hold across all of
+	// the event's ticket types; 0 means no limit
+	MaxTicketsPerUser int       `gorm:"not null;default:0" json:"maxTicketsPerUser"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Tickets []Ticket `gorm:"foreignKey:EventID" json:"tickets,omitempty"`
+}
+
+// Location is the time zone the event's times are shown in at the venue
+func (e Event) Location() *time.Location {
+	name := e.Timezone
+	if name == "" {
+		name = DefaultEventTimezone
+	}
+
+	if location, err := time.LoadLocation(name); err == nil {
+		return location
+	}
+	return time.FixedZone("IST", 5*60*60+30*60)
+}
+
+// DisplayDate formats the start time for customers, e.g.
+// "September 20, 2025 • 5:00 PM"
+func (e Event) DisplayDate() string {
+	return e.StartTime.In(e.Location()).Format("January 2, 2006 • 3:04 PM")
+}
+
+// DisplayVenue is the venue followed by its address when one is set
+func (e Event) DisplayVenue() string {
+	if e.Address == "" {
+		return e.Venue
+	}
+	return e.Venue + ", " + e.Address
+}
+
+func GetEventByID(id uint) (Event, error) {
+	var event Event
+
+	err := config.DB.Where("id = ?", id).First(&event).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// GetPublicEventByID returns a non-draft event with its tickets
+func GetPublicEventByID(id uint) (Event, error) {
+	var event Event
+
+	err := config.DB.Where("id = ? AND status <> ?", id, EventStatusDraft).
+		Preload("Tickets").
+		First(&event).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// GetPublicEvents lists non-draft events, soonest first. Past events are
+// left out unless includePast is set.
+func GetPublicEvents(includePast bool) ([]Event, error) {
+	var events []Event
+
+	query := config.DB.Where("status <> ?", EventStatusDraft)
+	if !includePast {
+		query = query.Where("COALESCE(end_time, start_time) >= ?", time.Now())
+	}
+
+	err := query.Order("start_time ASC").Find(&events).Error
+	if err != nil {
+		return []Event{}, err
+	}
+
+	return events, nil
+}
+
+func GetAllEvents() ([]Event, error) {
+	var events []Event
+
+	err := config.DB.Order("start_time DESC").Find(&events).Error
+	if err != nil {
+		return []Event{}, err
+	}
+
+	return events, nil
+}
+
+func CreateEvent(event Event) (Event, error) {
+	err := config.DB.Create(&event).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+func UpdateEvent(event Event) (Event, error) {
+	err := config.DB.Omit("Tickets").Save(&event).Error
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// DeleteEvent removes an event that no longer has tickets; tickets have to be
+// moved or deleted first so bookings never lose their event
+func DeleteEvent(id uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Ticket{}).Where("event_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEventHasTickets
+		}
+
+		return tx.Delete(&Event{}, id).Error
+	})
+}
+
+// BackfillTicketEvents links tickets created before events existed to the
+// concert this backend was first built for, so their emails keep showing
+// the same date and venue
+func BackfillTicketEvents() error {
+	var count int64
+	if err := config.DB.Model(&Ticket{}).Where("event_id IS NULL").Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		event := Event{
+			Name:     "Rhythym of Kumari",
+			Venue:    "Concordia High School Ground",
+			Address:  "Nagercoil",
+			Timezone: DefaultEventTimezone,
+			Status:   EventStatusPublished,
+			Artists:  []string{"Aditya Rkay", "Sri Nisha", "Aparnaa Pratheep"},
+		}
+		event.StartTime = time.Date(2025, time.September, 20, 17, 0, 0, 0, event.Location())
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&Ticket{}).Where("event_id IS NULL").Update("event_id", event.ID).Error
+	})
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+)
+
+// GroupOfferRule gives free tickets to larger bookings: a booking of at least
+// MinTickets tickets gets FreeTickets of them free. With Repeat the offer
+// applies once per full MinTickets tickets, so "4 get 1" gives 2 free on 8
+// tickets. A rule belongs to either a ticket or a whole event; a ticket's own
+// rules replace its event's, and the most generous matching rule wins, which
+// is how tiers like "4 get 1, 8 get 2" are set up.
+type GroupOfferRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TicketID    *uint     `gorm:"index" json:"ticketId"`
+	EventID     *uint     `gorm:"index" json:"eventId"`
+	Name        string    `gorm:"not null" json:"name"`
+	MinTickets  int       `gorm:"not null" json:"minTickets"`
+	FreeTickets int       `gorm:"not null" json:"freeTickets"`
+	Repeat      bool      `gorm:"not null" json:"repeat"`
+	Active      bool      `gorm:"not null" json:"active"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// FreeTicketsFor is how many of ticketCount tickets the rule makes free. At
+// least one ticket of a booking is always paid for.
+func (r GroupOfferRule) FreeTicketsFor(ticketCount int) int {
+	if !r.Active || r.MinTickets < 1 || ticketCount < r.MinTickets {
+		return 0
+	}
+
+	free := r.FreeTickets
+	if r.Repeat {
+		free *= ticketCount / r.MinTickets
+	}
+	return min(free, ticketCount-1)
+}
+
+// BestGroupOffer picks the rule giving a booking of ticketCount tickets the
+// most free tickets, or nil when none applies
+func BestGroupOffer(rules []GroupOfferRule, ticketCount int) (*GroupOfferRule, int) {
+	var best *GroupOfferRule
+	bestFree := 0
+	for i := range rules {
+		if free := rules[i].FreeTicketsFor(ticketCount); free > bestFree {
+			best, bestFree = &rules[i], free
+		}
+	}
+	return best, bestFree
+}
+
+// GetGroupOfferRulesForTicket returns the active rules that apply to a
+// ticket: its own, or its event's when it has none
+func GetGroupOfferRulesForTicket(ticket Ticket) ([]GroupOfferRule, error) {
+	var rules []GroupOfferRule
+
+	err := config.DB.Where("ticket_id = ? AND active", ticket.ID).Find(&rules).Error
+	if err != nil {
+		return []GroupOfferRule{}, err
+	}
+	if len(rules) > 0 || ticket.EventID == nil {
+		return rules, nil
+	}
+
+	err = config.DB.Where("event_id = ? AND ticket_id IS NULL AND active", *ticket.EventID).Find(&rules).Error
+	if err != nil {
+		return []GroupOfferRule{}, err
+	}
+
+	return rules, nil
+}
+
+// GetGroupOfferRules lists rules, optionally only those of one ticket or event
+func GetGroupOfferRules(ticketID, eventID uint) ([]GroupOfferRule, error) {
+	var rules []GroupOfferRule
+
+	query := config.DB.Order("min_tickets ASC, id ASC")
+	if ticketID != 0 {
+		query = query.Where("ticket_id = ?", ticketID)
+	}
+	if eventID != 0 {
+		query = query.Where("event_id = ?", eventID)
+	}
+
+	err := query.Find(&rules).Error
+	if err != nil {
+		return []GroupOfferRule{}, err
+	}
+
+	return rules, nil
+}
+
+func GetGroupOfferRuleByID(id uint) (GroupOfferRule, error) {
+	var rule GroupOfferRule
+
+	err := config.DB.Where("id = ?", id).First(&rule).Error
+	if err != nil {
+		return GroupOfferRule{}, err
+	}
+
+	return rule, nil
+}
+
+func CreateGroupOfferRule(rule GroupOfferRule) (GroupOfferRule, error) {
+	err := config.DB.Create(&rule).Error
+	if err != nil {
+		return GroupOfferRule{}, err
+	}
+
+	return rule, nil
+}
+
+func UpdateGroupOfferRule(rule GroupOfferRule) (GroupOfferRule, error) {
+	err := config.DB.Save(&rule).Error
+	if err != nil {
+		return GroupOfferRule{}, err
+	}
+
+	return rule, nil
+}
+
+func DeleteGroupOfferRule(id uint) error {
+	return config.DB.Delete(&GroupOfferRule{}, id).Error
+}
+
+// BackfillGroupOffers turns the group offer that used to be hard-coded (4
+// tickets get 1 free, 8 get 2) into rules for every existing event, and
+// records the free and paid split on bookings made before it was stored.
+// The rules are created only once, so rules an admin removed are not brought
+// back; deployments that got them before this was recorded keep theirs.
+func BackfillGroupOffers() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Booking{}).
+			Where("paid_tickets = 0 AND free_tickets = 0").
+			Updates(map[string]interface{}{
+				"free_tickets": gorm.Expr("CASE WHEN ticket_count >= 8 THEN 2 WHEN ticket_count >= 4 THEN 1 ELSE 0 END"),
+				"paid_tickets": gorm.Expr("ticket_count - CASE WHEN ticket_count >= 8 THEN 2 WHEN ticket_count >= 4 THEN 1 ELSE 0 END"),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return runOnce(tx, "group_offer_rules", func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&GroupOfferRule{}).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+
+			var eventIDs []uint
+			if err := tx.Model(&Event{}).Pluck("id", &eventIDs).Error; err != nil {
+				return err
+			}
+			for _, eventID := range eventIDs {
+				id := eventID
+				rules := []GroupOfferRule{
+					{EventID: &id, Name: "Buy 4, get 1 free", MinTickets: 4, FreeTickets: 1, Active: true},
+					{EventID: &id, Name: "Buy 8, get 2 free", MinTickets: 8, FreeTickets: 2, Active: true},
+				}
+				if err := tx.Create(&rules).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
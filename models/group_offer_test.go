@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// TestBackfillGroupOffersOnce checks that the default group offer rules are
+// created on the first startup only, and not again after an admin removed
+// every rule
+func TestBackfillGroupOffersOnce(t *testing.T) {
+	testdb.Open(t)
+	testdb.CreateTicket(t, 10)
+
+	countRules := func() int64 {
+		t.Helper()
+
+		var count int64
+		if err := config.DB.Model(&models.GroupOfferRule{}).Count(&count).Error; err != nil {
+			t.Fatalf("failed to count rules: %v", err)
+		}
+		return count
+	}
+
+	if err := models.BackfillGroupOffers(); err != nil {
+		t.Fatalf("first backfill failed: %v", err)
+	}
+	if count := countRules(); count != 2 {
+		t.Fatalf("first backfill created %d rules, want 2", count)
+	}
+
+	if err := config.DB.Where("1 = 1").Delete(&models.GroupOfferRule{}).Error; err != nil {
+		t.Fatalf("failed to delete rules: %v", err)
+	}
+	if err := models.BackfillGroupOffers(); err != nil {
+		t.Fatalf("second backfill failed: %v", err)
+	}
+	if count := countRules(); count != 0 {
+		t.Errorf("second backfill brought back %d removed rules", count)
+	}
+}
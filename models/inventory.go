@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+)
+
+var ErrSoldOut = errors.New("not enough tickets available")
+
+// bookingHoldsSeats reports whether a booking in the given status occupies
+// seats in Ticket.AvailableTickets. Seats are taken when the booking is
+// created and given back when it leaves these statuses.
+func bookingHoldsSeats(status BookingStatus) bool {
+	return slices.Contains(seatHoldingStatuses(), status)
+}
+
+// seatHoldingStatuses lists the statuses bookingHoldsSeats is true for, for queries
+func seatHoldingStatuses() []BookingStatus {
+	return []BookingStatus{BookingStatusCreated, BookingStatusAwaitingPayment, BookingStatusPaid, BookingStatusCheckedIn}
+}
+
+// reserveSeats takes count seats from the ticket, failing with ErrSoldOut
+// instead of letting availability go below zero. The conditional UPDATE is
+// atomic, so concurrent bookings of the last seats cannot both succeed.
+func reserveSeats(tx *gorm.DB, ticketID uint, count int) error {
+	result := tx.Model(&Ticket{}).
+		Where("id = ? AND available_tickets >= ?", ticketID, count).
+		Update("available_tickets", gorm.Expr("available_tickets - ?", count))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSoldOut
+	}
+
+	return nil
+}
+
+// releaseSeats gives count seats back to the ticket
+func releaseSeats(tx *gorm.DB, ticketID uint, count int) error {
+	return tx.Model(&Ticket{}).
+		Where("id = ?", ticketID).
+		Update("available_tickets", gorm.Expr("available_tickets + ?", count)).Error
+}
+
+// OnSeatsReleased, when set, is called in the background after a committed
+// change may have given seats of a ticket back, so they can be offered to
+// the ticket's waitlist
+var OnSeatsReleased func(ticketID uint)
+
+func notifySeatsReleased(ticketID uint) {
+	if OnSeatsReleased != nil {
+		go OnSeatsReleased(ticketID)
+	}
+}
+
+// adjustSeats keeps the ticket's availability in step with a booking changing
+// status, and the booking's seats_reserved flag with it. Only seats the
+// booking actually took are given back. Retrying a failed payment needs the
+// seats back and can run into ErrSoldOut, but a payment that lands after the
+// seats were released takes them even if that oversells: the money has
+// already been collected and the booking must be honoured or refunded.
+func adjustSeats(tx *gorm.DB, booking Booking, to BookingStatus) error {
+	held, holds := booking.SeatsReserved, bookingHoldsSeats(to)
+
+	var err error
+	switch {
+	case held && !holds:
+		err = releaseSeats(tx, booking.TicketID, booking.TicketCount)
+	case !held && holds && to == BookingStatusPaid:
+		err = tx.Model(&Ticket{}).
+			Where("id = ?", booking.TicketID).
+			Update("available_tickets", gorm.Expr("available_tickets - ?", booking.TicketCount)).Error
+	case !held && holds:
+		err = reserveSeats(tx, booking.TicketID, booking.TicketCount)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&Booking{}).Where("id = ?", booking.ID).Update("seats_reserved", holds).Error
+}
+
+// BackfillSeatsReserved brings availability in line with the bookings the
+// first time seats are reserved by bookings. Until then AvailableTickets was
+// only ever set by admins and no booking took seats from it, so selling the
+// remaining seats would oversell. Paid bookings, and unpaid ones with a hold
+// that will expire, are marked as holding their seats, and each ticket's
+// availability is recomputed as its total less the seats held by bookings
+// and waitlist offers. Unpaid bookings without a hold would never give their
+// seats back, so they take none. It runs once; after that bookings keep
+// availability in step.
+func BackfillSeatsReserved() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return runOnce(tx, "seats_reserved", func(tx *gorm.DB) error {
+			err := tx.Model(&Booking{}).
+				Where("NOT seats_reserved AND (status IN ? OR (status IN ? AND hold_expires_at IS NOT NULL))",
+					[]BookingStatus{BookingStatusPaid, BookingStatusCheckedIn},
+					[]BookingStatus{BookingStatusCreated, BookingStatusAwaitingPayment}).
+				Update("seats_reserved", true).Error
+			if err != nil {
+				return err
+			}
+
+			held := tx.Model(&Booking{}).
+				Select("COALESCE(SUM(ticket_count), 0)").
+				Where("bookings.ticket_id = tickets.id AND seats_reserved")
+			offered := tx.Model(&WaitlistEntry{}).
+				Select("COALESCE(SUM(ticket_count), 0)").
+				Where("waitlist_entries.ticket_id = tickets.id AND status = ?", WaitlistStatusOffered)
+			return tx.Model(&Ticket{}).
+				Where("1 = 1").
+				Update("available_tickets", gorm.Expr("GREATEST(total_tickets - (?) - (?), 0)", held, offered)).Error
+		})
+	})
+}
@@ -0,0 +1,156 @@
+package models_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// TestCreateBookingLastSeats races more buyers than there are seats and
+// checks that exactly the available seats are sold and availability never
+// goes below zero
+func TestCreateBookingLastSeats(t *testing.T) {
+	db := testdb.Open(t)
+
+	const seats, buyers = 5, 25
+	ticket := testdb.CreateTicket(t, seats)
+	referral := testdb.CreateReferral(t)
+
+	bookings := make([]models.Booking, buyers)
+	for i := range bookings {
+		bookings[i] = testdb.NewBooking(testdb.CreateUser(t, "user"), referral, ticket, 1)
+	}
+
+	// Sample availability while the bookings run
+	stop := make(chan struct{})
+	lowest := make(chan int)
+	go func() {
+		low := seats
+		for {
+			select {
+			case <-stop:
+				lowest <- low
+				return
+			default:
+			}
+
+			var available int
+			if err := db.Model(&models.Ticket{}).Select("available_tickets").Where("id = ?", ticket.ID).Scan(&available).Error; err == nil && available < low {
+				low = available
+			}
+		}
+	}()
+
+	start := make(chan struct{})
+	errs := make([]error, buyers)
+	var wg sync.WaitGroup
+	for i := range bookings {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = models.CreateBooking(bookings[i])
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(stop)
+
+	if low := <-lowest; low < 0 {
+		t.Errorf("available tickets went down to %d", low)
+	}
+
+	succeeded := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, models.ErrSoldOut):
+			t.Errorf("booking %d failed with %v, want ErrSoldOut", i, err)
+		}
+	}
+	if succeeded != seats {
+		t.Errorf("%d bookings succeeded, want %d", succeeded, seats)
+	}
+
+	if available := testdb.AvailableSeats(t, ticket.ID); available != 0 {
+		t.Errorf("available tickets = %d after selling out, want 0", available)
+	}
+
+	var stored int64
+	if err := db.Model(&models.Booking{}).Where("ticket_id = ?", ticket.ID).Count(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored != seats {
+		t.Errorf("%d bookings stored, want %d", stored, seats)
+	}
+}
+
+// TestExpireLegacyBooking checks that an unpaid booking made before seats
+// were reserved at booking time gives no seats back when it expires
+func TestExpireLegacyBooking(t *testing.T) {
+	db := testdb.Open(t)
+
+	ticket := testdb.CreateTicket(t, 10)
+	booking := testdb.NewBooking(testdb.CreateUser(t, "user"), testdb.CreateReferral(t), ticket, 2)
+	booking.ID = uuid.New()
+	booking.Status = models.BookingStatusAwaitingPayment
+	booking.PaymentStatus = booking.Status.PaymentStatus()
+	if err := db.Omit("User", "Ticket", "Referral").Create(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := models.TransitionBooking(booking.ID, models.BookingStatusExpired, "system:test", "legacy hold expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	if available := testdb.AvailableSeats(t, ticket.ID); available != 10 {
+		t.Errorf("available tickets = %d after expiring a legacy booking, want 10", available)
+	}
+}
+
+// TestBackfillSeatsReserved upgrades a ticket whose availability no booking
+// ever took seats from. Paid bookings are counted against it once, and give
+// back only what they were counted for when cancelled
+func TestBackfillSeatsReserved(t *testing.T) {
+	db := testdb.Open(t)
+
+	ticket := testdb.CreateTicket(t, 10)
+	user, referral := testdb.CreateUser(t, "user"), testdb.CreateReferral(t)
+	legacy := func(status models.BookingStatus, count int) models.Booking {
+		t.Helper()
+
+		booking := testdb.NewBooking(user, referral, ticket, count)
+		booking.ID = uuid.New()
+		booking.Status = status
+		booking.PaymentStatus = status.PaymentStatus()
+		if err := db.Omit("User", "Ticket", "Referral").Create(&booking).Error; err != nil {
+			t.Fatal(err)
+		}
+		return booking
+	}
+	paid := legacy(models.BookingStatusPaid, 3)
+	legacy(models.BookingStatusCheckedIn, 2)
+	legacy(models.BookingStatusCreated, 4)
+	legacy(models.BookingStatusCancelled, 1)
+
+	for i := 0; i < 2; i++ {
+		if err := models.BackfillSeatsReserved(); err != nil {
+			t.Fatalf("backfill %d: %v", i+1, err)
+		}
+		if available := testdb.AvailableSeats(t, ticket.ID); available != 5 {
+			t.Fatalf("available tickets = %d after backfill %d, want 5", available, i+1)
+		}
+	}
+
+	if _, err := models.TransitionBooking(paid.ID, models.BookingStatusCancelled, "test", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if available := testdb.AvailableSeats(t, ticket.ID); available != 8 {
+		t.Errorf("available tickets = %d after cancelling a legacy paid booking, want 8", available)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DataMigration records that a one-time data migration has run, so later
+// startups skip it even when the rows it created have since been removed
+type DataMigration struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	AppliedAt time.Time `gorm:"autoCreateTime" json:"appliedAt"`
+}
+
+// MigratedModels lists every table in the order AutoMigrate must create them
+// to satisfy foreign keys
+func MigratedModels() []interface{} {
+	return []interface{}{
+		&User{},
+		&Referral{},
+		&Event{},
+		&Ticket{},
+		&PriceTier{},
+		&GroupOfferRule{},
+		&Coupon{},
+		&Booking{},
+		&WaitlistEntry{},
+		&BookingStatusHistory{},
+		&PaymentTransaction{},
+		&Refund{},
+		&Pass{},
+		&CheckIn{},
+		&BookingTransfer{},
+		&BoxOfficeSale{},
+		&CompCategory{},
+		&ComplimentaryTicket{},
+		&DataMigration{},
+	}
+}
+
+// Migrate creates or updates every table. A model that fails to migrate does
+// not stop the others; all failures are returned together.
+func Migrate(db *gorm.DB) error {
+	var errs []error
+	if err := prepareCheckInClientRefIndex(db); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, model := range MigratedModels() {
+		if err := db.AutoMigrate(model); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runOnce runs migrate in tx unless the data migration called name has
+// already run. The record is written in the same transaction, so a migration
+// that fails is tried again on the next startup, and servers starting at the
+// same time run it only once.
+func runOnce(tx *gorm.DB, name string, migrate func(tx *gorm.DB) error) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&DataMigration{Name: name})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return migrate(tx)
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"gorm.io/gorm"
+)
+
+var ErrPassNotIssued = errors.New("pass can no longer be changed")
+
+// PassStatus is the state of a single attendee pass
+type PassStatus string
+
+const (
+	PassStatusIssued    PassStatus = "issued"
+	PassStatusCheckedIn PassStatus = "checked_in"
+	PassStatusVoid      PassStatus = "void"
+)
+
+// Pass admits one attendee. A paid booking gets one pass per seat so members
+// of a group can arrive separately, each with their own QR code.
+type Pass struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	BookingID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"bookingId"`
+	Code          string     `gorm:"not null;unique" json:"code"`
+	SeatNumber    int        `gorm:"not null" json:"seatNumber"`
+	AttendeeName  string     `json:"attendeeName"`
+	Status        PassStatus `gorm:"type:varchar(20);not null;default:'issued'" json:"status"`
+	CheckedInAt   *time.Time `json:"checkedInAt"`
+	CheckedInGate string     `json:"checkedInGate"`
+	CheckedInBy   string     `json:"checkedInBy"`
+	// Token is the signed QR payload; it is derived on demand, never stored
+	Token     string    `gorm:"-" json:"token,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Booking *Booking `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+}
+
+// issuePasses creates the booking's passes, one per seat. Seats that already
+// have a pass are skipped, so it is safe to call again after a booking is
+// paid a second time or when backfilling.
+func issuePasses(tx *gorm.DB, booking Booking) error {
+	var existing []Pass
+	if err := tx.Where("booking_id = ?", booking.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	issued := make(map[int]bool, len(existing))
+	for _, pass := range existing {
+		issued[pass.SeatNumber] = pass.Status != PassStatusVoid
+	}
+
+	for seat := 1; seat <= booking.TicketCount; seat++ {
+		if issued[seat] {
+			continue
+		}
+
+		err := tx.Create(&Pass{
+			BookingID:  booking.ID,
+			Code:       helper.GeneratePassCode(),
+			SeatNumber: seat,
+			Status:     PassStatusIssued,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// voidPasses invalidates every pass of a booking that has not been used yet
+func voidPasses(tx *gorm.DB, bookingID uuid.UUID) error {
+	return tx.Model(&Pass{}).
+		Where("booking_id = ? AND status = ?", bookingID, PassStatusIssued).
+		Update("status", PassStatusVoid).Error
+}
+
+// GetPassesByBookingID returns a booking's passes in seat order
+func GetPassesByBookingID(bookingID uuid.UUID) ([]Pass, error) {
+	var passes []Pass
+	err := config.DB.Where("booking_id = ?", bookingID).Order("seat_number ASC, id ASC").Find(&passes).Error
+	if err != nil {
+		return []Pass{}, err
+	}
+
+	return passes, nil
+}
+
+func GetPassByID(id uint) (Pass, error) {
+	var pass Pass
+	err := config.DB.Where("id = ?", id).First(&pass).Error
+	if err != nil {
+		return Pass{}, err
+	}
+
+	return pass, nil
+}
+
+func GetPassByCode(code string) (Pass, error) {
+	var pass Pass
+	err := config.DB.Where("code = ?", code).Preload("Booking").Preload("Booking.User").First(&pass).Error
+	if err != nil {
+		return Pass{}, err
+	}
+
+	return pass, nil
+}
+
+// AssignPassAttendee names the attendee of a pass. Only unused passes can be
+// reassigned.
+func AssignPassAttendee(id uint, attendeeName string) (Pass, error) {
+	result := config.DB.Model(&Pass{}).
+		Where("id = ? AND status = ?", id, PassStatusIssued).
+		Update("attendee_name", attendeeName)
+	if result.Error != nil {
+		return Pass{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Pass{}, ErrPassNotIssued
+	}
+
+	return GetPassByID(id)
+}
+
+// BackfillPasses issues passes for paid bookings made before passes existed
+func BackfillPasses() error {
+	var bookings []Booking
+	err := config.DB.Where("status IN ? AND NOT EXISTS (SELECT 1 FROM passes WHERE passes.booking_id = bookings.id)",
+		[]BookingStatus{BookingStatusPaid, BookingStatusCheckedIn}).
+		Find(&bookings).Error
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return issuePasses(tx, booking)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
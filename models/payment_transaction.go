@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+)
+
+// PaymentTransaction is one entry in the payment ledger. A row is appended for
+// every interaction with the payment provider (link creation, callback,
+// webhook, status polling, reconciliation) so support can see each attempt a customer made.
+type PaymentTransaction struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	BookingID         uuid.UUID `gorm:"column:booking_id;type:uuid;not null;index" json:"bookingId"`
+	Provider          string    `gorm:"not null" json:"provider"`
+	Source            string    `gorm:"not null" json:"source"` // link_created, callback, webhook, status_poll, reconcile, hold_sweeper, cancel, box_office or fake_gateway
+	LinkID            string    `gorm:"column:link_id;index" json:"linkId"`
+	ProviderOrderID   string    `gorm:"column:provider_order_id" json:"providerOrderId"`
+	ProviderPaymentID string    `gorm:"column:provider_payment_id" json:"providerPaymentId"`
+	Amount            float64   `gorm:"not null" json:"amount"`
+	Currency          string    `gorm:"not null" json:"currency"`
+	Method            string    `json:"method"`
+	Status            string    `gorm:"not null" json:"status"`
+	RawPayload        string    `gorm:"column:raw_payload;type:text" json:"rawPayload"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Booking *Booking `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+}
+
+// PaginatedPaymentTransactions represents a paginated response of payment transactions
+type PaginatedPaymentTransactions struct {
+	Transactions []PaymentTransaction `json:"transactions"`
+	Total        int64                `json:"total"`
+	Page         int                  `json:"page"`
+	PageSize     int                  `json:"pageSize"`
+	TotalPages   int                  `json:"totalPages"`
+	HasNext      bool                 `json:"hasNext"`
+	HasPrevious  bool                 `json:"hasPrevious"`
+}
+
+func CreatePaymentTransaction(transaction PaymentTransaction) (PaymentTransaction, error) {
+	err := config.DB.Create(&transaction).Error
+	if err != nil {
+		return PaymentTransaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// GetPaymentTransactionsByUserPaginated returns the ledger entries of all
+// bookings owned by the user, newest first
+func GetPaymentTransactionsByUserPaginated(userID string, page, pageSize int) (PaginatedPaymentTransactions, error) {
+	var transactions []PaymentTransaction
+	var total int64
+
+	query := config.DB.Model(&PaymentTransaction{}).
+		Joins("JOIN bookings ON bookings.id = payment_transactions.booking_id").
+		Where("bookings.user_id = ?", userID)
+
+	// Get total count
+	err := query.Count(&total).Error
+	if err != nil {
+		return PaginatedPaymentTransactions{}, err
+	}
+
+	// Calculate pagination values
+	offset := (page - 1) * pageSize
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	hasNext := page < totalPages
+	hasPrevious := page > 1
+
+	err = query.
+		Preload("Booking").
+		Preload("Booking.Ticket").
+		Order("payment_transactions.created_at DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&transactions).Error
+	if err != nil {
+		return PaginatedPaymentTransactions{}, err
+	}
+
+	return PaginatedPaymentTransactions{
+		Transactions: transactions,
+		Total:        total,
+		Page:         page,
+		PageSize:     pageSize,
+		TotalPages:   totalPages,
+		HasNext:      hasNext,
+		HasPrevious:  hasPrevious,
+	}, nil
+}
+
+// GetBookingIDByLinkID returns the booking a payment link was created for,
+// including links that a retry has since replaced
+func GetBookingIDByLinkID(linkID string) (uuid.UUID, error) {
+	var transaction PaymentTransaction
+	err := config.DB.Where("link_id = ?", linkID).Order("created_at ASC").First(&transaction).Error
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return transaction.BookingID, nil
+}
+
+// GetPaymentTransactionsByBookingID returns every ledger entry of a booking in
+// the order they were recorded
+func GetPaymentTransactionsByBookingID(bookingID uuid.UUID) ([]PaymentTransaction, error) {
+	var transactions []PaymentTransaction
+	err := config.DB.Where("booking_id = ?", bookingID).Order("created_at ASC").Find(&transactions).Error
+	if err != nil {
+		return []PaymentTransaction{}, err
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSaleNotStarted = errors.New("ticket sales have not started")
+	ErrSaleEnded      = errors.New("ticket sales have ended")
+	ErrEventNotOnSale = errors.New("event is not published")
+	ErrPriceChanged   = errors.New("ticket price changed")
+)
+
+// Sale states reported in TicketPricing
+const (
+	SaleStatusUpcoming = "upcoming"
+	SaleStatusOnSale   = "on_sale"
+	SaleStatusEnded    = "ended"
+	SaleStatusSoldOut  = "sold_out"
+)
+
+// PriceTier is a temporary price for a ticket, such as an early bird offer.
+// A tier applies until EndsAt, or until UntilSeat seats of the ticket have
+// been taken, whichever comes first; leave either unset for no limit. When
+// several tiers apply the one with the lowest SortOrder wins, and once none
+// does the ticket sells at its regular Price.
+type PriceTier struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TicketID  uint       `gorm:"not null;index" json:"ticketId"`
+	Name      string     `gorm:"not null" json:"name"`
+	Price     int        `gorm:"not null" json:"price"`
+	UntilSeat int        `gorm:"not null;default:0" json:"untilSeat"`
+	EndsAt    *time.Time `json:"endsAt"`
+	SortOrder int        `gorm:"not null;default:0" json:"sortOrder"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// appliesTo reports whether the tier covers a booking of count seats made at
+// now, after seatsTaken seats of the ticket were already taken. A booking
+// only gets a seat-limited tier when all of its seats fit in the tier.
+func (t PriceTier) appliesTo(now time.Time, seatsTaken, count int) bool {
+	if t.EndsAt != nil && !now.Before(*t.EndsAt) {
+		return false
+	}
+	if t.UntilSeat > 0 && seatsTaken+count > t.UntilSeat {
+		return false
+	}
+	return true
+}
+
+// TicketPricing is a ticket's sale state and current price as of a moment,
+// for listings. PriceChangesAt and SeatsLeftAtPrice say when the current tier
+// runs out; both are nil when the ticket sells at its regular price.
+type TicketPricing struct {
+	SaleStatus       string     `json:"saleStatus"`
+	CurrentPrice     int        `json:"currentPrice"`
+	CurrentTier      *PriceTier `json:"currentTier"`
+	PriceChangesAt   *time.Time `json:"priceChangesAt"`
+	SeatsLeftAtPrice *int       `json:"seatsLeftAtPrice"`
+	NextPrice        *int       `json:"nextPrice"`
+}
+
+// SaleError returns why the ticket cannot be sold at now, or nil while its
+// event is published and its sale window is open. Event must be loaded.
+func (t Ticket) SaleError(now time.Time) error {
+	if t.Event == nil || t.Event.Status != EventStatusPublished {
+		return ErrEventNotOnSale
+	}
+	if t.SaleStartsAt != nil && now.Before(*t.SaleStartsAt) {
+		return ErrSaleNotStarted
+	}
+	if t.SaleEndsAt != nil && !now.Before(*t.SaleEndsAt) {
+		return ErrSaleEnded
+	}
+	return nil
+}
+
+// ActivePriceTier returns the tier a booking of count seats gets at now, or
+// nil for the regular price. PriceTiers must be loaded and in SortOrder.
+func (t Ticket) ActivePriceTier(now time.Time, count int) *PriceTier {
+	return t.activePriceTier(now, t.TotalTickets-t.AvailableTickets, count)
+}
+
+func (t Ticket) activePriceTier(now time.Time, seatsTaken, count int) *PriceTier {
+	if i := t.activePriceTierIndex(0, now, seatsTaken, count); i >= 0 {
+		tier := t.PriceTiers[i]
+		return &tier
+	}
+	return nil
+}
+
+// activePriceTierIndex is the index of the first tier from start on that
+// applies, or -1
+func (t Ticket) activePriceTierIndex(start int, now time.Time, seatsTaken, count int) int {
+	for i := start; i < len(t.PriceTiers); i++ {
+		if t.PriceTiers[i].appliesTo(now, seatsTaken, count) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PricingAt reports the ticket's sale state and the price of a single seat at now
+func (t Ticket) PricingAt(now time.Time) TicketPricing {
+	pricing := TicketPricing{
+		SaleStatus:   SaleStatusOnSale,
+		CurrentPrice: t.Price,
+	}
+
+	switch t.SaleError(now) {
+	case ErrSaleNotStarted:
+		pricing.SaleStatus = SaleStatusUpcoming
+		// Show what the first buyers will pay once sales open
+		now = *t.SaleStartsAt
+	case ErrSaleEnded, ErrEventNotOnSale:
+		pricing.SaleStatus = SaleStatusEnded
+		return pricing
+	}
+	if pricing.SaleStatus == SaleStatusOnSale && t.AvailableTickets <= 0 {
+		pricing.SaleStatus = SaleStatusSoldOut
+	}
+
+	seatsTaken := t.TotalTickets - t.AvailableTickets
+	i := t.activePriceTierIndex(0, now, seatsTaken, 1)
+	if i < 0 {
+		return pricing
+	}
+
+	tier := t.PriceTiers[i]
+	pricing.CurrentPrice = tier.Price
+	pricing.CurrentTier = &tier
+	if tier.EndsAt != nil && (t.SaleEndsAt == nil || tier.EndsAt.Before(*t.SaleEndsAt)) {
+		pricing.PriceChangesAt = tier.EndsAt
+	}
+	if tier.UntilSeat > 0 {
+		left := tier.UntilSeat - seatsTaken
+		pricing.SeatsLeftAtPrice = &left
+	}
+
+	// The next price is whatever applies once this tier runs out. Earlier
+	// tiers have already lapsed, so only later ones can take over.
+	at, taken := now, seatsTaken
+	if tier.EndsAt != nil {
+		at = *tier.EndsAt
+	}
+	if tier.UntilSeat > 0 {
+		taken = tier.UntilSeat
+	}
+	next := t.Price
+	if j := t.activePriceTierIndex(i+1, at, taken, 1); j >= 0 {
+		next = t.PriceTiers[j].Price
+	}
+	pricing.NextPrice = &next
+
+	return pricing
+}
+
+// checkQuotedPriceTier makes sure the tier a booking was quoted still applies
+// once its seats are reserved. reserveSeats locks the ticket row, so bookings
+// racing for the last early bird seats are checked one after the other.
+func checkQuotedPriceTier(tx *gorm.DB, booking Booking) error {
+	var ticket Ticket
+	err := tx.Where("id = ?", booking.TicketID).
+		Preload("PriceTiers", preloadPriceTiers).
+		First(&ticket).Error
+	if err != nil {
+		return err
+	}
+
+	seatsTaken := ticket.TotalTickets - ticket.AvailableTickets - booking.TicketCount
+	tier := ticket.activePriceTier(time.Now(), seatsTaken, booking.TicketCount)
+
+	switch {
+	case tier == nil && booking.PriceTierID == nil:
+		return nil
+	case tier != nil && booking.PriceTierID != nil && tier.ID == *booking.PriceTierID:
+		return nil
+	}
+	return ErrPriceChanged
+}
+
+func GetPriceTiersByTicketID(ticketID uint) ([]PriceTier, error) {
+	var tiers []PriceTier
+
+	err := config.DB.Where("ticket_id = ?", ticketID).Order("sort_order ASC, id ASC").Find(&tiers).Error
+	if err != nil {
+		return []PriceTier{}, err
+	}
+
+	return tiers, nil
+}
+
+func GetPriceTierByID(id uint) (PriceTier, error) {
+	var tier PriceTier
+
+	err := config.DB.Where("id = ?", id).First(&tier).Error
+	if err != nil {
+		return PriceTier{}, err
+	}
+
+	return tier, nil
+}
+
+func CreatePriceTier(tier PriceTier) (PriceTier, error) {
+	err := config.DB.Create(&tier).Error
+	if err != nil {
+		return PriceTier{}, err
+	}
+
+	return tier, nil
+}
+
+func UpdatePriceTier(tier PriceTier) (PriceTier, error) {
+	err := config.DB.Save(&tier).Error
+	if err != nil {
+		return PriceTier{}, err
+	}
+
+	return tier, nil
+}
+
+func DeletePriceTier(id uint) error {
+	return config.DB.Delete(&PriceTier{}, id).Error
+}
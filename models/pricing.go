@@ -0,0 +1,105 @@
+package models
+
+import "errors"
+
+var ErrInvalidTicketCount = errors.New("ticket count must be at least 1")
+
+// PriceQuote is the server-side price of a booking. Clients may display their
+// own calculation, but only this amount is ever charged.
+type PriceQuote struct {
+	TicketID        uint    `json:"ticketId"`
+	TicketCount     int     `json:"ticketCount"`
+	FreeTickets     int     `json:"freeTickets"`
+	PaidTickets     int     `json:"paidTickets"`
+	GroupOfferID    *uint   `json:"groupOfferId"`
+	GroupOffer      string  `json:"groupOffer,omitempty"`
+	UnitPrice       int     `json:"unitPrice"`
+	PriceTierID     *uint   `json:"priceTierId"`
+	PriceTier       string  `json:"priceTier,omitempty"`
+	Subtotal        float64 `json:"subtotal"`
+	Discount        float64 `json:"discount"`
+	CouponID        *uint   `json:"couponId"`
+	CouponCode      string  `json:"couponCode,omitempty"`
+	Total           float64 `json:"total"`
+	ReferralApplied bool    `json:"referralApplied"`
+	YoutubeApplied  bool    `json:"youtubeApplied"`
+}
+
+// QuoteBookingPrice derives the amount to charge from the ticket's prices.
+// tier is the ticket's active price tier, nil for its regular price, and
+// groupOffers are the group offer rules that apply to the ticket.
+// hasReferral and hasYoutube must come from server-side checks (a referral
+// code found in the database, a subscription confirmed with YouTube), never
+// from flags sent by the client. The YouTube offer only applies on top of a
+// referral, an offer price of 0 means the ticket has no such offer, and an
+// offer is only used when it beats the tier's price.
+//
+// coupon, when not nil, must already have passed CheckApplicable. It takes
+// its discount off the paid tickets; a coupon that does not stack with
+// referrals is only applied when it beats the referral offer, and the quote
+// leaves CouponCode empty when it was not applied.
+func QuoteBookingPrice(ticket Ticket, tier *PriceTier, groupOffers []GroupOfferRule, ticketCount int, hasReferral, hasYoutube bool, coupon *Coupon) (PriceQuote, error) {
+	if ticketCount < 1 {
+		return PriceQuote{}, ErrInvalidTicketCount
+	}
+
+	quote := PriceQuote{
+		TicketID:    ticket.ID,
+		TicketCount: ticketCount,
+		UnitPrice:   ticket.Price,
+	}
+	if tier != nil {
+		quote.UnitPrice = tier.Price
+		quote.PriceTierID = &tier.ID
+		quote.PriceTier = tier.Name
+	}
+	basePrice := quote.UnitPrice
+
+	if hasReferral && ticket.OfferPriceWithReferral > 0 && (tier == nil || ticket.OfferPriceWithReferral < tier.Price) {
+		quote.UnitPrice = ticket.OfferPriceWithReferral
+		quote.ReferralApplied = true
+	}
+	if hasReferral && hasYoutube && ticket.OfferPriceWithReferralAndYoutube > 0 && (tier == nil || ticket.OfferPriceWithReferralAndYoutube < tier.Price) {
+		quote.UnitPrice = ticket.OfferPriceWithReferralAndYoutube
+		quote.ReferralApplied = true
+		quote.YoutubeApplied = true
+	}
+
+	offer, free := BestGroupOffer(groupOffers, ticketCount)
+	if offer != nil {
+		quote.GroupOfferID = &offer.ID
+		quote.GroupOffer = offer.Name
+	}
+	quote.FreeTickets = free
+	quote.PaidTickets = ticketCount - quote.FreeTickets
+	quote.Subtotal = float64(quote.UnitPrice * quote.PaidTickets)
+
+	if coupon != nil {
+		discount := coupon.DiscountFor(quote.Subtotal)
+		if quote.ReferralApplied && !coupon.StacksWithReferral {
+			// The coupon replaces the referral offer, if that is cheaper
+			baseSubtotal := float64(basePrice * quote.PaidTickets)
+			baseDiscount := coupon.DiscountFor(baseSubtotal)
+			if baseSubtotal-baseDiscount < quote.Subtotal {
+				quote.UnitPrice = basePrice
+				quote.ReferralApplied = false
+				quote.YoutubeApplied = false
+				quote.Subtotal = baseSubtotal
+				discount = baseDiscount
+			} else {
+				discount = 0
+				coupon = nil
+			}
+		}
+
+		if coupon != nil {
+			quote.Discount = discount
+			quote.CouponID = &coupon.ID
+			quote.CouponCode = coupon.Code
+		}
+	}
+
+	quote.Total = quote.Subtotal - quote.Discount
+
+	return quote, nil
+}
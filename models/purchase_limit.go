@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Purchase limit scopes reported in PurchaseLimitError
+const (
+	PurchaseLimitBooking = "booking"
+	PurchaseLimitTicket  = "ticket"
+	PurchaseLimitEvent   = "event"
+)
+
+// PurchaseLimitError is returned when a booking would go over one of its
+// ticket's or event's purchase limits. Remaining is how many more tickets
+// the user may still book within the limit; for the booking scope it is the
+// largest booking allowed.
+type PurchaseLimitError struct {
+	Scope     string `json:"scope"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+}
+
+func (e *PurchaseLimitError) Error() string {
+	return fmt.Sprintf("%s purchase limit of %d tickets reached, %d remaining", e.Scope, e.Limit, e.Remaining)
+}
+
+// CheckBookingSize returns a *PurchaseLimitError when a single booking of
+// count tickets is more than the ticket allows
+func (t Ticket) CheckBookingSize(count int) error {
+	if t.MaxPerBooking > 0 && count > t.MaxPerBooking {
+		return &PurchaseLimitError{Scope: PurchaseLimitBooking, Limit: t.MaxPerBooking, Remaining: t.MaxPerBooking}
+	}
+	return nil
+}
+
+// checkPurchaseLimits makes sure a booking keeps its user within the ticket's
+// and the event's limits, counting every online booking of theirs that holds
+// seats. The user's row stays locked until the transaction ends, so one
+// account booking from two tabs at once cannot slip past a limit. Box office
+// sales only have to respect the booking size, since they often belong to the
+// operator rather than the customer, and complimentary tickets are up to the
+// admin issuing them.
+func checkPurchaseLimits(tx *gorm.DB, booking Booking) error {
+	if booking.Channel == BookingChannelComplimentary {
+		return nil
+	}
+
+	var ticket Ticket
+	if err := tx.Where("id = ?", booking.TicketID).Preload("Event").First(&ticket).Error; err != nil {
+		return err
+	}
+	if err := ticket.CheckBookingSize(booking.TicketCount); err != nil {
+		return err
+	}
+
+	if booking.Channel != BookingChannelOnline {
+		return nil
+	}
+
+	eventLimit := 0
+	if ticket.Event != nil {
+		eventLimit = ticket.Event.MaxTicketsPerUser
+	}
+	if ticket.MaxPerUser == 0 && eventLimit == 0 {
+		return nil
+	}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("firebase_id = ?", booking.UserID).First(&User{}).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if ticket.MaxPerUser > 0 {
+		held, err := userHeldTickets(tx.Where("bookings.ticket_id = ?", ticket.ID), booking.UserID)
+		if err != nil {
+			return err
+		}
+		if held+booking.TicketCount > ticket.MaxPerUser {
+			return &PurchaseLimitError{Scope: PurchaseLimitTicket, Limit: ticket.MaxPerUser, Remaining: max(ticket.MaxPerUser-held, 0)}
+		}
+	}
+
+	if eventLimit > 0 {
+		held, err := userHeldTickets(tx.Joins("JOIN tickets ON tickets.id = bookings.ticket_id").Where("tickets.event_id = ?", *ticket.EventID), booking.UserID)
+		if err != nil {
+			return err
+		}
+		if held+booking.TicketCount > eventLimit {
+			return &PurchaseLimitError{Scope: PurchaseLimitEvent, Limit: eventLimit, Remaining: max(eventLimit-held, 0)}
+		}
+	}
+
+	return nil
+}
+
+// userHeldTickets adds up the tickets of the user's seat-holding bookings
+// matching the conditions already on db
+func userHeldTickets(db *gorm.DB, userID string) (int, error) {
+	var held int
+	err := db.Model(&Booking{}).
+		Select("COALESCE(SUM(bookings.ticket_count), 0)").
+		Where("bookings.user_id = ? AND bookings.status IN ? AND bookings.channel = ?", userID, seatHoldingStatuses(), BookingChannelOnline).
+		Scan(&held).Error
+	return held, err
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRefundExceedsBalance = errors.New("refund amount exceeds the refundable balance")
+
+// Refund tracks one refund of a booking, from the customer's request through
+// the payment provider's final status
+type Refund struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	BookingID        uuid.UUID `gorm:"column:booking_id;type:uuid;not null;index" json:"bookingId"`
+	RefundID         string    `gorm:"column:refund_id;not null;unique" json:"refundId"`
+	ProviderRefundID string    `gorm:"column:provider_refund_id" json:"providerRefundId"`
+	ProviderOrderID  string    `gorm:"column:provider_order_id" json:"providerOrderId"`
+	Amount           float64   `gorm:"not null" json:"amount"`
+	Status           string    `gorm:"not null" json:"status"` // requested, pending, success, failed or rejected
+	Reason           string    `json:"reason"`
+	RequestedBy      string    `gorm:"column:requested_by" json:"requestedBy"`
+	ProcessedBy      string    `gorm:"column:processed_by" json:"processedBy"`
+	RawPayload       string    `gorm:"column:raw_payload;type:text" json:"-"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Booking *Booking `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+}
+
+func CreateRefund(refund Refund) (Refund, error) {
+	err := config.DB.Create(&refund).Error
+	if err != nil {
+		return Refund{}, err
+	}
+
+	return refund, nil
+}
+
+func UpdateRefund(refund Refund) (Refund, error) {
+	err := config.DB.Save(&refund).Error
+	if err != nil {
+		return Refund{}, err
+	}
+
+	return refund, nil
+}
+
+func GetRefundByRefundID(refundID string) (Refund, error) {
+	var refund Refund
+	err := config.DB.Where("refund_id = ?", refundID).First(&refund).Error
+	if err != nil {
+		return Refund{}, err
+	}
+
+	return refund, nil
+}
+
+func GetRefundsByBookingID(bookingID uuid.UUID) ([]Refund, error) {
+	var refunds []Refund
+	err := config.DB.Where("booking_id = ?", bookingID).Order("created_at ASC").Find(&refunds).Error
+	if err != nil {
+		return []Refund{}, err
+	}
+
+	return refunds, nil
+}
+
+// GetRefundsByStatus lists refunds in the given status with their bookings,
+// oldest first, e.g. the customer requests waiting for an admin
+func GetRefundsByStatus(status string) ([]Refund, error) {
+	var refunds []Refund
+	err := config.DB.Where("status = ?", status).
+		Preload("Booking").
+		Preload("Booking.User").
+		Preload("Booking.Ticket").
+		Order("created_at ASC").
+		Find(&refunds).Error
+	if err != nil {
+		return []Refund{}, err
+	}
+
+	return refunds, nil
+}
+
+// refundedAmount returns how much of a booking is refunded or on its way back
+func refundedAmount(tx *gorm.DB, bookingID uuid.UUID) (float64, error) {
+	var total float64
+	err := tx.Model(&Refund{}).
+		Where("booking_id = ? AND status IN ?", bookingID, []string{"pending", "success"}).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// nextRefundID numbers the booking's refunds RF-<booking number>-<n>. The ID
+// is sent to Cashfree, which treats repeated refund calls with the same ID as
+// one refund, so a refund keeps its ID until the gateway has declined it.
+// Callers hold the booking's row lock, so two refunds cannot be given the
+// same number.
+func nextRefundID(tx *gorm.DB, booking Booking) (string, error) {
+	var count int64
+	if err := tx.Model(&Refund{}).Where("booking_id = ?", booking.ID).Count(&count).Error; err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("RF-%s-%d", booking.BookingNumber, count+1), nil
+}
+
+// RequestRefund records a customer's request to cancel a paid booking for an
+// admin to process. A booking has at most one open request; when there
+// already is one it is returned with created false.
+func RequestRefund(bookingID uuid.UUID, refund Refund) (Refund, bool, error) {
+	created := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var booking Booking
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", bookingID).First(&booking).Error
+		if err != nil {
+			return err
+		}
+
+		var existing Refund
+		err = tx.Where("booking_id = ? AND status = ?", booking.ID, "requested").First(&existing).Error
+		if err == nil {
+			refund = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		refund.BookingID = booking.ID
+		refund.Status = "requested"
+		if refund.RefundID, err = nextRefundID(tx, booking); err != nil {
+			return err
+		}
+		created = true
+		return tx.Omit(clause.Associations).Create(&refund).Error
+	})
+	if err != nil {
+		return Refund{}, false, err
+	}
+
+	return refund, created, nil
+}
+
+// StartRefund sets aside amount of a booking's payment for a refund about to
+// be sent to the payment gateway; amount 0 takes whatever has not been
+// refunded yet. The booking row stays locked from reading the refunded total
+// until the refund is saved as pending, so concurrent refunds cannot together
+// return more than was paid. The booking's open customer request becomes the
+// refund if there is one. ErrRefundExceedsBalance is returned with the
+// refundable balance when amount does not fit.
+//
+// A pending refund the gateway never confirmed may have been made, so it is
+// returned as it is to be sent again under the same refund ID, and amount is
+// ignored until the gateway has answered for it.
+func StartRefund(bookingID uuid.UUID, amount float64, refund Refund) (Refund, float64, error) {
+	var remaining float64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var booking Booking
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", bookingID).First(&booking).Error
+		if err != nil {
+			return err
+		}
+
+		refunded, err := refundedAmount(tx, booking.ID)
+		if err != nil {
+			return err
+		}
+		remaining = booking.PaymentPrice - refunded
+
+		var unconfirmed Refund
+		err = tx.Where("booking_id = ? AND status = ? AND COALESCE(provider_refund_id, '') = ''", booking.ID, "pending").
+			Order("created_at ASC").
+			First(&unconfirmed).Error
+		if err == nil {
+			// Its amount is already set aside in refunded
+			remaining += unconfirmed.Amount
+			refund = unconfirmed
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount <= 0 || amount > remaining+0.005 {
+			return ErrRefundExceedsBalance
+		}
+
+		var request Refund
+		err = tx.Where("booking_id = ? AND status = ?", booking.ID, "requested").Order("created_at ASC").First(&request).Error
+		switch {
+		case err == nil:
+			request.Amount = amount
+			request.ProcessedBy = refund.ProcessedBy
+			request.ProviderOrderID = refund.ProviderOrderID
+			if refund.Reason != "" {
+				request.Reason = refund.Reason
+			}
+			refund = request
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			refund.BookingID = booking.ID
+			refund.Amount = amount
+			if refund.RefundID, err = nextRefundID(tx, booking); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		refund.Status = "pending"
+		return tx.Omit(clause.Associations).Save(&refund).Error
+	})
+	if errors.Is(err, ErrRefundExceedsBalance) {
+		return Refund{}, remaining, err
+	}
+	if err != nil {
+		return Refund{}, 0, err
+	}
+
+	return refund, remaining - refund.Amount, nil
+}
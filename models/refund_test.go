@@ -0,0 +1,177 @@
+package models_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// paidBooking creates a booking of count seats and takes it to paid
+func paidBooking(t *testing.T, count int) models.Booking {
+	t.Helper()
+
+	booking, err := models.CreateBooking(testdb.NewBooking(testdb.CreateUser(t, "user"), testdb.CreateReferral(t), testdb.CreateTicket(t, 10), count))
+	if err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+	for _, to := range []models.BookingStatus{models.BookingStatusAwaitingPayment, models.BookingStatusPaid} {
+		if _, err := models.TransitionBooking(booking.ID, to, "test", "test"); err != nil {
+			t.Fatalf("failed to move booking to %s: %v", to, err)
+		}
+	}
+	return booking
+}
+
+// confirmRefund records the gateway's answer for a refund
+func confirmRefund(t *testing.T, refund models.Refund, status string) models.Refund {
+	t.Helper()
+
+	refund.ProviderRefundID = "cf-" + refund.RefundID
+	refund.Status = status
+	refund, err := models.UpdateRefund(refund)
+	if err != nil {
+		t.Fatalf("failed to update refund: %v", err)
+	}
+	return refund
+}
+
+// TestStartRefundConcurrent starts more partial refunds at once than the
+// payment covers, each confirmed by the gateway once started, and checks
+// that together they never refund more than was paid and are numbered
+// without gaps. A refund still waiting for the gateway is handed to the
+// other callers to resend rather than started twice.
+func TestStartRefundConcurrent(t *testing.T) {
+	testdb.Open(t)
+
+	booking := paidBooking(t, 2)
+
+	const attempts, amount = 10, 500.0
+	fits := int(booking.PaymentPrice / amount)
+
+	start := make(chan struct{})
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			refund, _, err := models.StartRefund(booking.ID, amount, models.Refund{ProcessedBy: "admin"})
+			if err == nil {
+				refund.ProviderRefundID = "cf-" + refund.RefundID
+				refund.Status = "success"
+				_, err = models.UpdateRefund(refund)
+			}
+			errs[i] = err
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, models.ErrRefundExceedsBalance) {
+			t.Fatalf("refund %d failed: %v", i, err)
+		}
+	}
+
+	refunds, err := models.GetRefundsByBookingID(booking.ID)
+	if err != nil {
+		t.Fatalf("failed to get refunds: %v", err)
+	}
+	if len(refunds) == 0 || len(refunds) > fits {
+		t.Errorf("%d refunds of %v started against a payment of %v, want 1 to %d", len(refunds), amount, booking.PaymentPrice, fits)
+	}
+	total := 0.0
+	used := map[string]bool{}
+	for _, refund := range refunds {
+		total += refund.Amount
+		used[refund.RefundID] = true
+	}
+	if total > booking.PaymentPrice {
+		t.Errorf("refunds add up to %v of a %v payment", total, booking.PaymentPrice)
+	}
+	for n := 1; n <= len(refunds); n++ {
+		if id := fmt.Sprintf("RF-%s-%d", booking.BookingNumber, n); !used[id] {
+			t.Errorf("refund ID %s was not used", id)
+		}
+	}
+}
+
+// TestStartRefundRetry checks that a refund the gateway never answered for
+// is sent again under its refund ID, and that a new ID is only given out
+// after the gateway has declined or made the refund
+func TestStartRefundRetry(t *testing.T) {
+	testdb.Open(t)
+
+	booking := paidBooking(t, 2)
+	id := func(n int) string { return fmt.Sprintf("RF-%s-%d", booking.BookingNumber, n) }
+
+	first, _, err := models.StartRefund(booking.ID, 500, models.Refund{ProcessedBy: "admin"})
+	if err != nil || first.RefundID != id(1) {
+		t.Fatalf("first refund: %s, %v", first.RefundID, err)
+	}
+
+	// The gateway timed out; a retry for any amount resends the same refund
+	retry, remaining, err := models.StartRefund(booking.ID, 0, models.Refund{ProcessedBy: "admin"})
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if retry.ID != first.ID || retry.RefundID != id(1) || retry.Amount != 500 || remaining != booking.PaymentPrice-500 {
+		t.Errorf("retry sends %s for %v with %v left, want %s for 500", retry.RefundID, retry.Amount, remaining, id(1))
+	}
+	confirmRefund(t, retry, "success")
+
+	declined, _, err := models.StartRefund(booking.ID, 500, models.Refund{ProcessedBy: "admin"})
+	if err != nil || declined.RefundID != id(2) {
+		t.Fatalf("second refund: %s, %v", declined.RefundID, err)
+	}
+	declined.Status = "failed"
+	if _, err := models.UpdateRefund(declined); err != nil {
+		t.Fatalf("failed to decline refund: %v", err)
+	}
+
+	// The declined amount is refundable again under a new ID
+	next, remaining, err := models.StartRefund(booking.ID, 0, models.Refund{ProcessedBy: "admin"})
+	if err != nil {
+		t.Fatalf("refund after decline: %v", err)
+	}
+	if next.RefundID != id(3) || next.Amount != booking.PaymentPrice-500 || remaining != 0 {
+		t.Errorf("refund after decline is %s for %v with %v left", next.RefundID, next.Amount, remaining)
+	}
+}
+
+// TestStartRefundTakesOverRequest checks that an admin refund processes the
+// customer's open cancellation request instead of adding a second refund
+func TestStartRefundTakesOverRequest(t *testing.T) {
+	testdb.Open(t)
+
+	booking := paidBooking(t, 1)
+
+	request, created, err := models.RequestRefund(booking.ID, models.Refund{Amount: booking.PaymentPrice, RequestedBy: booking.UserID})
+	if err != nil || !created {
+		t.Fatalf("failed to request refund: created %v, %v", created, err)
+	}
+	if _, created, err := models.RequestRefund(booking.ID, models.Refund{Amount: booking.PaymentPrice, RequestedBy: booking.UserID}); err != nil || created {
+		t.Fatalf("second request: created %v, %v", created, err)
+	}
+
+	refund, remaining, err := models.StartRefund(booking.ID, 0, models.Refund{ProcessedBy: "admin"})
+	if err != nil {
+		t.Fatalf("failed to start refund: %v", err)
+	}
+	if refund.ID != request.ID || refund.RefundID != request.RefundID {
+		t.Errorf("refund %s did not take over request %s", refund.RefundID, request.RefundID)
+	}
+	if refund.Status != "pending" || refund.Amount != booking.PaymentPrice || remaining != 0 {
+		t.Errorf("refund is %s for %v with %v left", refund.Status, refund.Amount, remaining)
+	}
+	confirmRefund(t, refund, "success")
+
+	if _, remaining, err := models.StartRefund(booking.ID, 1, models.Refund{ProcessedBy: "admin"}); !errors.Is(err, models.ErrRefundExceedsBalance) || remaining != 0 {
+		t.Errorf("refunding a fully refunded booking: %v with %v left", err, remaining)
+	}
+}
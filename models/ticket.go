@@ -4,28 +4,48 @@ import (
 	"time"
 
 	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Ticket struct {
-	ID                               uint      `gorm:"primaryKey" json:"id"`
-	Name                             string    `gorm:"not null" json:"name"`
-	Price                            int       `gorm:"not null" json:"price"`
-	Type                             string    `gorm:"not null" json:"type"`
-	Description                      string    `gorm:"not null" json:"description"`
-	Benefits                         []string  `gorm:"serializer:json;not null" json:"benefits"`
-	Status                           string    `gorm:"not null" json:"status"`
-	TotalTickets                     int       `gorm:"not null" json:"totalTickets"`
-	OfferPriceWithReferral           int       `gorm:"not null" json:"offerPriceWithReferral"`
-	OfferPriceWithReferralAndYoutube int       `gorm:"not null" json:"offerPriceWithReferralAndYoutube"`
-	AvailableTickets                 int       `gorm:"not null" json:"availableTickets"`
-	CreatedAt                        time.Time `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt                        time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	ID                               uint       `gorm:"primaryKey" json:"id"`
+	EventID                          *uint      `gorm:"index" json:"eventId"`
+	Name                             string     `gorm:"not null" json:"name"`
+	Price                            int        `gorm:"not null" json:"price"`
+	Type                             string     `gorm:"not null" json:"type"`
+	Description                      string     `gorm:"not null" json:"description"`
+	Benefits                         []string   `gorm:"serializer:json;not null" json:"benefits"`
+	Status                           string     `gorm:"not null" json:"status"`
+	TotalTickets                     int        `gorm:"not null" json:"totalTickets"`
+	OfferPriceWithReferral           int        `gorm:"not null" json:"offerPriceWithReferral"`
+	OfferPriceWithReferralAndYoutube int        `gorm:"not null" json:"offerPriceWithReferralAndYoutube"`
+	AvailableTickets                 int        `gorm:"not null" json:"availableTickets"`
+	SaleStartsAt                     *time.Time `json:"saleStartsAt"`
+	SaleEndsAt                       *time.Time `json:"saleEndsAt"`
+	MaxPerBooking                    int        `gorm:"not null;default:0" json:"maxPerBooking"`
+	MaxPerUser                       int        `gorm:"not null;default:0" json:"maxPerUser"`
+	CreatedAt                        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt                        time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Event      *Event      `gorm:"foreignKey:EventID" json:"event,omitempty"`
+	PriceTiers []PriceTier `gorm:"foreignKey:TicketID" json:"priceTiers"`
+	// Pricing is filled in for listings and never stored
+	Pricing *TicketPricing `gorm:"-" json:"pricing,omitempty"`
+}
+
+// preloadPriceTiers loads a ticket's tiers in the order they are tried
+func preloadPriceTiers(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order ASC, id ASC")
 }
 
 func GetTicketByID(id uint) (Ticket, error) {
 	var ticket Ticket
 
-	err := config.DB.Where("id = ?", id).First(&ticket).Error
+	err := config.DB.Where("id = ?", id).
+		Preload("Event").
+		Preload("PriceTiers", preloadPriceTiers).
+		First(&ticket).Error
 	if err != nil {
 		return Ticket{}, err
 	}
@@ -33,9 +53,35 @@ func GetTicketByID(id uint) (Ticket, error) {
 	return ticket, nil
 }
 
-func GetAllTickets() ([]Ticket, error) {
+// GetAllTickets lists tickets with their event; eventID 0 lists every event's tickets
+func GetAllTickets(eventID uint) ([]Ticket, error) {
 	var tickets []Ticket
-	err := config.DB.Find(&tickets).Error
+
+	query := config.DB.Preload("Event").Preload("PriceTiers", preloadPriceTiers)
+	if eventID != 0 {
+		query = query.Where("event_id = ?", eventID)
+	}
+
+	err := query.Find(&tickets).Error
+	if err != nil {
+		return []Ticket{}, err
+	}
+
+	return tickets, nil
+}
+
+// GetPublicTickets lists the tickets of non-draft events, like
+// GetPublicEvents; eventID 0 lists every such event's tickets
+func GetPublicTickets(eventID uint) ([]Ticket, error) {
+	var tickets []Ticket
+
+	query := config.DB.Preload("Event").Preload("PriceTiers", preloadPriceTiers).
+		Where("event_id IN (?)", config.DB.Model(&Event{}).Select("id").Where("status <> ?", EventStatusDraft))
+	if eventID != 0 {
+		query = query.Where("event_id = ?", eventID)
+	}
+
+	err := query.Find(&tickets).Error
 	if err != nil {
 		return []Ticket{}, err
 	}
@@ -44,7 +90,7 @@ func GetAllTickets() ([]Ticket, error) {
 }
 
 func CreateTicket(ticket Ticket) (Ticket, error) {
-	err := config.DB.Create(&ticket).Error
+	err := config.DB.Omit(clause.Associations).Create(&ticket).Error
 	if err != nil {
 		return Ticket{}, err
 	}
@@ -53,7 +99,7 @@ func CreateTicket(ticket Ticket) (Ticket, error) {
 }
 
 func UpdateTicket(ticket Ticket) (Ticket, error) {
-	err := config.DB.Save(&ticket).Error
+	err := config.DB.Omit(clause.Associations).Save(&ticket).Error
 	if err != nil {
 		return Ticket{}, err
 	}
@@ -62,10 +108,11 @@ func UpdateTicket(ticket Ticket) (Ticket, error) {
 }
 
 func DeleteTicket(id uint) error {
-	err := config.DB.Delete(&Ticket{}, id).Error
-	if err != nil {
-		return err
-	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_id = ?", id).Delete(&PriceTier{}).Error; err != nil {
+			return err
+		}
 
-	return nil
+		return tx.Delete(&Ticket{}, id).Error
+	})
 }
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTransferNotAllowed = errors.New("booking cannot be transferred")
+	ErrTransferPending    = errors.New("booking already has a pending transfer")
+	ErrTransferNotPending = errors.New("transfer is no longer pending")
+	ErrTransferRecipient  = errors.New("transfer was sent to another email address")
+)
+
+// TransferStatus is the state of a booking transfer
+type TransferStatus string
+
+const (
+	TransferStatusPending   TransferStatus = "pending"
+	TransferStatusAccepted  TransferStatus = "accepted"
+	TransferStatusCancelled TransferStatus = "cancelled"
+	TransferStatusExpired   TransferStatus = "expired"
+)
+
+// BookingTransfer is the owner of a paid booking giving it to someone else.
+// The recipient accepts while logged in as ToEmail, at which point the
+// booking moves to them with new passes. Transfers are kept once finished,
+// so they double as the booking's ownership history.
+type BookingTransfer struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	BookingID  uuid.UUID      `gorm:"type:uuid;not null;index" json:"bookingId"`
+	FromUserID string         `gorm:"not null;index" json:"fromUserId"`
+	ToEmail    string         `gorm:"not null;index" json:"toEmail"`
+	ToUserID   string         `gorm:"not null;default:''" json:"toUserId"`
+	Status     TransferStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	ExpiresAt  *time.Time     `json:"expiresAt"`
+	AcceptedAt *time.Time     `json:"acceptedAt"`
+	CreatedAt  time.Time      `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt  time.Time      `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	Booking *Booking `gorm:"foreignKey:BookingID;references:ID" json:"booking,omitempty"`
+}
+
+// NormalizeEmail is how transfer recipients are stored and compared
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// TransferCutoff is when transfers of the ticket's bookings close: cutoff
+// before its event starts. It is nil when the ticket has no event.
+func (t Ticket) TransferCutoff(cutoff time.Duration) *time.Time {
+	if t.Event == nil {
+		return nil
+	}
+
+	closesAt := t.Event.StartTime.Add(-cutoff)
+	return &closesAt
+}
+
+// checkTransferable returns ErrTransferNotAllowed unless the booking is paid
+// and none of its passes has been used
+func checkTransferable(tx *gorm.DB, booking Booking) error {
+	if booking.Status != BookingStatusPaid {
+		return ErrTransferNotAllowed
+	}
+
+	var checkedIn int64
+	err := tx.Model(&Pass{}).
+		Where("booking_id = ? AND status = ?", booking.ID, PassStatusCheckedIn).
+		Count(&checkedIn).Error
+	if err != nil {
+		return err
+	}
+	if checkedIn > 0 {
+		return ErrTransferNotAllowed
+	}
+
+	return nil
+}
+
+// CreateBookingTransfer starts a transfer of a paid booking to toEmail that
+// can be accepted until expiresAt. A booking has at most one pending transfer.
+func CreateBookingTransfer(booking Booking, toEmail string, expiresAt *time.Time) (BookingTransfer, error) {
+	transfer := BookingTransfer{
+		BookingID:  booking.ID,
+		FromUserID: booking.UserID,
+		ToEmail:    NormalizeEmail(toEmail),
+		Status:     TransferStatusPending,
+		ExpiresAt:  expiresAt,
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var locked Booking
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", booking.ID).First(&locked).Error
+		if err != nil {
+			return err
+		}
+		if err := checkTransferable(tx, locked); err != nil {
+			return err
+		}
+
+		var pending int64
+		err = tx.Model(&BookingTransfer{}).
+			Where("booking_id = ? AND status = ?", booking.ID, TransferStatusPending).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrTransferPending
+		}
+
+		transfer.FromUserID = locked.UserID
+		return tx.Omit(clause.Associations).Create(&transfer).Error
+	})
+	if err != nil {
+		return BookingTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// CancelBookingTransfer withdraws a pending transfer
+func CancelBookingTransfer(id uint) (BookingTransfer, error) {
+	result := config.DB.Model(&BookingTransfer{}).
+		Where("id = ? AND status = ?", id, TransferStatusPending).
+		Update("status", TransferStatusCancelled)
+	if result.Error != nil {
+		return BookingTransfer{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return BookingTransfer{}, ErrTransferNotPending
+	}
+
+	return GetBookingTransferByID(id)
+}
+
+// AcceptBookingTransfer moves the transferred booking to the recipient. The
+// booking's unused passes are voided and new ones issued, so QR codes the
+// previous owner kept no longer get anyone in. toEmail is the recipient's
+// account email and must match the address the transfer was sent to.
+func AcceptBookingTransfer(id uint, toUserID, toEmail string, now time.Time) (BookingTransfer, error) {
+	var transfer BookingTransfer
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&transfer).Error
+		if err != nil {
+			return err
+		}
+		if transfer.Status != TransferStatusPending {
+			return ErrTransferNotPending
+		}
+		if transfer.ExpiresAt != nil && !now.Before(*transfer.ExpiresAt) {
+			return ErrTransferNotPending
+		}
+		if transfer.ToEmail != NormalizeEmail(toEmail) {
+			return ErrTransferRecipient
+		}
+
+		var booking Booking
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", transfer.BookingID).First(&booking).Error
+		if err != nil {
+			return err
+		}
+		if booking.UserID != transfer.FromUserID {
+			return ErrTransferNotAllowed
+		}
+		if err := checkTransferable(tx, booking); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Booking{}).Where("id = ?", booking.ID).Update("user_id", toUserID).Error; err != nil {
+			return err
+		}
+		if err := voidPasses(tx, booking.ID); err != nil {
+			return err
+		}
+		booking.UserID = toUserID
+		if err := issuePasses(tx, booking); err != nil {
+			return err
+		}
+
+		transfer.Status = TransferStatusAccepted
+		transfer.ToUserID = toUserID
+		transfer.AcceptedAt = &now
+		return tx.Model(&BookingTransfer{}).Where("id = ?", transfer.ID).Updates(map[string]interface{}{
+			"status":      transfer.Status,
+			"to_user_id":  transfer.ToUserID,
+			"accepted_at": transfer.AcceptedAt,
+		}).Error
+	})
+	if err != nil {
+		return BookingTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// ExpireBookingTransfers closes pending transfers that were not accepted
+// before they ran out and returns how many were closed
+func ExpireBookingTransfers(now time.Time) (int64, error) {
+	result := config.DB.Model(&BookingTransfer{}).
+		Where("status = ? AND expires_at < ?", TransferStatusPending, now).
+		Update("status", TransferStatusExpired)
+	return result.RowsAffected, result.Error
+}
+
+// GetBookingTransferByID loads a transfer with its booking's ticket and event
+func GetBookingTransferByID(id uint) (BookingTransfer, error) {
+	var transfer BookingTransfer
+
+	err := config.DB.Where("id = ?", id).
+		Preload("Booking.Ticket.Event").
+		First(&transfer).Error
+	if err != nil {
+		return BookingTransfer{}, err
+	}
+
+	return transfer, nil
+}
+
+// GetBookingTransfers lists a booking's transfers, oldest first
+func GetBookingTransfers(bookingID uuid.UUID) ([]BookingTransfer, error) {
+	var transfers []BookingTransfer
+
+	err := config.DB.Where("booking_id = ?", bookingID).Order("created_at ASC, id ASC").Find(&transfers).Error
+	if err != nil {
+		return []BookingTransfer{}, err
+	}
+
+	return transfers, nil
+}
+
+// GetPendingTransfersTo lists the transfers waiting for a recipient to accept them
+func GetPendingTransfersTo(email string, now time.Time) ([]BookingTransfer, error) {
+	var transfers []BookingTransfer
+
+	err := config.DB.Where("to_email = ? AND status = ? AND (expires_at IS NULL OR expires_at > ?)", NormalizeEmail(email), TransferStatusPending, now).
+		Preload("Booking.Ticket.Event").
+		Order("created_at DESC").
+		Find(&transfers).Error
+	if err != nil {
+		return []BookingTransfer{}, err
+	}
+
+	return transfers, nil
+}
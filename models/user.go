@@ -10,11 +10,15 @@ import (
 // Custom error for user not found
 var ErrUserNotFound = errors.New("user not found")
 
+// UserRoles are the roles a user can hold. Scanners operate the gate check-in
+// and box_office operators sell tickets at the counter.
+var UserRoles = []string{"user", "admin", "client", "scanner", "box_office"}
+
 type User struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	UserID     string    `gorm:"column:user_id;not null;unique" json:"userId"`
 	FirebaseID string    `gorm:"column:firebase_id;not null;unique" json:"firebaseId"`
-	Role       string    `gorm:"not null;default:'user';enum:user,admin,client" json:"role"`
+	Role       string    `gorm:"not null;default:'user';enum:user,admin,client,scanner,box_office" json:"role"`
 	FullName   string    `gorm:"column:full_name;not null" json:"fullName"`
 	Email      string    `gorm:"not null;unique" json:"email"`
 	Mobile     string    `gorm:"not null" json:"mobile"`
@@ -50,6 +54,18 @@ func GetUserByFirebaseId(firebaseID string) (User, error) {
 	return user, nil
 }
 
+// GetUserByEmail looks a user up by their email, ignoring case
+func GetUserByEmail(email string) (User, error) {
+	var user User
+
+	err := config.DB.Where("LOWER(email) = ?", NormalizeEmail(email)).First(&user).Error
+	if err != nil {
+		return User{}, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
 func CreateUser(user User) (User, error) {
 	err := config.DB.Create(&user).Error
 	if err != nil {
@@ -68,6 +84,19 @@ func UpdateUser(user User) (User, error) {
 	return user, nil
 }
 
+// SetUserRole changes the role of the user with the given firebase ID
+func SetUserRole(firebaseID, role string) (User, error) {
+	result := config.DB.Model(&User{}).Where("firebase_id = ?", firebaseID).Update("role", role)
+	if result.Error != nil {
+		return User{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return User{}, ErrUserNotFound
+	}
+
+	return GetUserByFirebaseId(firebaseID)
+}
+
 func DeleteUser(userID string) error {
 	err := config.DB.Delete(&User{}, userID).Error
 	if err != nil {
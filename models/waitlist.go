@@ -0,0 +1,379 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSeatsAvailable     = errors.New("enough tickets are available to book")
+	ErrAlreadyWaitlisted  = errors.New("already on the waitlist for this ticket")
+	ErrWaitlistNotActive  = errors.New("waitlist entry is no longer active")
+	ErrWaitlistOfferGone  = errors.New("waitlist offer is no longer available")
+	ErrWaitlistOfferOwner = errors.New("waitlist offer belongs to another user")
+)
+
+// WaitlistStatus is where a waitlist entry is in line
+type WaitlistStatus string
+
+const (
+	// WaitlistStatusWaiting entries are in line for seats
+	WaitlistStatusWaiting WaitlistStatus = "waiting"
+	// WaitlistStatusOffered entries have seats held for them until OfferExpiresAt
+	WaitlistStatusOffered WaitlistStatus = "offered"
+	// WaitlistStatusClaimed entries turned their offer into BookingID
+	WaitlistStatusClaimed WaitlistStatus = "claimed"
+	// WaitlistStatusExpired entries let their offer run out
+	WaitlistStatusExpired WaitlistStatus = "expired"
+	// WaitlistStatusLeft entries were withdrawn by the customer
+	WaitlistStatusLeft WaitlistStatus = "left"
+)
+
+// WaitlistEntry is a customer waiting for TicketCount seats of a sold out
+// ticket. Entries are offered seats in the order they joined; an offer takes
+// the seats out of AvailableTickets so nobody else can book them, and gives
+// them back if it is not claimed in time.
+type WaitlistEntry struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	TicketID    uint           `gorm:"not null;index" json:"ticketId"`
+	UserID      string         `gorm:"not null;index" json:"userId"`
+	TicketCount int            `gorm:"not null" json:"ticketCount"`
+	Status      WaitlistStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	// ClaimToken is the secret in the offer's claim link
+	ClaimToken     string     `gorm:"not null;default:'';index" json:"-"`
+	OfferedAt      *time.Time `json:"offeredAt"`
+	OfferExpiresAt *time.Time `gorm:"index" json:"offerExpiresAt"`
+	BookingID      *uuid.UUID `gorm:"type:uuid" json:"bookingId"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+
+	User   User   `gorm:"foreignKey:UserID;references:FirebaseID" json:"user"`
+	Ticket Ticket `gorm:"foreignKey:TicketID;references:ID" json:"ticket"`
+}
+
+// activeWaitlistStatuses are the statuses of entries still in line
+func activeWaitlistStatuses() []WaitlistStatus {
+	return []WaitlistStatus{WaitlistStatusWaiting, WaitlistStatusOffered}
+}
+
+// JoinWaitlist puts a customer in line for a ticket. It fails with
+// ErrSeatsAvailable when the seats can be booked right away and with
+// ErrAlreadyWaitlisted when the customer is already in line for the ticket.
+func JoinWaitlist(entry WaitlistEntry) (WaitlistEntry, error) {
+	entry.ID = 0
+	entry.Status = WaitlistStatusWaiting
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var ticket Ticket
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", entry.TicketID).First(&ticket).Error
+		if err != nil {
+			return err
+		}
+		if ticket.AvailableTickets >= entry.TicketCount {
+			return ErrSeatsAvailable
+		}
+
+		var count int64
+		err = tx.Model(&WaitlistEntry{}).
+			Where("ticket_id = ? AND user_id = ? AND status IN ?", entry.TicketID, entry.UserID, activeWaitlistStatuses()).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyWaitlisted
+		}
+
+		return tx.Omit(clause.Associations).Create(&entry).Error
+	})
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// LeaveWaitlist takes a customer out of line, giving back the seats of an
+// open offer
+func LeaveWaitlist(id uint) (WaitlistEntry, error) {
+	var entry WaitlistEntry
+	var offered bool
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&entry).Error
+		if err != nil {
+			return err
+		}
+
+		switch entry.Status {
+		case WaitlistStatusWaiting:
+		case WaitlistStatusOffered:
+			offered = true
+			if err := releaseSeats(tx, entry.TicketID, entry.TicketCount); err != nil {
+				return err
+			}
+		default:
+			return ErrWaitlistNotActive
+		}
+
+		entry.Status = WaitlistStatusLeft
+		return tx.Model(&WaitlistEntry{}).Where("id = ?", id).Update("status", entry.Status).Error
+	})
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	if offered {
+		notifySeatsReleased(entry.TicketID)
+	}
+	return entry, nil
+}
+
+// OfferWaitlistSeats holds the ticket's available seats for the customers
+// waiting for it, in the order they joined, until now+ttl. Customers who want
+// more seats than are left keep their place and later ones whose seats fit
+// are offered instead. It returns the entries that got an offer, with their
+// user, ticket and event loaded.
+func OfferWaitlistSeats(ticketID uint, now time.Time, ttl time.Duration) ([]WaitlistEntry, error) {
+	var offeredIDs []uint
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var ticket Ticket
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", ticketID).First(&ticket).Error
+		if err != nil {
+			return err
+		}
+		if ticket.EventID != nil {
+			ticket.Event = &Event{}
+			if err := tx.Where("id = ?", *ticket.EventID).First(ticket.Event).Error; err != nil {
+				return err
+			}
+		}
+		if ticket.AvailableTickets <= 0 || ticket.SaleError(now) != nil {
+			return nil
+		}
+
+		var waiting []WaitlistEntry
+		err = tx.Where("ticket_id = ? AND status = ?", ticketID, WaitlistStatusWaiting).
+			Order("created_at ASC, id ASC").
+			Find(&waiting).Error
+		if err != nil {
+			return err
+		}
+
+		available := ticket.AvailableTickets
+		expiresAt := now.Add(ttl)
+		for _, entry := range waiting {
+			if entry.TicketCount > available {
+				continue
+			}
+
+			err := tx.Model(&WaitlistEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+				"status":           WaitlistStatusOffered,
+				"claim_token":      helper.GenerateClaimToken(),
+				"offered_at":       now,
+				"offer_expires_at": expiresAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := reserveSeats(tx, ticketID, entry.TicketCount); err != nil {
+				return err
+			}
+
+			offeredIDs = append(offeredIDs, entry.ID)
+			available -= entry.TicketCount
+			if available == 0 {
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil || len(offeredIDs) == 0 {
+		return []WaitlistEntry{}, err
+	}
+
+	var offered []WaitlistEntry
+	err = config.DB.Where("id IN ?", offeredIDs).
+		Preload("User").
+		Preload("Ticket.Event").
+		Order("created_at ASC, id ASC").
+		Find(&offered).Error
+	if err != nil {
+		return []WaitlistEntry{}, err
+	}
+
+	return offered, nil
+}
+
+// ExpireWaitlistOffers gives back the seats of offers that ran out before now
+// and returns the tickets they belonged to
+func ExpireWaitlistOffers(now time.Time) ([]uint, error) {
+	var lapsed []WaitlistEntry
+	err := config.DB.Where("status = ? AND offer_expires_at < ?", WaitlistStatusOffered, now).Find(&lapsed).Error
+	if err != nil {
+		return []uint{}, err
+	}
+
+	ticketIDs := []uint{}
+	for _, entry := range lapsed {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&WaitlistEntry{}).
+				Where("id = ? AND status = ?", entry.ID, WaitlistStatusOffered).
+				Update("status", WaitlistStatusExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			return releaseSeats(tx, entry.TicketID, entry.TicketCount)
+		})
+		if err != nil {
+			return ticketIDs, err
+		}
+
+		ticketIDs = append(ticketIDs, entry.TicketID)
+	}
+
+	return ticketIDs, nil
+}
+
+// ClaimWaitlistOffer books the seats held by an offer for the customer it was
+// made to. The held seats go straight into the booking, which then waits for
+// payment like any other.
+func ClaimWaitlistOffer(token, userID string, booking Booking, now time.Time) (Booking, error) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var entry WaitlistEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("claim_token = ? AND claim_token <> ''", token).
+			First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWaitlistOfferGone
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.UserID != userID {
+			return ErrWaitlistOfferOwner
+		}
+		if entry.Status != WaitlistStatusOffered || entry.OfferExpiresAt == nil || !now.Before(*entry.OfferExpiresAt) {
+			return ErrWaitlistOfferGone
+		}
+
+		if err := releaseSeats(tx, entry.TicketID, entry.TicketCount); err != nil {
+			return err
+		}
+		booking.UserID = entry.UserID
+		booking.TicketID = entry.TicketID
+		booking.TicketCount = entry.TicketCount
+		if err := createBooking(tx, &booking); err != nil {
+			return err
+		}
+
+		return tx.Model(&WaitlistEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+			"status":     WaitlistStatusClaimed,
+			"booking_id": booking.ID,
+		}).Error
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+
+	publishBookingChange("created", booking)
+	return booking, nil
+}
+
+func GetWaitlistEntryByID(id uint) (WaitlistEntry, error) {
+	var entry WaitlistEntry
+
+	err := config.DB.Where("id = ?", id).Preload("Ticket.Event").First(&entry).Error
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func GetWaitlistEntryByClaimToken(token string) (WaitlistEntry, error) {
+	var entry WaitlistEntry
+
+	err := config.DB.Where("claim_token = ? AND claim_token <> ''", token).
+		Preload("Ticket.Event").
+		Preload("Ticket.PriceTiers", preloadPriceTiers).
+		First(&entry).Error
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// GetUserWaitlistEntries lists a customer's waitlist entries, newest first
+func GetUserWaitlistEntries(userID string) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+
+	err := config.DB.Where("user_id = ?", userID).
+		Preload("Ticket.Event").
+		Order("created_at DESC").
+		Find(&entries).Error
+	if err != nil {
+		return []WaitlistEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// GetTicketWaitlist lists a ticket's waitlist in line order
+func GetTicketWaitlist(ticketID uint) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+
+	err := config.DB.Where("ticket_id = ?", ticketID).
+		Preload("User").
+		Order("created_at ASC, id ASC").
+		Find(&entries).Error
+	if err != nil {
+		return []WaitlistEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// GetWaitlistPosition is the entry's place in line for its ticket, 1 for the
+// next customer to be offered seats, or 0 once it is no longer waiting
+func GetWaitlistPosition(entry WaitlistEntry) (int64, error) {
+	if entry.Status != WaitlistStatusWaiting {
+		return 0, nil
+	}
+
+	var ahead int64
+	err := config.DB.Model(&WaitlistEntry{}).
+		Where("ticket_id = ? AND status = ? AND (created_at < ? OR (created_at = ? AND id < ?))",
+			entry.TicketID, WaitlistStatusWaiting, entry.CreatedAt, entry.CreatedAt, entry.ID).
+		Count(&ahead).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return ahead + 1, nil
+}
+
+// GetWaitlistedTicketIDs lists the tickets that have customers waiting
+func GetWaitlistedTicketIDs() ([]uint, error) {
+	var ticketIDs []uint
+	err := config.DB.Model(&WaitlistEntry{}).
+		Where("status = ?", WaitlistStatusWaiting).
+		Distinct().
+		Pluck("ticket_id", &ticketIDs).Error
+	if err != nil {
+		return []uint{}, err
+	}
+
+	return ticketIDs, nil
+}
@@ -0,0 +1,520 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/helper"
+)
+
+// Cashfree Payment Links API Request/Response structures based on official documentation
+type CashfreePaymentLinkRequest struct {
+	LinkID          string `json:"link_id,omitempty"`
+	CustomerDetails struct {
+		CustomerEmail string `json:"customer_email"`
+		CustomerName  string `json:"customer_name"`
+		CustomerPhone string `json:"customer_phone"`
+	} `json:"customer_details"`
+	LinkAmount   float64 `json:"link_amount"`
+	LinkCurrency string  `json:"link_currency"`
+	LinkPurpose  string  `json:"link_purpose"`
+	LinkMeta     struct {
+		NotifyURL string `json:"notify_url"`
+		ReturnURL string `json:"return_url"`
+	} `json:"link_meta"`
+	LinkNotify struct {
+		SendEmail bool `json:"send_email"`
+		SendSMS   bool `json:"send_sms"`
+	} `json:"link_notify"`
+	LinkAutoReminders bool   `json:"link_auto_reminders"`
+	LinkExpiryTime    string `json:"link_expiry_time,omitempty"`
+}
+
+type CashfreePaymentLinkResponse struct {
+	CfLinkID        FlexString `json:"cf_link_id"`
+	LinkID          string     `json:"link_id"`
+	LinkStatus      string     `json:"link_status"`
+	LinkCurrency    string     `json:"link_currency"`
+	LinkAmount      float64    `json:"link_amount"`
+	LinkAmountPaid  float64    `json:"link_amount_paid"`
+	LinkPurpose     string     `json:"link_purpose"`
+	LinkCreatedAt   string     `json:"link_created_at"`
+	CustomerDetails struct {
+		CustomerName  string `json:"customer_name"`
+		CustomerPhone string `json:"customer_phone"`
+		CustomerEmail string `json:"customer_email"`
+	} `json:"customer_details"`
+	LinkMeta struct {
+		NotifyURL string `json:"notify_url"`
+		ReturnURL string `json:"return_url"`
+	} `json:"link_meta"`
+	LinkURL        string `json:"link_url"`
+	LinkExpiryTime string `json:"link_expiry_time"`
+	LinkQRCode     string `json:"link_qrcode"`
+	LinkNotify     struct {
+		SendSMS   bool `json:"send_sms"`
+		SendEmail bool `json:"send_email"`
+	} `json:"link_notify"`
+}
+
+type CashfreePaymentDetails struct {
+	CfPaymentID     FlexString      `json:"cf_payment_id"`
+	OrderID         string          `json:"order_id"`
+	Entity          string          `json:"entity"`
+	OrderAmount     float64         `json:"order_amount"`
+	PaymentAmount   float64         `json:"payment_amount"`
+	PaymentCurrency string          `json:"payment_currency"`
+	PaymentStatus   string          `json:"payment_status"`
+	PaymentMessage  string          `json:"payment_message"`
+	BankReference   string          `json:"bank_reference"`
+	AuthID          string          `json:"auth_id"`
+	PaymentMethod   json.RawMessage `json:"payment_method"`
+	PaymentTime     string          `json:"payment_time"`
+	PaymentGroup    string          `json:"payment_group"`
+	CustomerDetails struct {
+		CustomerID    string `json:"customer_id"`
+		CustomerName  string `json:"customer_name"`
+		CustomerEmail string `json:"customer_email"`
+		CustomerPhone string `json:"customer_phone"`
+	} `json:"customer_details"`
+}
+
+type CashfreeRefundRequest struct {
+	RefundAmount float64 `json:"refund_amount"`
+	RefundID     string  `json:"refund_id"`
+	RefundNote   string  `json:"refund_note,omitempty"`
+}
+
+type CashfreeRefundResponse struct {
+	CfRefundID     FlexString `json:"cf_refund_id"`
+	RefundID       string     `json:"refund_id"`
+	OrderID        string     `json:"order_id"`
+	RefundAmount   float64    `json:"refund_amount"`
+	RefundCurrency string     `json:"refund_currency"`
+	RefundStatus   string     `json:"refund_status"`
+	RefundNote     string     `json:"refund_note"`
+}
+
+// CashfreeWebhookEvent is the envelope shared by all Cashfree webhooks
+type CashfreeWebhookEvent struct {
+	Type      string          `json:"type"`
+	EventTime string          `json:"event_time"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// CashfreePaymentLinkEventData is the data of a PAYMENT_LINK_EVENT webhook
+type CashfreePaymentLinkEventData struct {
+	CfLinkID       FlexString `json:"cf_link_id"`
+	LinkID         FlexString `json:"link_id"`
+	LinkStatus     string     `json:"link_status"`
+	LinkCurrency   string     `json:"link_currency"`
+	LinkAmount     FlexString `json:"link_amount"`
+	LinkAmountPaid FlexString `json:"link_amount_paid"`
+	Order          struct {
+		OrderID           FlexString `json:"order_id"`
+		OrderAmount       FlexString `json:"order_amount"`
+		TransactionID     FlexString `json:"transaction_id"`
+		TransactionStatus string     `json:"transaction_status"`
+	} `json:"order"`
+}
+
+// CashfreePaymentEventData is the data of the PAYMENT_*_WEBHOOK events
+type CashfreePaymentEventData struct {
+	Order struct {
+		OrderID       FlexString `json:"order_id"`
+		OrderAmount   FlexString `json:"order_amount"`
+		OrderCurrency string     `json:"order_currency"`
+		OrderTags     struct {
+			LinkID   FlexString `json:"link_id"`
+			CfLinkID FlexString `json:"cf_link_id"`
+		} `json:"order_tags"`
+	} `json:"order"`
+	Payment struct {
+		CfPaymentID     FlexString      `json:"cf_payment_id"`
+		PaymentStatus   string          `json:"payment_status"`
+		PaymentAmount   FlexString      `json:"payment_amount"`
+		PaymentCurrency string          `json:"payment_currency"`
+		PaymentMessage  string          `json:"payment_message"`
+		PaymentTime     string          `json:"payment_time"`
+		BankReference   string          `json:"bank_reference"`
+		PaymentGroup    string          `json:"payment_group"`
+		PaymentMethod   json.RawMessage `json:"payment_method"`
+	} `json:"payment"`
+}
+
+// CashfreeRefundEventData is the data of a REFUND_STATUS_WEBHOOK event
+type CashfreeRefundEventData struct {
+	Refund struct {
+		CfRefundID   FlexString `json:"cf_refund_id"`
+		RefundID     string     `json:"refund_id"`
+		OrderID      string     `json:"order_id"`
+		RefundAmount FlexString `json:"refund_amount"`
+		RefundStatus string     `json:"refund_status"`
+	} `json:"refund"`
+}
+
+// FlexString accepts both JSON strings and numbers, since Cashfree is not
+// consistent about quoting IDs and amounts
+type FlexString string
+
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = FlexString(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = FlexString(n.String())
+	return nil
+}
+
+// Float returns the value as a number, or 0 if it isn't one
+func (f FlexString) Float() float64 {
+	value, _ := strconv.ParseFloat(string(f), 64)
+	return value
+}
+
+// CashfreeGateway implements PaymentGateway against the Cashfree PG API
+type CashfreeGateway struct {
+	ClientID      string
+	ClientSecret  string
+	APIURL        string
+	WebhookSecret string
+	// WebhookTolerance bounds the age of x-webhook-timestamp to reject replays
+	WebhookTolerance time.Duration
+	HTTPClient       *http.Client
+}
+
+// NewCashfreeGatewayFromEnv builds the gateway from CASHFREE_* environment variables.
+// CASHFREE_WEBHOOK_SECRET overrides the client secret if a dedicated key is configured.
+// CASHFREE_WEBHOOK_TOLERANCE, a duration such as "5m", must be positive.
+func NewCashfreeGatewayFromEnv() (*CashfreeGateway, error) {
+	webhookSecret := os.Getenv("CASHFREE_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		webhookSecret = os.Getenv("CASHFREE_CLIENT_SECRET")
+	}
+
+	tolerance := 5 * time.Minute
+	if value := os.Getenv("CASHFREE_WEBHOOK_TOLERANCE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CASHFREE_WEBHOOK_TOLERANCE %q: %w", value, err)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("invalid CASHFREE_WEBHOOK_TOLERANCE %q: %w", value, helper.ErrWebhookToleranceInvalid)
+		}
+		tolerance = parsed
+	}
+
+	return &CashfreeGateway{
+		ClientID:         os.Getenv("CASHFREE_CLIENT_ID"),
+		ClientSecret:     os.Getenv("CASHFREE_CLIENT_SECRET"),
+		APIURL:           os.Getenv("CASHFREE_API_URL"),
+		WebhookSecret:    webhookSecret,
+		WebhookTolerance: tolerance,
+		HTTPClient:       &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// CreateLink creates a payment link using the Create Payment Link API
+func (g *CashfreeGateway) CreateLink(req LinkRequest) (*Link, error) {
+	cashfreeReq := CashfreePaymentLinkRequest{
+		LinkID:            req.LinkID,
+		LinkAmount:        req.Amount,
+		LinkCurrency:      req.Currency,
+		LinkPurpose:       req.Purpose,
+		LinkAutoReminders: true,
+	}
+	cashfreeReq.CustomerDetails.CustomerEmail = req.CustomerEmail
+	cashfreeReq.CustomerDetails.CustomerName = req.CustomerName
+	cashfreeReq.CustomerDetails.CustomerPhone = req.CustomerPhone
+	cashfreeReq.LinkMeta.NotifyURL = req.NotifyURL
+	cashfreeReq.LinkMeta.ReturnURL = req.ReturnURL
+	if !req.ExpiresAt.IsZero() {
+		cashfreeReq.LinkExpiryTime = req.ExpiresAt.Format(time.RFC3339)
+	}
+
+	respBody, err := g.do("POST", "/links", "2025-01-01", cashfreeReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var cashfreeResp CashfreePaymentLinkResponse
+	if err := json.Unmarshal(respBody, &cashfreeResp); err != nil {
+		return nil, err
+	}
+
+	return &Link{
+		ProviderLinkID: string(cashfreeResp.CfLinkID),
+		LinkID:         cashfreeResp.LinkID,
+		Status:         cashfreeResp.LinkStatus,
+		Amount:         cashfreeResp.LinkAmount,
+		AmountPaid:     cashfreeResp.LinkAmountPaid,
+		Currency:       cashfreeResp.LinkCurrency,
+		URL:            cashfreeResp.LinkURL,
+		ExpiresAt:      cashfreeResp.LinkExpiryTime,
+		RawPayload:     string(respBody),
+	}, nil
+}
+
+// CancelLink uses the Cancel Payment Link API (/links/{link_id}/cancel). Only
+// ACTIVE links can be cancelled; when the cancel is refused the link is looked
+// up so a link that already closed returns ErrLinkNotPayable.
+func (g *CashfreeGateway) CancelLink(linkID string) (*Link, error) {
+	respBody, err := g.do("POST", "/links/"+linkID+"/cancel", "2023-08-01", nil)
+	if err != nil {
+		if status, getErr := g.getLinkStatus(linkID); getErr == nil && status != "ACTIVE" {
+			return nil, fmt.Errorf("%w: link is %s", ErrLinkNotPayable, status)
+		}
+		return nil, err
+	}
+
+	var cashfreeResp CashfreePaymentLinkResponse
+	if err := json.Unmarshal(respBody, &cashfreeResp); err != nil {
+		return nil, err
+	}
+
+	return &Link{
+		ProviderLinkID: string(cashfreeResp.CfLinkID),
+		LinkID:         cashfreeResp.LinkID,
+		Status:         cashfreeResp.LinkStatus,
+		Amount:         cashfreeResp.LinkAmount,
+		AmountPaid:     cashfreeResp.LinkAmountPaid,
+		Currency:       cashfreeResp.LinkCurrency,
+		URL:            cashfreeResp.LinkURL,
+		ExpiresAt:      cashfreeResp.LinkExpiryTime,
+		RawPayload:     string(respBody),
+	}, nil
+}
+
+// getLinkStatus uses the Get Payment Link Details API (/links/{link_id}) and
+// returns the link_status
+func (g *CashfreeGateway) getLinkStatus(linkID string) (string, error) {
+	respBody, err := g.do("GET", "/links/"+linkID, "2023-08-01", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var cashfreeResp CashfreePaymentLinkResponse
+	if err := json.Unmarshal(respBody, &cashfreeResp); err != nil {
+		return "", err
+	}
+
+	return cashfreeResp.LinkStatus, nil
+}
+
+// GetLinkStatus uses the Get Orders for a Payment Link API (/links/{link_id}/orders)
+func (g *CashfreeGateway) GetLinkStatus(linkID string) (*PaymentStatus, error) {
+	respBody, err := g.do("GET", "/links/"+linkID+"/orders", "2023-08-01", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response - Cashfree returns an array of orders
+	var ordersResponse []struct {
+		CfOrderID        FlexString `json:"cf_order_id"`
+		OrderID          string     `json:"order_id"`
+		OrderAmount      float64    `json:"order_amount"`
+		OrderCurrency    string     `json:"order_currency"`
+		OrderStatus      string     `json:"order_status"`
+		OrderNote        string     `json:"order_note"`
+		CreatedAt        string     `json:"created_at"`
+		PaymentSessionID string     `json:"payment_session_id"`
+	}
+
+	if err := json.Unmarshal(respBody, &ordersResponse); err != nil {
+		return nil, err
+	}
+
+	// If no orders found, return a pending status
+	if len(ordersResponse) == 0 {
+		return &PaymentStatus{
+			OrderID:       linkID,
+			PaymentID:     linkID,
+			TransactionID: linkID,
+			Status:        "pending",
+			Amount:        0,
+			Currency:      "INR",
+			PaymentMethod: "cashfree",
+			PaymentDate:   time.Now(),
+			Message:       "No orders found for this payment link",
+			RawPayload:    string(respBody),
+		}, nil
+	}
+
+	// Get the first order (most recent)
+	order := ordersResponse[0]
+
+	return &PaymentStatus{
+		OrderID:       order.OrderID,
+		PaymentID:     string(order.CfOrderID),
+		TransactionID: order.PaymentSessionID,
+		Status:        MapOrderStatus(order.OrderStatus),
+		Amount:        order.OrderAmount,
+		Currency:      order.OrderCurrency,
+		PaymentMethod: "cashfree",
+		PaymentDate:   time.Now(),
+		Message:       order.OrderNote,
+		RawPayload:    string(respBody),
+	}, nil
+}
+
+// GetPayments uses the Get Payments for an Order API (/orders/{order_id}/payments)
+func (g *CashfreeGateway) GetPayments(orderID string) ([]PaymentDetails, error) {
+	respBody, err := g.do("GET", "/orders/"+orderID+"/payments", "2023-08-01", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentsResponse []CashfreePaymentDetails
+	if err := json.Unmarshal(respBody, &paymentsResponse); err != nil {
+		return nil, err
+	}
+
+	payments := make([]PaymentDetails, 0, len(paymentsResponse))
+	for _, p := range paymentsResponse {
+		raw, _ := json.Marshal(p)
+		payments = append(payments, PaymentDetails{
+			PaymentID:     string(p.CfPaymentID),
+			OrderID:       p.OrderID,
+			Amount:        p.PaymentAmount,
+			Currency:      p.PaymentCurrency,
+			Status:        MapPaymentStatus(p.PaymentStatus),
+			Message:       p.PaymentMessage,
+			Method:        p.PaymentGroup,
+			BankReference: p.BankReference,
+			PaymentTime:   p.PaymentTime,
+			RawPayload:    string(raw),
+		})
+	}
+
+	return payments, nil
+}
+
+// Refund uses the Create Refund API (/orders/{order_id}/refunds)
+func (g *CashfreeGateway) Refund(req RefundRequest) (*Refund, error) {
+	if req.OrderID == "" || req.RefundID == "" || req.Amount <= 0 {
+		return nil, ErrInvalidRefund
+	}
+
+	respBody, err := g.do("POST", "/orders/"+req.OrderID+"/refunds", "2023-08-01", CashfreeRefundRequest{
+		RefundAmount: req.Amount,
+		RefundID:     req.RefundID,
+		RefundNote:   req.Note,
+	})
+	if err != nil {
+		// A client error is Cashfree refusing the refund; timeouts, rate
+		// limits and server errors leave it unknown whether it was made
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+			apiErr.StatusCode != http.StatusRequestTimeout && apiErr.StatusCode != http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRefund, apiErr.Body)
+		}
+		return nil, err
+	}
+
+	var refundResp CashfreeRefundResponse
+	if err := json.Unmarshal(respBody, &refundResp); err != nil {
+		return nil, err
+	}
+
+	return &Refund{
+		RefundID:         refundResp.RefundID,
+		ProviderRefundID: string(refundResp.CfRefundID),
+		OrderID:          refundResp.OrderID,
+		Amount:           refundResp.RefundAmount,
+		Currency:         refundResp.RefundCurrency,
+		Status:           MapRefundStatus(refundResp.RefundStatus),
+		RawPayload:       string(respBody),
+	}, nil
+}
+
+// VerifyWebhook checks the x-webhook-signature and x-webhook-timestamp headers
+func (g *CashfreeGateway) VerifyWebhook(header http.Header, body []byte) error {
+	return helper.VerifyCashfreeWebhookSignature(
+		g.WebhookSecret,
+		header.Get("x-webhook-signature"),
+		header.Get("x-webhook-timestamp"),
+		body,
+		time.Now(),
+		g.WebhookTolerance,
+	)
+}
+
+// do sends an authenticated request to the Cashfree API and returns the raw
+// response body of a 2xx response
+func (g *CashfreeGateway) do(method, path, apiVersion string, payload interface{}) ([]byte, error) {
+	if g.ClientID == "" || g.ClientSecret == "" || g.APIURL == "" {
+		return nil, ErrNotConfigured
+	}
+
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	httpReq, err := http.NewRequest(method, g.APIURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set headers according to Cashfree documentation
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("x-client-id", g.ClientID)
+	httpReq.Header.Set("x-client-secret", g.ClientSecret)
+	httpReq.Header.Set("x-api-version", apiVersion)
+
+	client := g.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	return respBody, nil
+}
+
+// APIError is a response from the Cashfree API with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return "cashfree API error: " + e.Body
+}
@@ -0,0 +1,98 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCashfreeGatewayFromEnvTolerance(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 5 * time.Minute},
+		{value: "90s", want: 90 * time.Second},
+		{value: "5", wantErr: true},
+		{value: "five minutes", wantErr: true},
+		{value: "0s", wantErr: true},
+		{value: "-1m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("CASHFREE_WEBHOOK_TOLERANCE", tt.value)
+
+			gateway, err := NewCashfreeGatewayFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted tolerance %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rejected tolerance %q: %v", tt.value, err)
+			}
+			if gateway.WebhookTolerance != tt.want {
+				t.Errorf("got tolerance %v, want %v", gateway.WebhookTolerance, tt.want)
+			}
+		})
+	}
+}
+
+func TestCashfreeCancelLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		cancelCode int
+		linkStatus string
+		wantErr    error
+	}{
+		{name: "active link", cancelCode: http.StatusOK, linkStatus: "CANCELLED"},
+		{name: "already paid", cancelCode: http.StatusBadRequest, linkStatus: "PAID", wantErr: ErrLinkNotPayable},
+		{name: "expired", cancelCode: http.StatusBadRequest, linkStatus: "EXPIRED", wantErr: ErrLinkNotPayable},
+		{name: "refused while active", cancelCode: http.StatusInternalServerError, linkStatus: "ACTIVE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/links/link-1/cancel":
+					w.WriteHeader(tt.cancelCode)
+					if tt.cancelCode != http.StatusOK {
+						fmt.Fprint(w, `{"message":"link is not active","code":"link_post_failed"}`)
+						return
+					}
+					fmt.Fprint(w, `{"link_id":"link-1","link_status":"CANCELLED"}`)
+				case r.Method == http.MethodGet && r.URL.Path == "/links/link-1":
+					fmt.Fprintf(w, `{"link_id":"link-1","link_status":%q}`, tt.linkStatus)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			gateway := &CashfreeGateway{ClientID: "id", ClientSecret: "secret", APIURL: server.URL}
+			link, err := gateway.CancelLink("link-1")
+
+			switch {
+			case tt.cancelCode == http.StatusOK:
+				if err != nil || link.Status != "CANCELLED" {
+					t.Errorf("got %v, %v", link, err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, ErrLinkNotPayable) {
+					t.Errorf("got %v, want the gateway error", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jezhtech/prince-group-backend/helper"
+)
+
+// FakeGateway is an in-memory PaymentGateway for tests and local development.
+// Links stay ACTIVE until one of the Simulate methods settles them, and all
+// identifiers come from a counter so runs are reproducible.
+type FakeGateway struct {
+	// BaseURL prefixes the generated link URLs
+	BaseURL string
+	// WebhookSecret signs webhooks; when empty every webhook is accepted
+	WebhookSecret string
+	// Now is the clock used for timestamps
+	Now func() time.Time
+
+	mu       sync.Mutex
+	sequence int
+	links    map[string]*fakeLink
+	orders   map[string]*fakeLink
+}
+
+type fakeLink struct {
+	link     Link
+	orderID  string
+	payments []PaymentDetails
+	refunded float64
+	refunds  []Refund
+}
+
+// Outcomes accepted by Simulate
+const (
+	FakeOutcomePaid    = "paid"
+	FakeOutcomeFailed  = "failed"
+	FakeOutcomeExpired = "expired"
+)
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		BaseURL: "http://localhost:8000/fake-pay",
+		Now:     time.Now,
+		links:   make(map[string]*fakeLink),
+		orders:  make(map[string]*fakeLink),
+	}
+}
+
+func (f *FakeGateway) nextID(prefix string) string {
+	f.sequence++
+	return prefix + "_" + strconv.Itoa(f.sequence)
+}
+
+func (f *FakeGateway) CreateLink(req LinkRequest) (*Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.LinkID == "" {
+		req.LinkID = f.nextID("fake_link")
+	}
+	if req.Currency == "" {
+		req.Currency = "INR"
+	}
+	expiresAt := f.Now().Add(24 * time.Hour)
+	if !req.ExpiresAt.IsZero() {
+		expiresAt = req.ExpiresAt
+	}
+
+	entry := &fakeLink{
+		link: Link{
+			ProviderLinkID: f.nextID("fake_cf_link"),
+			LinkID:         req.LinkID,
+			Status:         "ACTIVE",
+			Amount:         req.Amount,
+			Currency:       req.Currency,
+			URL:            f.BaseURL + "/" + req.LinkID,
+			ExpiresAt:      expiresAt.Format(time.RFC3339),
+		},
+		orderID: f.nextID("fake_order"),
+	}
+	entry.link.RawPayload = fakePayload(entry.link)
+
+	f.links[req.LinkID] = entry
+	f.orders[entry.orderID] = entry
+
+	link := entry.link
+	return &link, nil
+}
+
+func (f *FakeGateway) CancelLink(linkID string) (*Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.links[linkID]
+	if !ok {
+		return nil, ErrLinkNotFound
+	}
+	if entry.link.Status != "ACTIVE" {
+		return nil, ErrLinkNotPayable
+	}
+
+	entry.link.Status = "CANCELLED"
+	entry.link.RawPayload = fakePayload(entry.link)
+
+	link := entry.link
+	return &link, nil
+}
+
+func (f *FakeGateway) GetLinkStatus(linkID string) (*PaymentStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.links[linkID]
+	if !ok {
+		return nil, ErrLinkNotFound
+	}
+
+	status := &PaymentStatus{
+		OrderID:       entry.orderID,
+		PaymentID:     entry.orderID,
+		Status:        MapPaymentLinkStatus(entry.link.Status),
+		Amount:        entry.link.Amount,
+		Currency:      entry.link.Currency,
+		PaymentMethod: "fake",
+		PaymentDate:   f.Now(),
+	}
+	// A failed attempt leaves the link active, like Cashfree does, but the
+	// latest order is reported as failed
+	if n := len(entry.payments); n > 0 && entry.link.Status == "ACTIVE" {
+		status.Status = entry.payments[n-1].Status
+	}
+	status.RawPayload = fakePayload(status)
+
+	return status, nil
+}
+
+func (f *FakeGateway) GetPayments(orderID string) ([]PaymentDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.orders[orderID]
+	if !ok {
+		return nil, ErrLinkNotFound
+	}
+
+	return append([]PaymentDetails{}, entry.payments...), nil
+}
+
+func (f *FakeGateway) Refund(req RefundRequest) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.orders[req.OrderID]
+	if !ok {
+		return nil, ErrLinkNotFound
+	}
+
+	// Retrying a refund ID returns the original refund, as Cashfree does
+	for _, refund := range entry.refunds {
+		if refund.RefundID == req.RefundID {
+			existing := refund
+			return &existing, nil
+		}
+	}
+
+	if req.RefundID == "" || req.Amount <= 0 || entry.link.Status != "PAID" || entry.refunded+req.Amount > entry.link.AmountPaid+0.005 {
+		return nil, ErrInvalidRefund
+	}
+
+	entry.refunded += req.Amount
+	refund := Refund{
+		RefundID:         req.RefundID,
+		ProviderRefundID: f.nextID("fake_refund"),
+		OrderID:          req.OrderID,
+		Amount:           req.Amount,
+		Currency:         entry.link.Currency,
+		Status:           "success",
+	}
+	refund.RawPayload = fakePayload(refund)
+	entry.refunds = append(entry.refunds, refund)
+
+	return &refund, nil
+}
+
+func (f *FakeGateway) VerifyWebhook(header http.Header, body []byte) error {
+	if f.WebhookSecret == "" {
+		return nil
+	}
+
+	return helper.VerifyCashfreeWebhookSignature(
+		f.WebhookSecret,
+		header.Get("x-webhook-signature"),
+		header.Get("x-webhook-timestamp"),
+		body,
+		f.Now(),
+		5*time.Minute,
+	)
+}
+
+// Simulate settles a link with one of the FakeOutcome* values. Paid and
+// failed record a payment attempt; expired closes the link without one.
+func (f *FakeGateway) Simulate(linkID, outcome string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.links[linkID]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	if entry.link.Status != "ACTIVE" {
+		return ErrLinkNotPayable
+	}
+
+	switch outcome {
+	case FakeOutcomePaid:
+		entry.link.Status = "PAID"
+		entry.link.AmountPaid = entry.link.Amount
+		entry.payments = append(entry.payments, f.newPayment(entry, "success"))
+	case FakeOutcomeFailed:
+		entry.payments = append(entry.payments, f.newPayment(entry, "failed"))
+	case FakeOutcomeExpired:
+		entry.link.Status = "EXPIRED"
+	default:
+		return fmt.Errorf("unknown fake payment outcome %q", outcome)
+	}
+
+	return nil
+}
+
+func (f *FakeGateway) newPayment(entry *fakeLink, status string) PaymentDetails {
+	payment := PaymentDetails{
+		PaymentID:   f.nextID("fake_payment"),
+		OrderID:     entry.orderID,
+		Amount:      entry.link.Amount,
+		Currency:    entry.link.Currency,
+		Status:      status,
+		Method:      "fake",
+		PaymentTime: f.Now().Format(time.RFC3339),
+	}
+	payment.RawPayload = fakePayload(payment)
+	return payment
+}
+
+func fakePayload(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,175 @@
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrLinkNotFound   = errors.New("payment link not found")
+	ErrNoPayments     = errors.New("no payment details found")
+	ErrNotConfigured  = errors.New("payment gateway configuration missing")
+	ErrInvalidRefund  = errors.New("invalid refund request")
+	ErrLinkNotPayable = errors.New("payment link is not active")
+)
+
+// PaymentGateway is everything the booking flow needs from a payment provider.
+// CashfreeGateway talks to the real API; FakeGateway keeps links in memory so
+// the whole booking-to-payment flow can run without a sandbox account.
+type PaymentGateway interface {
+	// CreateLink creates a hosted payment link for a booking
+	CreateLink(req LinkRequest) (*Link, error)
+	// CancelLink deactivates an unpaid link so it can no longer be paid. A
+	// link that is no longer active (paid, expired or cancelled) returns
+	// ErrLinkNotPayable.
+	CancelLink(linkID string) (*Link, error)
+	// GetLinkStatus reports the state of the most recent order on a link
+	GetLinkStatus(linkID string) (*PaymentStatus, error)
+	// GetPayments lists the payment attempts made against an order
+	GetPayments(orderID string) ([]PaymentDetails, error)
+	// Refund refunds all or part of a paid order. A refund the provider
+	// refuses returns ErrInvalidRefund; after any other error it is unknown
+	// whether the refund was made, and it is retried with the same RefundID.
+	Refund(req RefundRequest) (*Refund, error)
+	// VerifyWebhook authenticates a webhook request from the provider
+	VerifyWebhook(header http.Header, body []byte) error
+}
+
+// LinkRequest describes the payment link to create
+type LinkRequest struct {
+	LinkID        string
+	Amount        float64
+	Currency      string
+	Purpose       string
+	CustomerName  string
+	CustomerEmail string
+	CustomerPhone string
+	NotifyURL     string
+	ReturnURL     string
+	// ExpiresAt, when set, closes the link at the end of the booking's hold
+	ExpiresAt time.Time
+}
+
+// Link is a payment link as reported by the provider. Status uses the
+// provider's link vocabulary (ACTIVE, PAID, EXPIRED, CANCELLED, ...); use
+// MapPaymentLinkStatus to translate it.
+type Link struct {
+	ProviderLinkID string
+	LinkID         string
+	Status         string
+	Amount         float64
+	AmountPaid     float64
+	Currency       string
+	URL            string
+	ExpiresAt      string
+	RawPayload     string
+}
+
+type PaymentStatus struct {
+	OrderID       string    `json:"orderId"`
+	PaymentID     string    `json:"paymentId"`
+	TransactionID string    `json:"transactionId"`
+	Status        string    `json:"status"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency"`
+	PaymentMethod string    `json:"paymentMethod"`
+	PaymentDate   time.Time `json:"paymentDate"`
+	Message       string    `json:"message,omitempty"`
+	RawPayload    string    `json:"-"`
+}
+
+// PaymentDetails is a single payment attempt against an order
+type PaymentDetails struct {
+	PaymentID     string  `json:"paymentId"`
+	OrderID       string  `json:"orderId"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	Status        string  `json:"status"`
+	Message       string  `json:"message,omitempty"`
+	Method        string  `json:"method"`
+	BankReference string  `json:"bankReference,omitempty"`
+	PaymentTime   string  `json:"paymentTime"`
+	RawPayload    string  `json:"-"`
+}
+
+// RefundRequest refunds Amount of a paid order. RefundID is our own
+// identifier and makes retries idempotent on the provider side.
+type RefundRequest struct {
+	OrderID  string
+	RefundID string
+	Amount   float64
+	Note     string
+}
+
+// Refund is a refund as reported by the provider. Status is mapped to
+// pending, success or failed.
+type Refund struct {
+	RefundID         string
+	ProviderRefundID string
+	OrderID          string
+	Amount           float64
+	Currency         string
+	Status           string
+	RawPayload       string
+}
+
+// MapPaymentLinkStatus maps a provider payment link status to our status
+func MapPaymentLinkStatus(linkStatus string) string {
+	switch linkStatus {
+	case "ACTIVE":
+		return "pending"
+	case "PAID":
+		return "success"
+	case "EXPIRED":
+		return "failed"
+	case "CANCELLED":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// MapOrderStatus maps a provider order status to our status
+func MapOrderStatus(orderStatus string) string {
+	switch orderStatus {
+	case "ACTIVE":
+		return "pending"
+	case "PAID":
+		return "success"
+	case "EXPIRED":
+		return "failed"
+	case "CANCELLED":
+		return "failed"
+	case "PENDING":
+		return "pending"
+	case "FAILED":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// MapPaymentStatus maps a provider payment (attempt) status to our status
+func MapPaymentStatus(paymentStatus string) string {
+	switch paymentStatus {
+	case "SUCCESS":
+		return "success"
+	case "FAILED":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// MapRefundStatus maps a provider refund status to our status
+func MapRefundStatus(refundStatus string) string {
+	switch refundStatus {
+	case "SUCCESS":
+		return "success"
+	case "CANCELLED", "FAILED":
+		return "failed"
+	default:
+		return "pending"
+	}
+}
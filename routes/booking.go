@@ -17,4 +17,20 @@ func BookingRoutes(router *gin.RouterGroup) {
 	bookingRouter.DELETE("/:id", middleware.UserMiddleware(), controllers.DeleteBooking)
 	bookingRouter.GET("/user", middleware.UserMiddleware(), controllers.GetBookingsByUserId)
 	bookingRouter.GET("/check-payment/:bookingNumber", middleware.UserMiddleware(), controllers.CheckPayment)
+	bookingRouter.GET("/admin/history/:bookingNumber", middleware.AdminMiddleware(), controllers.GetBookingStatusHistory)
+
+	// Per-seat passes
+	bookingRouter.GET("/:bookingNumber/passes", middleware.UserMiddleware(), controllers.GetBookingPasses)
+	bookingRouter.PUT("/:bookingNumber/passes/:passId", middleware.UserMiddleware(), controllers.AssignPass)
+
+	// Cancellation and refunds
+	bookingRouter.POST("/:bookingNumber/cancel", middleware.UserMiddleware(), controllers.CancelBooking)
+	bookingRouter.GET("/admin/refunds", middleware.AdminMiddleware(), controllers.GetRefunds)
+	bookingRouter.POST("/admin/refund/:bookingNumber", middleware.AdminMiddleware(), controllers.RefundBooking)
+	bookingRouter.POST("/admin/refund/:bookingNumber/reject", middleware.AdminMiddleware(), controllers.RejectRefundRequest)
+
+	// Transfers to another customer
+	bookingRouter.POST("/:bookingNumber/transfer", middleware.UserMiddleware(), controllers.TransferBooking)
+	bookingRouter.DELETE("/transfer/:bookingNumber", middleware.UserMiddleware(), controllers.CancelBookingTransfer)
+	bookingRouter.GET("/:bookingNumber/transfers", middleware.UserMiddleware(), controllers.GetBookingTransfers)
 }
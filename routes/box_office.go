@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func BoxOfficeRoutes(router *gin.RouterGroup) {
+	boxOfficeRouter := router.Group("/box-office")
+
+	boxOfficeRouter.POST("/bookings", middleware.BoxOfficeMiddleware(), controllers.CreateBoxOfficeBooking)
+	boxOfficeRouter.GET("/report", middleware.BoxOfficeMiddleware(), controllers.GetBoxOfficeReport)
+}
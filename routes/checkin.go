@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func CheckInRoutes(router *gin.RouterGroup) {
+	checkInRouter := router.Group("/checkin")
+
+	checkInRouter.POST("/validate", middleware.ScannerMiddleware(), controllers.ValidateCheckIn)
+	checkInRouter.POST("/", middleware.ScannerMiddleware(), controllers.CheckIn)
+	checkInRouter.POST("/group", middleware.ScannerMiddleware(), controllers.CheckInGroup)
+	checkInRouter.GET("/keys", middleware.ScannerMiddleware(), controllers.GetTicketSigningKeys)
+
+	// Offline scanner devices
+	checkInRouter.GET("/manifest", middleware.ScannerMiddleware(), controllers.GetCheckInManifest)
+	checkInRouter.POST("/sync", middleware.ScannerMiddleware(), controllers.SyncCheckIns)
+}
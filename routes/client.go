@@ -12,4 +12,5 @@ func ClientRoutes(router *gin.RouterGroup) {
 	// Client-specific booking routes
 	clientRouter.GET("/bookings/paginated", middleware.ClientMiddleware(), controllers.GetClientBookingsPaginated)
 	clientRouter.GET("/bookings/stats", middleware.ClientMiddleware(), controllers.GetClientBookingsStats)
+	clientRouter.GET("/bookings/stream", middleware.ClientMiddleware(), controllers.StreamClientBookingStats)
 }
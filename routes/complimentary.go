@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func ComplimentaryRoutes(router *gin.RouterGroup) {
+	compRouter := router.Group("/complimentary")
+
+	compRouter.GET("/categories", middleware.AdminMiddleware(), controllers.GetCompCategories)
+	compRouter.POST("/categories", middleware.AdminMiddleware(), controllers.CreateCompCategory)
+	compRouter.PUT("/categories/:id", middleware.AdminMiddleware(), controllers.UpdateCompCategory)
+	compRouter.DELETE("/categories/:id", middleware.AdminMiddleware(), controllers.DeleteCompCategory)
+
+	compRouter.GET("/", middleware.AdminMiddleware(), controllers.GetComplimentaryTickets)
+	compRouter.POST("/", middleware.AdminMiddleware(), controllers.IssueComplimentaryTickets)
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// maxCompGuests is the guest list limit of the complimentary endpoint
+const maxCompGuests = 500
+
+// TestIssueComplimentaryTicketsFullBatch issues the largest guest list
+// allowed in one call. Its booking numbers are drawn within a second or two,
+// from few random values per second, so the batch must not reuse any.
+func TestIssueComplimentaryTicketsFullBatch(t *testing.T) {
+	router := newTestRouter(t)
+
+	admin := testdb.CreateUser(t, "admin")
+	ticket := testdb.CreateTicket(t, maxCompGuests)
+	category, err := models.CreateCompCategory(models.CompCategory{EventID: *ticket.EventID, Name: "Guest list"})
+	if err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	guests := make([]string, maxCompGuests)
+	for i := range guests {
+		guests[i] = fmt.Sprintf(`{"name":"Guest %d"}`, i+1)
+	}
+	body := fmt.Sprintf(`{"categoryId":%d,"ticketId":%d,"reason":"test","guests":[%s]}`, category.ID, ticket.ID, strings.Join(guests, ","))
+
+	rec := serve(router, http.MethodPost, "/api/v1/complimentary/", admin.FirebaseID, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("issue: got %d: %s", rec.Code, rec.Body.String())
+	}
+	var issued struct {
+		Tickets []models.ComplimentaryTicket `json:"tickets"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("failed to decode tickets: %v", err)
+	}
+	if len(issued.Tickets) != maxCompGuests {
+		t.Errorf("issued %d tickets, want %d", len(issued.Tickets), maxCompGuests)
+	}
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 0 {
+		t.Errorf("%d seats left, want 0", seats)
+	}
+}
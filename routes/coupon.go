@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func CouponRoutes(router *gin.RouterGroup) {
+	couponRouter := router.Group("/coupon")
+
+	couponRouter.POST("/validate", middleware.UserMiddleware(), controllers.ValidateCoupon)
+	couponRouter.GET("/", middleware.AdminMiddleware(), controllers.GetAllCoupons)
+	couponRouter.GET("/:id", middleware.AdminMiddleware(), controllers.GetCoupon)
+	couponRouter.POST("/", middleware.AdminMiddleware(), controllers.CreateCoupon)
+	couponRouter.PUT("/:id", middleware.AdminMiddleware(), controllers.UpdateCoupon)
+	couponRouter.DELETE("/:id", middleware.AdminMiddleware(), controllers.DeleteCoupon)
+}
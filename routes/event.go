@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func EventRoutes(router *gin.RouterGroup) {
+	eventRouter := router.Group("/event")
+
+	eventRouter.GET("/", controllers.GetPublicEvents)
+	eventRouter.GET("/:id", controllers.GetPublicEvent)
+	eventRouter.GET("/admin/all", middleware.AdminMiddleware(), controllers.GetAllEvents)
+	eventRouter.POST("/", middleware.AdminMiddleware(), controllers.CreateEvent)
+	eventRouter.PUT("/:id", middleware.AdminMiddleware(), controllers.UpdateEvent)
+	eventRouter.DELETE("/:id", middleware.AdminMiddleware(), controllers.DeleteEvent)
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func GroupOfferRoutes(router *gin.RouterGroup) {
+	groupOfferRouter := router.Group("/group-offer")
+
+	groupOfferRouter.GET("/", middleware.AdminMiddleware(), controllers.GetGroupOfferRules)
+	groupOfferRouter.POST("/", middleware.AdminMiddleware(), controllers.CreateGroupOfferRule)
+	groupOfferRouter.PUT("/:id", middleware.AdminMiddleware(), controllers.UpdateGroupOfferRule)
+	groupOfferRouter.DELETE("/:id", middleware.AdminMiddleware(), controllers.DeleteGroupOfferRule)
+}
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/helper"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/middleware"
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+// newTestRouter opens the test database and builds the whole router against
+// the fake payment gateway and a throwaway ticket signing key. Requests
+// authenticate with their user's Firebase ID as the bearer token.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	testdb.Open(t)
+	gin.SetMode(gin.TestMode)
+
+	gateway, verify, keys := config.PaymentGateway, middleware.VerifyIDToken, config.TicketKeys
+	t.Cleanup(func() {
+		config.PaymentGateway, middleware.VerifyIDToken, config.TicketKeys = gateway, verify, keys
+	})
+	config.PaymentGateway = payment.NewFakeGateway()
+	seed, _, err := helper.GenerateTicketKey()
+	if err != nil {
+		t.Fatalf("failed to generate ticket key: %v", err)
+	}
+	if config.TicketKeys, err = helper.ParseTicketKeyRing("test:"+seed, "", "test"); err != nil {
+		t.Fatalf("failed to load ticket key: %v", err)
+	}
+	middleware.VerifyIDToken = func(_ context.Context, idToken string) (string, error) {
+		return idToken, nil
+	}
+
+	router := gin.New()
+	AppRouter(router)
+	return router
+}
+
+// serve sends a request as the user with the given Firebase ID
+func serve(router *gin.Engine, method, path, firebaseID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+firebaseID)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
@@ -2,8 +2,10 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/config"
 	"github.com/jezhtech/prince-group-backend/controllers"
 	"github.com/jezhtech/prince-group-backend/middleware"
+	"github.com/jezhtech/prince-group-backend/payment"
 )
 
 func PaymentRoutes(router *gin.RouterGroup) {
@@ -15,7 +17,15 @@ func PaymentRoutes(router *gin.RouterGroup) {
 	paymentRouter.GET("/history", middleware.UserMiddleware(), controllers.GetPaymentHistory)
 	paymentRouter.POST("/send-email/:bookingNumber", middleware.UserMiddleware(), controllers.SendPaymentConfirmationEmail)
 
+	// Admin routes
+	paymentRouter.GET("/admin/transactions/:bookingNumber", middleware.AdminMiddleware(), controllers.GetBookingPaymentTransactions)
+
 	// Public routes (no authentication required)
 	paymentRouter.POST("/webhook", controllers.PaymentWebhook)
 	paymentRouter.GET("/callback", controllers.PaymentCallback)
+
+	// Local development only: settle links of the in-memory fake gateway
+	if _, ok := config.PaymentGateway.(*payment.FakeGateway); ok {
+		paymentRouter.POST("/fake/:linkId/:outcome", middleware.UserMiddleware(), controllers.SimulateFakePayment)
+	}
 }
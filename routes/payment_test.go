@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// TestFakeGatewayPaymentFlow books seats, fails a first payment, retries with
+// a new link and pays it, all through the API against the fake gateway
+func TestFakeGatewayPaymentFlow(t *testing.T) {
+	router := newTestRouter(t)
+
+	user := testdb.CreateUser(t, "user")
+	referral := testdb.CreateReferral(t)
+	ticket := testdb.CreateTicket(t, 10)
+
+	rec := serve(router, http.MethodPost, "/api/v1/booking/", user.FirebaseID,
+		fmt.Sprintf(`{"ticketId":%d,"ticketCount":2,"referralId":%q,"paymentMethod":"upi"}`, ticket.ID, referral.ReferralID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create booking: got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Booking models.Booking `json:"booking"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode booking: %v", err)
+	}
+	booking := created.Booking
+	if booking.Status != models.BookingStatusCreated || booking.PaymentPrice <= 0 {
+		t.Fatalf("new booking is %s for %v", booking.Status, booking.PaymentPrice)
+	}
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 8 {
+		t.Fatalf("booking left %d seats, want 8", seats)
+	}
+
+	createLink := func() string {
+		t.Helper()
+
+		rec := serve(router, http.MethodPost, "/api/v1/payment/links", user.FirebaseID,
+			fmt.Sprintf(`{"bookingId":%q,"amount":%v}`, booking.BookingNumber, booking.PaymentPrice))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create payment link: got %d: %s", rec.Code, rec.Body.String())
+		}
+		var link struct {
+			LinkID        string  `json:"linkId"`
+			OrderAmount   float64 `json:"orderAmount"`
+			OrderCurrency string  `json:"orderCurrency"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil {
+			t.Fatalf("failed to decode payment link: %v", err)
+		}
+		if link.OrderAmount != booking.PaymentPrice || link.OrderCurrency != "INR" {
+			t.Fatalf("link charges %v %s, want %v INR", link.OrderAmount, link.OrderCurrency, booking.PaymentPrice)
+		}
+		return link.LinkID
+	}
+	settle := func(linkID, outcome string) int {
+		t.Helper()
+		return serve(router, http.MethodPost, "/api/v1/payment/fake/"+linkID+"/"+outcome, user.FirebaseID, "").Code
+	}
+	status := func() models.BookingStatus {
+		t.Helper()
+
+		booking, err := models.GetBookingByBookingNumber(booking.BookingNumber)
+		if err != nil {
+			t.Fatalf("failed to reload booking: %v", err)
+		}
+		return booking.Status
+	}
+
+	firstLink := createLink()
+	if got := status(); got != models.BookingStatusAwaitingPayment {
+		t.Fatalf("after creating a link the booking is %s", got)
+	}
+
+	if code := settle(firstLink, "failed"); code != http.StatusOK {
+		t.Fatalf("failing payment: got %d", code)
+	}
+	if got := status(); got != models.BookingStatusFailed {
+		t.Fatalf("after a failed payment the booking is %s", got)
+	}
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 10 {
+		t.Fatalf("failed payment left %d seats, want 10", seats)
+	}
+
+	secondLink := createLink()
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 8 {
+		t.Fatalf("retrying took back %d seats, want 8 left", seats)
+	}
+	// Only the newest link may be paid
+	if code := settle(firstLink, "paid"); code != http.StatusConflict {
+		t.Fatalf("paying a replaced link: got %d, want %d", code, http.StatusConflict)
+	}
+
+	if code := settle(secondLink, "paid"); code != http.StatusOK {
+		t.Fatalf("paying: got %d", code)
+	}
+	if got := status(); got != models.BookingStatusPaid {
+		t.Fatalf("after paying the booking is %s", got)
+	}
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 8 {
+		t.Fatalf("paid booking left %d seats, want 8", seats)
+	}
+
+	passes, err := models.GetPassesByBookingID(booking.ID)
+	if err != nil {
+		t.Fatalf("failed to get passes: %v", err)
+	}
+	if len(passes) != 2 {
+		t.Fatalf("paid booking has %d passes, want 2", len(passes))
+	}
+
+	// The ledger and the status history name the same source for fake payments
+	transactions, err := models.GetPaymentTransactionsByBookingID(booking.ID)
+	if err != nil {
+		t.Fatalf("failed to get payment transactions: %v", err)
+	}
+	sources := []string{}
+	for _, transaction := range transactions {
+		sources = append(sources, transaction.Source+":"+transaction.Status)
+	}
+	want := []string{"link_created:pending", "fake_gateway:failed", "link_created:pending", "fake_gateway:success"}
+	if fmt.Sprint(sources) != fmt.Sprint(want) {
+		t.Errorf("ledger is %v, want %v", sources, want)
+	}
+
+	history, err := models.GetBookingStatusHistory(booking.ID)
+	if err != nil {
+		t.Fatalf("failed to get status history: %v", err)
+	}
+	for _, change := range history {
+		if change.ToStatus == models.BookingStatusPaid && change.Actor != "system:fake_gateway" {
+			t.Errorf("payment applied by %s, want system:fake_gateway", change.Actor)
+		}
+	}
+}
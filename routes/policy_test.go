@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+// bookingState is what a route needs its booking to be in to succeed
+type bookingState int
+
+const (
+	stateUnpaid bookingState = iota
+	statePaid
+	stateTransferring
+)
+
+// bookingFixture is a booking made for one request, with what routes refer to it by
+type bookingFixture struct {
+	booking models.Booking
+	linkID  string
+	passID  uint
+}
+
+// access says who may use a route: everyone with read access to a booking,
+// only those who may change it, or only admins
+type access int
+
+const (
+	accessRead access = iota
+	accessWrite
+	accessAdmin
+)
+
+// expectedStatus is the response a role should get from a route whose
+// success status is ok. Booking routes hide bookings from users who may not
+// act on them with 404; admin routes refuse everyone else with 403.
+func expectedStatus(role string, isOwner bool, a access, ok int) int {
+	switch a {
+	case accessAdmin:
+		if role == "admin" {
+			return ok
+		}
+		return http.StatusForbidden
+	case accessWrite:
+		if isOwner || role == "admin" {
+			return ok
+		}
+		return http.StatusNotFound
+	default:
+		if isOwner || role == "admin" || role == "client" {
+			return ok
+		}
+		return http.StatusNotFound
+	}
+}
+
+// TestBookingAccessPolicy runs every booking, payment and pass route as the
+// booking's owner, another customer, an admin and a client, each against a
+// booking of its own
+func TestBookingAccessPolicy(t *testing.T) {
+	router := newTestRouter(t)
+
+	owner := testdb.CreateUser(t, "user")
+	callers := []struct {
+		name    string
+		user    models.User
+		isOwner bool
+	}{
+		{"owner", owner, true},
+		{"other user", testdb.CreateUser(t, "user"), false},
+		{"admin", testdb.CreateUser(t, "admin"), false},
+		{"client", testdb.CreateUser(t, "client"), false},
+	}
+
+	referral := testdb.CreateReferral(t)
+	ticket := testdb.CreateTicket(t, 1000)
+
+	newFixture := func(t *testing.T, state bookingState) bookingFixture {
+		t.Helper()
+
+		booking, err := models.CreateBooking(testdb.NewBooking(owner, referral, ticket, 2))
+		if err != nil {
+			t.Fatalf("failed to create booking: %v", err)
+		}
+		fixture := bookingFixture{booking: booking, linkID: uuid.New().String()}
+
+		if _, err := config.PaymentGateway.CreateLink(payment.LinkRequest{LinkID: fixture.linkID, Amount: booking.PaymentPrice}); err != nil {
+			t.Fatalf("failed to create payment link: %v", err)
+		}
+		if err := models.SetBookingPaymentLink(booking.ID, fixture.linkID); err != nil {
+			t.Fatalf("failed to set payment link: %v", err)
+		}
+		if state == stateUnpaid {
+			return fixture
+		}
+
+		for _, to := range []models.BookingStatus{models.BookingStatusAwaitingPayment, models.BookingStatusPaid} {
+			if _, err := models.TransitionBooking(booking.ID, to, "test", "test"); err != nil {
+				t.Fatalf("failed to move booking to %s: %v", to, err)
+			}
+		}
+		passes, err := models.GetPassesByBookingID(booking.ID)
+		if err != nil || len(passes) == 0 {
+			t.Fatalf("paid booking has no passes: %v", err)
+		}
+		fixture.passID = passes[0].ID
+		if state == statePaid {
+			return fixture
+		}
+
+		booking, err = models.GetBookingByBookingNumber(booking.BookingNumber)
+		if err != nil {
+			t.Fatalf("failed to reload booking: %v", err)
+		}
+		if _, err := models.CreateBookingTransfer(booking, "friend@example.com", nil); err != nil {
+			t.Fatalf("failed to start transfer: %v", err)
+		}
+		return fixture
+	}
+
+	cases := []struct {
+		name    string
+		state   bookingState
+		access  access
+		ok      int
+		request func(f bookingFixture) (method, path, body string)
+	}{
+		{"get booking", stateUnpaid, accessRead, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/booking/" + f.booking.BookingNumber, ""
+		}},
+		{"update booking", stateUnpaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodPut, "/api/v1/booking/" + f.booking.BookingNumber, `{"paymentMethod":"card"}`
+		}},
+		{"delete booking", stateUnpaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodDelete, "/api/v1/booking/" + f.booking.ID.String(), ""
+		}},
+		{"check payment", stateUnpaid, accessRead, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/booking/check-payment/" + f.booking.BookingNumber + "?paymentLinkId=" + f.linkID, ""
+		}},
+		{"booking history", stateUnpaid, accessAdmin, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/booking/admin/history/" + f.booking.BookingNumber, ""
+		}},
+		{"get passes", statePaid, accessRead, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/booking/" + f.booking.BookingNumber + "/passes", ""
+		}},
+		{"assign pass", statePaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodPut, fmt.Sprintf("/api/v1/booking/%s/passes/%d", f.booking.BookingNumber, f.passID), `{"attendeeName":"Guest"}`
+		}},
+		{"cancel booking", stateUnpaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodPost, "/api/v1/booking/" + f.booking.BookingNumber + "/cancel", ""
+		}},
+		{"request refund", statePaid, accessWrite, http.StatusAccepted, func(f bookingFixture) (string, string, string) {
+			return http.MethodPost, "/api/v1/booking/" + f.booking.BookingNumber + "/cancel", `{"reason":"cannot attend"}`
+		}},
+		{"transfer booking", statePaid, accessWrite, http.StatusCreated, func(f bookingFixture) (string, string, string) {
+			return http.MethodPost, "/api/v1/booking/" + f.booking.BookingNumber + "/transfer", `{"email":"friend@example.com"}`
+		}},
+		{"cancel transfer", stateTransferring, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodDelete, "/api/v1/booking/transfer/" + f.booking.BookingNumber, ""
+		}},
+		{"get transfers", stateTransferring, accessRead, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/booking/" + f.booking.BookingNumber + "/transfers", ""
+		}},
+		{"create payment link", stateUnpaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodPost, "/api/v1/payment/links", fmt.Sprintf(`{"bookingId":%q,"amount":%v}`, f.booking.BookingNumber, f.booking.PaymentPrice)
+		}},
+		{"payment status", stateUnpaid, accessRead, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/payment/status/" + f.linkID, ""
+		}},
+		{"send confirmation email", statePaid, accessWrite, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodPost, "/api/v1/payment/send-email/" + f.booking.BookingNumber, ""
+		}},
+		{"payment transactions", statePaid, accessAdmin, http.StatusOK, func(f bookingFixture) (string, string, string) {
+			return http.MethodGet, "/api/v1/payment/admin/transactions/" + f.booking.BookingNumber, ""
+		}},
+	}
+
+	for _, tc := range cases {
+		for _, caller := range callers {
+			t.Run(tc.name+"/"+caller.name, func(t *testing.T) {
+				method, path, body := tc.request(newFixture(t, tc.state))
+
+				rec := serve(router, method, path, caller.user.FirebaseID, body)
+
+				want := expectedStatus(caller.user.Role, caller.isOwner, tc.access, tc.ok)
+				if rec.Code != want {
+					t.Errorf("%s %s: got %d, want %d: %s", method, path, rec.Code, want, rec.Body.String())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+	"github.com/jezhtech/prince-group-backend/payment"
+)
+
+// TestCancelUnpaidBooking cancels bookings whose payment link was paid, has
+// expired or is still open at the gateway. A payment the booking has not
+// heard of yet is applied instead of being lost with the cancelled booking.
+func TestCancelUnpaidBooking(t *testing.T) {
+	router := newTestRouter(t)
+	fake := config.PaymentGateway.(*payment.FakeGateway)
+
+	user := testdb.CreateUser(t, "user")
+	referral := testdb.CreateReferral(t)
+	ticket := testdb.CreateTicket(t, 10)
+
+	tests := []struct {
+		name       string
+		outcome    string
+		wantCode   int
+		wantStatus models.BookingStatus
+	}{
+		{"open link", "", http.StatusOK, models.BookingStatusCancelled},
+		{"paid at the gateway", payment.FakeOutcomePaid, http.StatusConflict, models.BookingStatusPaid},
+		{"expired link", payment.FakeOutcomeExpired, http.StatusOK, models.BookingStatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking, err := models.CreateBooking(testdb.NewBooking(user, referral, ticket, 1))
+			if err != nil {
+				t.Fatalf("failed to create booking: %v", err)
+			}
+
+			rec := serve(router, http.MethodPost, "/api/v1/payment/links", user.FirebaseID,
+				fmt.Sprintf(`{"bookingId":%q,"amount":%v}`, booking.BookingNumber, booking.PaymentPrice))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("create payment link: got %d: %s", rec.Code, rec.Body.String())
+			}
+			var link struct {
+				LinkID string `json:"linkId"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil {
+				t.Fatalf("failed to decode payment link: %v", err)
+			}
+			// Settled at the gateway without the booking being told
+			if tt.outcome != "" {
+				if err := fake.Simulate(link.LinkID, tt.outcome); err != nil {
+					t.Fatalf("failed to settle link: %v", err)
+				}
+			}
+
+			rec = serve(router, http.MethodPost, "/api/v1/booking/"+booking.BookingNumber+"/cancel", user.FirebaseID, "")
+			if rec.Code != tt.wantCode {
+				t.Errorf("cancel: got %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+
+			booking, err = models.GetBookingByBookingNumber(booking.BookingNumber)
+			if err != nil {
+				t.Fatalf("failed to reload booking: %v", err)
+			}
+			if booking.Status != tt.wantStatus {
+				t.Errorf("booking is %s, want %s", booking.Status, tt.wantStatus)
+			}
+
+			status, err := fake.GetLinkStatus(link.LinkID)
+			if err != nil {
+				t.Fatalf("failed to get link status: %v", err)
+			}
+			if tt.wantStatus == models.BookingStatusCancelled && status.Status == "pending" {
+				t.Errorf("link of the cancelled booking is still open")
+			}
+		})
+	}
+}
+
+// flakyGateway is the fake gateway with a refund call that fails once: after
+// the refund was made when accepted is set, as on a timeout, or refused
+// outright otherwise
+type flakyGateway struct {
+	*payment.FakeGateway
+	fail     bool
+	accepted bool
+}
+
+func (g *flakyGateway) Refund(req payment.RefundRequest) (*payment.Refund, error) {
+	if !g.fail {
+		return g.FakeGateway.Refund(req)
+	}
+	g.fail = false
+
+	if !g.accepted {
+		return nil, fmt.Errorf("%w: refund declined", payment.ErrInvalidRefund)
+	}
+	if _, err := g.FakeGateway.Refund(req); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("timeout awaiting response")
+}
+
+// payBooking creates the booking and pays for it through the fake gateway
+func payBooking(t *testing.T, router *gin.Engine, user models.User, booking models.Booking) models.Booking {
+	t.Helper()
+
+	booking, err := models.CreateBooking(booking)
+	if err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+
+	rec := serve(router, http.MethodPost, "/api/v1/payment/links", user.FirebaseID,
+		fmt.Sprintf(`{"bookingId":%q,"amount":%v}`, booking.BookingNumber, booking.PaymentPrice))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create payment link: got %d: %s", rec.Code, rec.Body.String())
+	}
+	var link struct {
+		LinkID string `json:"linkId"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil {
+		t.Fatalf("failed to decode payment link: %v", err)
+	}
+	if rec := serve(router, http.MethodPost, "/api/v1/payment/fake/"+link.LinkID+"/paid", user.FirebaseID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("paying: got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	return booking
+}
+
+// TestRefundBookingRetry refunds a booking through a gateway that times out
+// after making the refund, then declines one. The timed out refund is sent
+// again under its refund ID, and only the declined one gives way to a new ID.
+func TestRefundBookingRetry(t *testing.T) {
+	router := newTestRouter(t)
+	gateway := &flakyGateway{FakeGateway: config.PaymentGateway.(*payment.FakeGateway)}
+
+	user := testdb.CreateUser(t, "user")
+	admin := testdb.CreateUser(t, "admin")
+	booking := payBooking(t, router, user, testdb.NewBooking(user, testdb.CreateReferral(t), testdb.CreateTicket(t, 10), 2))
+	config.PaymentGateway = gateway
+
+	id := func(n int) string { return fmt.Sprintf("RF-%s-%d", booking.BookingNumber, n) }
+	refund := func(wantCode int) {
+		t.Helper()
+
+		rec := serve(router, http.MethodPost, "/api/v1/booking/admin/refund/"+booking.BookingNumber, admin.FirebaseID, `{"amount":500}`)
+		if rec.Code != wantCode {
+			t.Fatalf("refund: got %d, want %d: %s", rec.Code, wantCode, rec.Body.String())
+		}
+	}
+	statuses := func() map[string]string {
+		t.Helper()
+
+		refunds, err := models.GetRefundsByBookingID(booking.ID)
+		if err != nil {
+			t.Fatalf("failed to get refunds: %v", err)
+		}
+		statuses := map[string]string{}
+		for _, refund := range refunds {
+			statuses[refund.RefundID] = refund.Status
+		}
+		return statuses
+	}
+
+	gateway.fail, gateway.accepted = true, true
+	refund(http.StatusBadGateway)
+	if got := statuses(); len(got) != 1 || got[id(1)] != "pending" {
+		t.Fatalf("after a timeout the refunds are %v, want %s pending", got, id(1))
+	}
+
+	refund(http.StatusOK)
+	if got := statuses(); len(got) != 1 || got[id(1)] != "success" {
+		t.Fatalf("after the retry the refunds are %v, want only %s made", got, id(1))
+	}
+
+	gateway.fail, gateway.accepted = true, false
+	refund(http.StatusBadGateway)
+	if got := statuses(); len(got) != 2 || got[id(2)] != "failed" {
+		t.Fatalf("after a decline the refunds are %v, want %s failed", got, id(2))
+	}
+
+	refund(http.StatusOK)
+	if got := statuses(); len(got) != 3 || got[id(3)] != "success" {
+		t.Fatalf("after refunding again the refunds are %v, want %s made", got, id(3))
+	}
+}
+
+// TestRefundCounterBookings refunds bookings that never went through the
+// payment gateway. A box office sale is paid back at the counter and shows as
+// a reversal in the box office totals; a complimentary booking is cancelled
+// with nothing to refund.
+func TestRefundCounterBookings(t *testing.T) {
+	router := newTestRouter(t)
+
+	admin := testdb.CreateUser(t, "admin")
+	referral := testdb.CreateReferral(t)
+	ticket := testdb.CreateTicket(t, 10)
+	now := time.Now()
+
+	t.Run("box office", func(t *testing.T) {
+		booking, _, err := models.CreateBoxOfficeSale(testdb.NewBooking(admin, referral, ticket, 2), models.BoxOfficeSale{
+			OperatorID:      admin.FirebaseID,
+			ReceiptNumber:   "R-1",
+			PaymentMethod:   "cash",
+			AmountCollected: 2000,
+			CustomerName:    "Walk-in",
+		})
+		if err != nil {
+			t.Fatalf("failed to sell booking: %v", err)
+		}
+
+		rec := serve(router, http.MethodPost, "/api/v1/booking/admin/refund/"+booking.BookingNumber, admin.FirebaseID, `{"amount":500}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refund: got %d: %s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Refund models.Refund `json:"refund"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode refund: %v", err)
+		}
+		if body.Refund.Status != "success" || body.Refund.Amount != 500 || body.Refund.ProviderOrderID != "R-1" {
+			t.Errorf("refund is %s of %v against %q, want success of 500 against R-1", body.Refund.Status, body.Refund.Amount, body.Refund.ProviderOrderID)
+		}
+
+		booking, err = models.GetBookingByBookingNumber(booking.BookingNumber)
+		if err != nil {
+			t.Fatalf("failed to reload booking: %v", err)
+		}
+		if booking.Status != models.BookingStatusRefunded {
+			t.Errorf("booking is %s, want %s", booking.Status, models.BookingStatusRefunded)
+		}
+
+		totals, err := models.GetBoxOfficeTotals(now.Add(-time.Hour), now.Add(time.Hour), admin.FirebaseID)
+		if err != nil {
+			t.Fatalf("failed to get totals: %v", err)
+		}
+		if len(totals) != 1 {
+			t.Fatalf("got %d totals, want 1: %+v", len(totals), totals)
+		}
+		if total := totals[0]; total.Sales != 1 || total.Amount != 2000 || total.Refunds != 1 || total.Refunded != 500 {
+			t.Errorf("totals are %d sales of %v and %d refunds of %v, want 1 of 2000 and 1 of 500", total.Sales, total.Amount, total.Refunds, total.Refunded)
+		}
+	})
+
+	t.Run("complimentary", func(t *testing.T) {
+		category, err := models.CreateCompCategory(models.CompCategory{EventID: *ticket.EventID, Name: "Guest list"})
+		if err != nil {
+			t.Fatalf("failed to create category: %v", err)
+		}
+		comps, err := models.IssueComplimentaryTickets(category.ID,
+			[]models.Booking{testdb.NewBooking(admin, referral, ticket, 1)},
+			[]models.ComplimentaryTicket{{GuestName: "Guest", IssuedBy: admin.FirebaseID}})
+		if err != nil {
+			t.Fatalf("failed to issue complimentary ticket: %v", err)
+		}
+		booking := *comps[0].Booking
+
+		rec := serve(router, http.MethodPost, "/api/v1/booking/admin/refund/"+booking.BookingNumber, admin.FirebaseID, `{"amount":100}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("refund an amount: got %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+		rec = serve(router, http.MethodPost, "/api/v1/booking/admin/refund/"+booking.BookingNumber, admin.FirebaseID, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("cancel: got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		booking, err = models.GetBookingByBookingNumber(booking.BookingNumber)
+		if err != nil {
+			t.Fatalf("failed to reload booking: %v", err)
+		}
+		if booking.Status != models.BookingStatusCancelled {
+			t.Errorf("booking is %s, want %s", booking.Status, models.BookingStatusCancelled)
+		}
+		refunds, err := models.GetRefundsByBookingID(booking.ID)
+		if err != nil || len(refunds) != 0 {
+			t.Errorf("complimentary booking has %d refunds (%v), want none", len(refunds), err)
+		}
+	})
+
+	if seats := testdb.AvailableSeats(t, ticket.ID); seats != 10 {
+		t.Errorf("%d seats left, want 10", seats)
+	}
+}
@@ -16,8 +16,16 @@ func AppRouter(router *gin.Engine) {
 		BookingRoutes(apiRouter)
 		ClientRoutes(apiRouter)
 		ReferralRoutes(apiRouter)
+		EventRoutes(apiRouter)
 		TicketRoutes(apiRouter)
+		CouponRoutes(apiRouter)
+		GroupOfferRoutes(apiRouter)
+		WaitlistRoutes(apiRouter)
+		TransferRoutes(apiRouter)
+		BoxOfficeRoutes(apiRouter)
+		ComplimentaryRoutes(apiRouter)
 		YouTubeRoutes(apiRouter)
 		PaymentRoutes(apiRouter)
+		CheckInRoutes(apiRouter)
 	}
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAppRouter builds the whole router, which is where gin panics on
+// conflicting paths such as two different wildcards in the same segment
+func TestAppRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("building the router panicked: %v", r)
+		}
+	}()
+
+	router := gin.New()
+	AppRouter(router)
+
+	if len(router.Routes()) == 0 {
+		t.Fatal("router has no routes")
+	}
+}
@@ -10,8 +10,15 @@ func TicketRoutes(router *gin.RouterGroup) {
 	ticketRouter := router.Group("/ticket")
 
 	ticketRouter.GET("/:id", middleware.UserMiddleware(), controllers.GetTicket)
-	ticketRouter.GET("/", controllers.GetAllTickets)
+	ticketRouter.GET("/", controllers.GetPublicTickets)
+	ticketRouter.GET("/admin/all", middleware.AdminMiddleware(), controllers.GetAllTickets)
+	ticketRouter.GET("/signing-keys", controllers.GetTicketSigningKeys)
 	ticketRouter.POST("/", middleware.AdminMiddleware(), controllers.CreateTicket)
 	ticketRouter.PUT("/:id", middleware.AdminMiddleware(), controllers.UpdateTicket)
 	ticketRouter.DELETE("/:id", middleware.AdminMiddleware(), controllers.DeleteTicket)
+	ticketRouter.GET("/:id/tiers", middleware.AdminMiddleware(), controllers.GetPriceTiers)
+	ticketRouter.POST("/:id/tiers", middleware.AdminMiddleware(), controllers.CreatePriceTier)
+	ticketRouter.PUT("/:id/tiers/:tierId", middleware.AdminMiddleware(), controllers.UpdatePriceTier)
+	ticketRouter.DELETE("/:id/tiers/:tierId", middleware.AdminMiddleware(), controllers.DeletePriceTier)
+	ticketRouter.GET("/:id/waitlist", middleware.AdminMiddleware(), controllers.GetTicketWaitlist)
 }
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jezhtech/prince-group-backend/config"
+	"github.com/jezhtech/prince-group-backend/internal/testdb"
+	"github.com/jezhtech/prince-group-backend/models"
+)
+
+// TestUnpublishedEventTickets checks that tickets of an event that is not
+// published cannot be booked, quoted or paid for, and that the public
+// listing hides draft events' tickets like the event listing does
+func TestUnpublishedEventTickets(t *testing.T) {
+	router := newTestRouter(t)
+
+	user := testdb.CreateUser(t, "user")
+	referral := testdb.CreateReferral(t)
+	ticket := testdb.CreateTicket(t, 10)
+	// Booked while the event was still published
+	booking, err := models.CreateBooking(testdb.NewBooking(user, referral, ticket, 1))
+	if err != nil {
+		t.Fatalf("failed to create booking: %v", err)
+	}
+
+	listed := func() (bool, string) {
+		t.Helper()
+
+		rec := serve(router, http.MethodGet, "/api/v1/ticket/", "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list tickets: got %d: %s", rec.Code, rec.Body.String())
+		}
+		var listing struct {
+			Tickets []models.Ticket `json:"tickets"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+			t.Fatalf("failed to decode tickets: %v", err)
+		}
+		for _, listed := range listing.Tickets {
+			if listed.ID == ticket.ID {
+				return true, listed.Pricing.SaleStatus
+			}
+		}
+		return false, ""
+	}
+
+	requests := []struct {
+		name, path, body string
+	}{
+		{"book", "/api/v1/booking/", fmt.Sprintf(`{"ticketId":%d,"ticketCount":1,"referralId":%q,"paymentMethod":"upi"}`, ticket.ID, referral.ReferralID)},
+		{"quote", "/api/v1/coupon/validate", fmt.Sprintf(`{"code":"ANY","ticketId":%d,"ticketCount":1}`, ticket.ID)},
+		{"pay", "/api/v1/payment/links", fmt.Sprintf(`{"bookingId":%q,"amount":%v}`, booking.BookingNumber, booking.PaymentPrice)},
+	}
+
+	for _, status := range []models.EventStatus{models.EventStatusDraft, models.EventStatusCancelled, models.EventStatusCompleted} {
+		t.Run(string(status), func(t *testing.T) {
+			if err := config.DB.Model(&models.Event{}).Where("id = ?", *ticket.EventID).Update("status", status).Error; err != nil {
+				t.Fatalf("failed to update event: %v", err)
+			}
+
+			for _, req := range requests {
+				rec := serve(router, http.MethodPost, req.path, user.FirebaseID, req.body)
+				if rec.Code != http.StatusConflict {
+					t.Errorf("%s: got %d, want %d: %s", req.name, rec.Code, http.StatusConflict, rec.Body.String())
+				}
+			}
+
+			isListed, saleStatus := listed()
+			if status == models.EventStatusDraft && isListed {
+				t.Errorf("ticket of a draft event is listed")
+			}
+			if status != models.EventStatusDraft && (!isListed || saleStatus != models.SaleStatusEnded) {
+				t.Errorf("ticket of a %s event: listed %v as %q, want listed as %q", status, isListed, saleStatus, models.SaleStatusEnded)
+			}
+		})
+	}
+
+	if err := config.DB.Model(&models.Event{}).Where("id = ?", *ticket.EventID).Update("status", models.EventStatusPublished).Error; err != nil {
+		t.Fatalf("failed to update event: %v", err)
+	}
+	if isListed, saleStatus := listed(); !isListed || saleStatus != models.SaleStatusOnSale {
+		t.Errorf("ticket of the published event: listed %v as %q", isListed, saleStatus)
+	}
+	if rec := serve(router, http.MethodPost, requests[0].path, user.FirebaseID, requests[0].body); rec.Code != http.StatusOK {
+		t.Errorf("booking the published event: got %d: %s", rec.Code, rec.Body.String())
+	}
+}
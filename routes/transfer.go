@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func TransferRoutes(router *gin.RouterGroup) {
+	transferRouter := router.Group("/transfer")
+
+	transferRouter.GET("/incoming", middleware.UserMiddleware(), controllers.GetIncomingTransfers)
+	transferRouter.POST("/:id/accept", middleware.UserMiddleware(), controllers.AcceptBookingTransfer)
+}
@@ -15,4 +15,5 @@ func UserRoutes(router *gin.RouterGroup) {
 
 	userRouter.GET("/all", middleware.AdminMiddleware(), controllers.GetAllUsers)
 	userRouter.DELETE("/:id", middleware.AdminMiddleware(), controllers.DeleteUser)
+	userRouter.PUT("/role/:firebaseId", middleware.AdminMiddleware(), controllers.UpdateUserRole)
 }
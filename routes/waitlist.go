@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jezhtech/prince-group-backend/controllers"
+	"github.com/jezhtech/prince-group-backend/middleware"
+)
+
+func WaitlistRoutes(router *gin.RouterGroup) {
+	waitlistRouter := router.Group("/waitlist")
+
+	waitlistRouter.POST("/", middleware.UserMiddleware(), controllers.JoinWaitlist)
+	waitlistRouter.GET("/me", middleware.UserMiddleware(), controllers.GetMyWaitlist)
+	waitlistRouter.DELETE("/:id", middleware.UserMiddleware(), controllers.LeaveWaitlist)
+	waitlistRouter.GET("/offer/:token", middleware.UserMiddleware(), controllers.GetWaitlistOffer)
+	waitlistRouter.POST("/offer/:token/claim", middleware.UserMiddleware(), controllers.ClaimWaitlistOffer)
+}